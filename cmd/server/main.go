@@ -52,7 +52,11 @@ func main() {
 	})
 
 	// Initialize WebUSB handler
-	webusbHandler := handlers.NewWebusbHandler()
+	webusbHandler, err := handlers.NewWebusbHandler(cfg)
+	if err != nil {
+		slog.Error("Failed to initialize WebUSB handler", "error", err)
+		os.Exit(1)
+	}
 
 	// WebUSB API endpoints for device management
 	api := app.Group("/api/webusb")
@@ -61,10 +65,23 @@ func main() {
 	api.Post("/devices/register", webusbHandler.RegisterDevice)
 	api.Post("/devices/connect", webusbHandler.ConnectDevice)
 	api.Post("/devices/disconnect", webusbHandler.DisconnectDevice)
+	api.Get("/devices", webusbHandler.ListDevices)
+	api.Get("/devices/:deviceId", webusbHandler.GetDevice)
+	api.Post("/devices/:deviceId/notes", webusbHandler.AddDeviceNote)
 	
 	// Data acquisition endpoints
 	api.Post("/acquisition/start", webusbHandler.StartAcquisition)
 	api.Post("/acquisition/stop", webusbHandler.StopAcquisition)
+	api.Get("/acquisitions", webusbHandler.ListAcquisitions)
+	api.Get("/acquisition/:acquisitionId/status", webusbHandler.GetAcquisitionStatus)
+	api.Post("/acquisition/:acquisitionId/flag", webusbHandler.FlagAcquisition)
+	api.Post("/acquisition/:acquisitionId/pause", webusbHandler.PauseAcquisition)
+	api.Post("/acquisition/:acquisitionId/resume", webusbHandler.ResumeAcquisition)
+	api.Get("/acquisition/:acquisitionId/data", webusbHandler.GetAcquisitionData)
+	api.Get("/acquisition/:acquisitionId/export", webusbHandler.ExportAcquisition)
+	api.Get("/acquisition/:acquisitionId/watch", webusbHandler.WatchAcquisition)
+	api.Put("/acquisition/:acquisitionId/chunks/:index", webusbHandler.UploadChunk)
+	api.Post("/acquisition/:acquisitionId/chunks", webusbHandler.UploadChunkBatch)
 	
 	// Session management endpoints
 	api.Get("/sessions/:sessionId/status", webusbHandler.GetSessionStatus)
@@ -85,6 +102,18 @@ func main() {
 		}
 	}()
 
+	// Start retention enforcement goroutine
+	go func() {
+		ticker := time.NewTicker(cfg.Retention.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				webusbHandler.EnforceRetention()
+			}
+		}
+	}()
+
 	// Serve all files under /web directory
 	// Check if we're in Docker (web files at /web) or local dev (web files at ./web)
 	webDir := "./web"
@@ -232,5 +261,10 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Flush acquisition data that is still being written and persist sessions
+	if err := webusbHandler.Close(); err != nil {
+		slog.Error("Failed to close acquisition storage and sessions", "error", err)
+	}
+
 	slog.Info("Server exited gracefully")
 }
@@ -0,0 +1,86 @@
+// Command verify-bundle checks acquisition bundles offline: every file
+// against its SHA-256 checksum and the manifest, and every stored chunk
+// against the acquisition's index. It exits non-zero if any bundle fails.
+//
+// Usage: verify-bundle [-q] bundle.tar...
+// A bundle name of "-" reads standard input.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"acquire-app/internal/bundle"
+)
+
+func main() {
+	quiet := flag.Bool("q", false, "only report problems")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-q] bundle.tar...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, name := range flag.Args() {
+		if !verify(name, *quiet) {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// verify checks one bundle and prints the outcome
+func verify(name string, quiet bool) bool {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			return false
+		}
+		defer file.Close()
+		r = file
+	}
+
+	report, err := bundle.Verify(r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return false
+	}
+
+	if !quiet {
+		fmt.Printf("%s:\n", name)
+		if manifest := report.Manifest; manifest != nil && manifest.Acquisition != nil {
+			acquisition := manifest.Acquisition
+			fmt.Printf("  acquisition %s, %s, started %s\n", acquisition.ID, acquisition.Status, acquisition.StartTime.Format("2006-01-02 15:04:05 MST"))
+			fmt.Printf("  %d Hz, %d bit, %d channels, %d chunks, %d bytes\n",
+				manifest.Settings.SampleRate, manifest.Settings.BitDepth, manifest.Settings.Channels,
+				manifest.FinalStats.TotalChunks, manifest.FinalStats.TotalBytes)
+		}
+		for _, file := range report.Files {
+			fmt.Printf("  %s  %12d  %s\n", file.SHA256, file.Size, file.Name)
+		}
+		fmt.Printf("  %d chunks verified\n", report.Chunks)
+	}
+
+	for _, problem := range report.Problems {
+		fmt.Printf("%s: %s\n", name, problem)
+	}
+	if !quiet {
+		if report.OK() {
+			fmt.Printf("%s: OK\n", name)
+		} else {
+			fmt.Printf("%s: FAILED\n", name)
+		}
+	}
+	return report.OK()
+}
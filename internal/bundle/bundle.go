@@ -0,0 +1,126 @@
+// Package bundle packs the stored files of an acquisition into a single tar
+// archive together with a manifest describing the recording and a SHA-256
+// checksum of every file, and verifies such archives offline.
+//
+// Every file sits in a directory named after the acquisition, in this
+// order: the storage index, the data segments, the manifest and the
+// checksum list. The checksum list uses the sha256sum format, so an
+// extracted bundle can also be checked with `sha256sum -c SHA256SUMS`.
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"acquire-app/internal/models"
+)
+
+const (
+	ManifestName  = "manifest.json"
+	ChecksumsName = "SHA256SUMS"
+
+	// FormatVersion is the manifest layout written by this package
+	FormatVersion = 1
+)
+
+// Manifest describes a bundled acquisition
+type Manifest struct {
+	FormatVersion int       `json:"formatVersion"`
+	CreatedAt     time.Time `json:"createdAt"`
+
+	Acquisition *models.Acquisition        `json:"acquisition"`
+	Metadata    models.AcquisitionMetadata `json:"metadata"`
+	DeviceInfo  models.DeviceInfo          `json:"deviceInfo"`
+	// Capabilities are those the device registered with; nil once its
+	// session no longer exists
+	Capabilities *models.DeviceCapabilities `json:"capabilities,omitempty"`
+	FinalStats   models.FinalStats          `json:"finalStats"`
+	// Settings is the sample format of the data segments
+	Settings models.AcquisitionSettings `json:"settings"`
+	History  []models.AcquisitionEvent  `json:"history"`
+
+	// Files lists the data files of the bundle, everything but the manifest
+	// and the checksum list
+	Files []File `json:"files"`
+}
+
+// File is a file in the bundle
+type File struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Writer writes a bundle to an underlying writer
+type Writer struct {
+	tw      *tar.Writer
+	dir     string
+	modTime time.Time
+	files   []File
+}
+
+// NewWriter starts a bundle whose files go into directory dir
+func NewWriter(w io.Writer, dir string, modTime time.Time) *Writer {
+	return &Writer{tw: tar.NewWriter(w), dir: dir, modTime: modTime.Truncate(time.Second)}
+}
+
+// WriteFile adds a data file of size bytes read from r
+func (w *Writer) WriteFile(name string, size int64, r io.Reader) error {
+	sum, err := w.write(name, size, r)
+	if err != nil {
+		return err
+	}
+	w.files = append(w.files, File{Name: name, Size: size, SHA256: sum})
+	return nil
+}
+
+// Finish lists the data files written in the manifest, then writes the
+// manifest and the checksum list. It does not close the underlying writer.
+func (w *Writer) Finish(manifest *Manifest) error {
+	manifest.Files = w.files
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode manifest: %w", err)
+	}
+	sum, err := w.write(ManifestName, int64(len(data)), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	var sums strings.Builder
+	for _, file := range append(w.files, File{Name: ManifestName, SHA256: sum}) {
+		fmt.Fprintf(&sums, "%s  %s\n", file.SHA256, file.Name)
+	}
+	if _, err := w.write(ChecksumsName, int64(sums.Len()), strings.NewReader(sums.String())); err != nil {
+		return err
+	}
+	return w.tw.Close()
+}
+
+// write adds a file to the archive and returns its checksum
+func (w *Writer) write(name string, size int64, r io.Reader) (string, error) {
+	err := w.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     path.Join(w.dir, name),
+		Size:     size,
+		Mode:     0o644,
+		ModTime:  w.modTime,
+	})
+	if err != nil {
+		return "", fmt.Errorf("write %s: %w", name, err)
+	}
+
+	hash := sha256.New()
+	if _, err := io.CopyN(w.tw, io.TeeReader(r, hash), size); err != nil {
+		return "", fmt.Errorf("write %s: %w", name, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
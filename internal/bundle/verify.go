@@ -0,0 +1,321 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"strings"
+
+	"acquire-app/internal/storage"
+)
+
+// Report is the outcome of verifying a bundle
+type Report struct {
+	// Manifest is nil if the bundle has none or it cannot be parsed
+	Manifest *Manifest
+	// Files lists every file of the bundle with its actual size and checksum
+	Files []File
+	// Chunks is the number of chunks whose checksum matched
+	Chunks int
+	// Problems lists everything that failed verification
+	Problems []string
+}
+
+// OK reports whether the bundle passed every check
+func (r *Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *Report) problem(format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// Verify reads a bundle and checks every file against the checksum list and
+// the manifest, and every chunk of the data segments against the storage
+// index. The bundle is read once, front to back. Integrity failures are
+// listed in the report; an error is returned only if the archive itself
+// cannot be read.
+func Verify(r io.Reader) (*Report, error) {
+	report := &Report{}
+	v := &verifier{report: report, sums: make(map[string]string), overall: sha256.New()}
+
+	tr := tar.NewReader(r)
+	dir := ""
+	for first := true; ; first = false {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read bundle: %w", err)
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		entryDir, name := path.Split(header.Name)
+		if first {
+			dir = entryDir
+		}
+		if entryDir != dir || header.Typeflag != tar.TypeReg {
+			report.problem("unexpected entry %s", header.Name)
+			continue
+		}
+
+		if err := v.file(name, tr); err != nil {
+			return nil, fmt.Errorf("read %s: %w", header.Name, err)
+		}
+	}
+
+	v.finish()
+	return report, nil
+}
+
+// verifier holds the state of a verification between archive entries
+type verifier struct {
+	report *Report
+	// sums maps file names to their checksums as listed in SHA256SUMS
+	sums      map[string]string
+	sumsFound bool
+
+	index *storage.Index
+	// segments maps segment file names to segment numbers
+	segments map[string]int
+	// nextSegment is the segment expected next for the overall checksum
+	nextSegment int
+	// ordered is set if the index lists the chunks in storage order, so the
+	// overall checksum can be computed while the segments stream past
+	ordered bool
+	overall hash.Hash
+}
+
+// file verifies one file of the bundle
+func (v *verifier) file(name string, r io.Reader) error {
+	fileHash := sha256.New()
+	counter := &countingReader{r: io.TeeReader(r, fileHash)}
+
+	var data []byte
+	switch segment, isSegment := v.segments[name]; {
+	case isSegment:
+		if err := v.segment(segment, counter); err != nil {
+			return err
+		}
+	case name == storage.IndexFileName, name == ManifestName, name == ChecksumsName:
+		var err error
+		if data, err = io.ReadAll(counter); err != nil {
+			return err
+		}
+	}
+	if _, err := io.Copy(io.Discard, counter); err != nil {
+		return err
+	}
+
+	sum := hex.EncodeToString(fileHash.Sum(nil))
+	v.report.Files = append(v.report.Files, File{Name: name, Size: counter.n, SHA256: sum})
+
+	switch name {
+	case storage.IndexFileName:
+		v.parseIndex(data)
+	case ManifestName:
+		var manifest Manifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			v.report.problem("%s cannot be parsed: %v", ManifestName, err)
+		} else {
+			v.report.Manifest = &manifest
+		}
+	case ChecksumsName:
+		v.parseSums(data)
+	default:
+		if v.index == nil {
+			v.report.problem("%s precedes %s", name, storage.IndexFileName)
+		} else if _, isSegment := v.segments[name]; !isSegment {
+			v.report.problem("%s is not part of the acquisition", name)
+		}
+	}
+	return nil
+}
+
+// parseIndex loads the storage index and plans the chunk checks
+func (v *verifier) parseIndex(data []byte) {
+	var index storage.Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		v.report.problem("%s cannot be parsed: %v", storage.IndexFileName, err)
+		return
+	}
+	v.index = &index
+
+	v.segments = make(map[string]int, index.Segments)
+	for segment := 0; segment < index.Segments; segment++ {
+		v.segments[storage.SegmentName(segment)] = segment
+	}
+
+	v.ordered = true
+	var total int64
+	for i, chunk := range index.Chunks {
+		total += chunk.Length
+		if chunk.Segment < 0 || chunk.Segment >= index.Segments {
+			v.report.problem("chunk %d lies in segment %d of %d", chunk.Index, chunk.Segment, index.Segments)
+			v.ordered = false
+		}
+		if i > 0 {
+			prev := index.Chunks[i-1]
+			if chunk.Segment < prev.Segment || chunk.Segment == prev.Segment && chunk.Offset < prev.Offset+prev.Length {
+				v.ordered = false
+			}
+		}
+	}
+	if total != index.TotalBytes {
+		v.report.problem("index lists %d bytes of chunks but a total of %d", total, index.TotalBytes)
+	}
+	if !v.ordered {
+		v.report.problem("index does not list the chunks in storage order; chunk contents not verified")
+	}
+}
+
+// segment checks the chunks stored in a segment as it is read
+func (v *verifier) segment(segment int, r io.Reader) error {
+	if !v.ordered {
+		return nil
+	}
+	if segment != v.nextSegment {
+		v.report.problem("%s is out of order", storage.SegmentName(segment))
+		v.ordered = false
+		return nil
+	}
+	v.nextSegment++
+
+	var pos int64
+	chunkHash := sha256.New()
+	for _, chunk := range v.index.Chunks {
+		if chunk.Segment != segment {
+			continue
+		}
+		if _, err := io.CopyN(io.Discard, r, chunk.Offset-pos); err != nil {
+			return v.truncated(segment, chunk, err)
+		}
+		chunkHash.Reset()
+		if _, err := io.CopyN(io.MultiWriter(chunkHash, v.overall), r, chunk.Length); err != nil {
+			return v.truncated(segment, chunk, err)
+		}
+		pos = chunk.Offset + chunk.Length
+
+		if hex.EncodeToString(chunkHash.Sum(nil)) != chunk.Checksum {
+			v.report.problem("chunk %d (channel %d) in %s does not match its checksum", chunk.Index, chunk.Channel, storage.SegmentName(segment))
+		} else {
+			v.report.Chunks++
+		}
+	}
+	return nil
+}
+
+// truncated reports a segment that ends before one of its chunks
+func (v *verifier) truncated(segment int, chunk storage.ChunkRecord, err error) error {
+	if !errors.Is(err, io.EOF) {
+		return err
+	}
+	v.report.problem("%s ends before chunk %d", storage.SegmentName(segment), chunk.Index)
+	v.ordered = false
+	return nil
+}
+
+// parseSums loads the checksum list
+func (v *verifier) parseSums(data []byte) {
+	v.sumsFound = true
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		sum, name, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok || len(sum) != sha256.Size*2 {
+			v.report.problem("%s line %d is malformed", ChecksumsName, line)
+			continue
+		}
+		v.sums[name] = sum
+	}
+}
+
+// finish runs the checks that need the whole bundle
+func (v *verifier) finish() {
+	report := v.report
+
+	if v.index == nil {
+		report.problem("bundle has no %s", storage.IndexFileName)
+	}
+	if report.Manifest == nil {
+		report.problem("bundle has no readable %s", ManifestName)
+	}
+	if !v.sumsFound {
+		report.problem("bundle has no %s", ChecksumsName)
+	}
+
+	actual := make(map[string]File, len(report.Files))
+	for _, file := range report.Files {
+		actual[file.Name] = file
+	}
+
+	if v.sumsFound {
+		for _, file := range report.Files {
+			if file.Name == ChecksumsName {
+				continue
+			}
+			switch sum, listed := v.sums[file.Name]; {
+			case !listed:
+				report.problem("%s is not listed in %s", file.Name, ChecksumsName)
+			case sum != file.SHA256:
+				report.problem("%s does not match its checksum", file.Name)
+			}
+		}
+		for name := range v.sums {
+			if _, found := actual[name]; !found {
+				report.problem("%s is listed in %s but missing", name, ChecksumsName)
+			}
+		}
+	}
+
+	if manifest := report.Manifest; manifest != nil {
+		if manifest.FormatVersion != FormatVersion {
+			report.problem("manifest format version %d is not supported", manifest.FormatVersion)
+		}
+		for _, listed := range manifest.Files {
+			switch file, found := actual[listed.Name]; {
+			case !found:
+				report.problem("%s is listed in the manifest but missing", listed.Name)
+			case file.Size != listed.Size || file.SHA256 != listed.SHA256:
+				report.problem("%s does not match the manifest", listed.Name)
+			}
+		}
+		if v.index != nil && manifest.Acquisition != nil && manifest.Acquisition.ID != v.index.AcquisitionID {
+			report.problem("manifest describes acquisition %s but the index %s", manifest.Acquisition.ID, v.index.AcquisitionID)
+		}
+	}
+
+	if index := v.index; index != nil {
+		for segment := 0; segment < index.Segments; segment++ {
+			if _, found := actual[storage.SegmentName(segment)]; !found {
+				report.problem("%s is missing", storage.SegmentName(segment))
+				v.ordered = false
+			}
+		}
+		if v.ordered && index.Checksum != "" && hex.EncodeToString(v.overall.Sum(nil)) != index.Checksum {
+			report.problem("acquisition data does not match the index checksum")
+		}
+	}
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,122 @@
+// Package compression implements the chunk payload codecs an acquisition can
+// negotiate at start. A negotiated codec applies to every chunk payload of the
+// acquisition, whichever transport carries it (data_chunk messages, binary
+// frames or HTTP uploads). Payloads are decompressed before their checksum is
+// verified and before they are stored, so checksums always cover the original
+// samples and stored data is never compressed.
+package compression
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// None means payloads are sent as is
+	None = "none"
+
+	// Zstd is a Zstandard frame (RFC 8878)
+	Zstd = "zstd"
+
+	// Deflate is a zlib stream (RFC 1950), as produced by the browser's
+	// CompressionStream("deflate")
+	Deflate = "deflate"
+
+	// Gzip is a gzip stream (RFC 1952), as produced by CompressionStream("gzip")
+	Gzip = "gzip"
+
+	// MaxChunkSize bounds the decompressed size of a single chunk
+	MaxChunkSize = 16 << 20
+)
+
+var (
+	ErrUnsupportedCodec = errors.New("unsupported compression codec")
+	ErrChunkTooLarge    = errors.New("decompressed chunk exceeds size limit")
+)
+
+// preferred lists the supported codecs in the order the server picks them
+var preferred = []string{Zstd, Deflate, Gzip}
+
+// zstdDecoder is shared; DecodeAll is safe for concurrent use
+var zstdDecoder, _ = zstd.NewReader(nil,
+	zstd.WithDecoderConcurrency(0),
+	zstd.WithDecoderMaxMemory(MaxChunkSize))
+
+// Supported returns the codecs the server accepts, in order of preference
+func Supported() []string {
+	return append([]string(nil), preferred...)
+}
+
+// Negotiate picks the codec for an acquisition. When compression is disabled
+// the result is None. Otherwise the first codec offered by the client that the
+// server supports is used. A client that offers nothing gets None too: it
+// predates codec negotiation and sends its payloads as is.
+func Negotiate(enabled bool, offered []string) (string, error) {
+	if !enabled || len(offered) == 0 {
+		return None, nil
+	}
+
+	for _, codec := range offered {
+		if codec == None {
+			return None, nil
+		}
+		for _, supported := range preferred {
+			if codec == supported {
+				return codec, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("%w: none of %v", ErrUnsupportedCodec, offered)
+}
+
+// Decompress returns the original payload of a chunk compressed with codec
+func Decompress(codec string, data []byte) ([]byte, error) {
+	switch codec {
+	case None, "":
+		return data, nil
+
+	case Zstd:
+		decoded, err := zstdDecoder.DecodeAll(data, nil)
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+			return nil, ErrChunkTooLarge
+		}
+		return decoded, err
+
+	case Deflate:
+		reader, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return readLimited(reader)
+
+	case Gzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return readLimited(reader)
+
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCodec, codec)
+	}
+}
+
+func readLimited(reader io.Reader) ([]byte, error) {
+	decoded, err := io.ReadAll(io.LimitReader(reader, MaxChunkSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) > MaxChunkSize {
+		return nil, ErrChunkTooLarge
+	}
+	return decoded, nil
+}
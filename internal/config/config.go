@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"time"
 )
 
 // Config holds application configuration
@@ -12,8 +13,65 @@ type Config struct {
 	HTTPPort    string
 	Environment string
 	Debug       bool
+
+	// CompressionEnabled lets acquisitions negotiate compressed chunk
+	// payloads; when false every acquisition streams uncompressed
+	CompressionEnabled bool
+
+	// AnonymousDevices lets devices without a serial number register. Each
+	// such registration adds a device record that is never matched again,
+	// so the registry grows with every one; when false they are refused.
+	AnonymousDevices bool
+
+	// SessionStore is the path of the session database, or MemorySessionStore
+	// to keep sessions in memory only
+	SessionStore string
+
+	// StorageBackend selects where acquisition data is kept: "local" or "s3"
+	StorageBackend string
+	S3             S3Config
+
+	// StorageQuota and DeviceStorageQuota limit the bytes of acquisition
+	// data kept overall and per device; 0 means unlimited
+	StorageQuota       int64
+	DeviceStorageQuota int64
+
+	Retention RetentionConfig
+}
+
+// S3Config configures the S3-compatible storage backend
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Prefix          string
+	PathStyle       bool
+	// Capacity is the bytes the bucket may hold, for reporting storage
+	// utilization; 0 if unknown
+	Capacity int64
+}
+
+// RetentionConfig controls how long finished acquisitions are kept
+type RetentionConfig struct {
+	// Days after which a finished acquisition is removed from primary
+	// storage; 0 keeps acquisitions forever. Flagged acquisitions are always
+	// kept.
+	Days int
+	// Action is "delete" or "archive"
+	Action string
+	// ArchivePath is where the local backend archives to, ArchivePrefix the
+	// key prefix the S3 backend archives to
+	ArchivePath   string
+	ArchivePrefix string
+	// Interval is how often retention is enforced
+	Interval time.Duration
 }
 
+// MemorySessionStore disables session persistence
+const MemorySessionStore = ":memory:"
+
 // Load creates a new configuration from environment variables
 func Load() *Config {
 	cfg := &Config{
@@ -22,6 +80,34 @@ func Load() *Config {
 		HTTPPort:    getEnv("HTTP_PORT", "8080"),
 		Environment: getEnv("ENV", "development"),
 		Debug:       getEnvBool("DEBUG", true),
+
+		CompressionEnabled: getEnvBool("COMPRESSION_ENABLED", true),
+		AnonymousDevices:   getEnvBool("ANONYMOUS_DEVICES", false),
+
+		SessionStore: getEnv("SESSION_STORE", "./data/sessions.db"),
+
+		StorageBackend: getEnv("STORAGE_BACKEND", "local"),
+		S3: S3Config{
+			Endpoint:        getEnv("S3_ENDPOINT", "https://s3.amazonaws.com"),
+			Region:          getEnv("S3_REGION", "us-east-1"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			Prefix:          getEnv("S3_PREFIX", "acquisitions"),
+			PathStyle:       getEnvBool("S3_PATH_STYLE", true),
+			Capacity:        getEnvInt64("S3_CAPACITY_BYTES", 0),
+		},
+
+		StorageQuota:       getEnvInt64("STORAGE_QUOTA_BYTES", 0),
+		DeviceStorageQuota: getEnvInt64("DEVICE_STORAGE_QUOTA_BYTES", 0),
+
+		Retention: RetentionConfig{
+			Days:          int(getEnvInt64("RETENTION_DAYS", 0)),
+			Action:        getEnv("RETENTION_ACTION", "delete"),
+			ArchivePath:   getEnv("RETENTION_ARCHIVE_PATH", "./data/archive"),
+			ArchivePrefix: getEnv("RETENTION_ARCHIVE_PREFIX", "archive"),
+			Interval:      getEnvDuration("RETENTION_INTERVAL", time.Hour),
+		},
 	}
 	
 	return cfg
@@ -44,3 +130,24 @@ func getEnvBool(key string, fallback bool) bool {
 	}
 	return fallback
 }
+
+// getEnvInt64 gets an integer environment variable with a fallback value
+func getEnvInt64(key string, fallback int64) int64 {
+	if value := os.Getenv(key); value != "" {
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	}
+	return fallback
+}
+
+// getEnvDuration gets a duration environment variable such as "30m" with a
+// fallback value
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,78 @@
+// Package dicom encodes DICOM Part 10 files in the explicit VR little endian
+// transfer syntax. It covers what the acquisition exports need: text and
+// binary values, sequences with defined lengths, and bulk data streamed from
+// a reader so that large waveforms never have to be held in memory.
+package dicom
+
+import (
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// ExplicitVRLittleEndian is the transfer syntax files are written in
+	ExplicitVRLittleEndian = "1.2.840.10008.1.2.1"
+
+	// ImplementationClassUID identifies this encoder in the file meta
+	// information
+	ImplementationClassUID = "2.25.279908891944488572612564438798449447269"
+	// ImplementationVersionName is written alongside ImplementationClassUID
+	ImplementationVersionName = "ACQUIRE_APP_1"
+)
+
+var ErrValueTooLong = errors.New("dicom: value too long")
+
+// Tag is a DICOM data element tag
+type Tag struct {
+	Group   uint16
+	Element uint16
+}
+
+func (t Tag) less(other Tag) bool {
+	if t.Group != other.Group {
+		return t.Group < other.Group
+	}
+	return t.Element < other.Element
+}
+
+// Element is a data element. Value depends on VR:
+//
+//	AE, AS, CS, DA, DS, DT, IS, LO, LT, PN, SH, ST, TM, UC, UI, UT: string,
+//	    with multiple values separated by a backslash
+//	US: uint16
+//	UL: uint32
+//	OB, OW: []byte or BulkData
+//	SQ: []Dataset, one per item
+type Element struct {
+	Tag   Tag
+	VR    string
+	Value interface{}
+}
+
+// Dataset is a list of data elements. It is written in tag order whatever
+// order the elements are listed in.
+type Dataset []Element
+
+// BulkData is a binary value read from a stream while the file is encoded.
+// Exactly Length bytes are read from Reader.
+type BulkData struct {
+	Reader io.Reader
+	Length int64
+}
+
+// File is a DICOM Part 10 file: preamble, file meta information and dataset
+type File struct {
+	SOPClassUID    string
+	SOPInstanceUID string
+	Dataset        Dataset
+}
+
+// NewUID returns a new globally unique UID under the 2.25 root, which is
+// derived from a random UUID and needs no registered organization root
+func NewUID() string {
+	id := uuid.New()
+	return "2.25." + new(big.Int).SetBytes(id[:]).String()
+}
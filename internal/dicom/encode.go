@@ -0,0 +1,228 @@
+package dicom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// VRs whose explicit VR header has two reserved bytes and a 32-bit length
+var longVRs = map[string]bool{
+	"OB": true, "OD": true, "OF": true, "OL": true, "OV": true, "OW": true,
+	"SQ": true, "SV": true, "UC": true, "UN": true, "UR": true, "UT": true, "UV": true,
+}
+
+// maxValueLength is the longest single value of the length-limited text VRs.
+// Longer values are truncated.
+var maxValueLength = map[string]int{
+	"AE": 16, "CS": 16, "LO": 64, "LT": 10240, "PN": 64, "SH": 16, "ST": 1024,
+}
+
+var itemTag = Tag{0xFFFE, 0xE000}
+
+// Encode returns the file as a stream and its size. Bulk data is read as the
+// stream is consumed.
+func (f *File) Encode() (io.Reader, int64, error) {
+	meta := Dataset{
+		{Tag{0x0002, 0x0001}, "OB", []byte{0x00, 0x01}},
+		{Tag{0x0002, 0x0002}, "UI", f.SOPClassUID},
+		{Tag{0x0002, 0x0003}, "UI", f.SOPInstanceUID},
+		{Tag{0x0002, 0x0010}, "UI", ExplicitVRLittleEndian},
+		{Tag{0x0002, 0x0012}, "UI", ImplementationClassUID},
+		{Tag{0x0002, 0x0013}, "SH", ImplementationVersionName},
+	}
+	metaLength, err := meta.length()
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := f.Dataset.length(); err != nil {
+		return nil, 0, err
+	}
+
+	e := &encoder{}
+	e.buf.Write(make([]byte, 128))
+	e.buf.WriteString("DICM")
+	e.element(Element{Tag{0x0002, 0x0000}, "UL", uint32(metaLength)})
+	e.dataset(meta)
+	e.dataset(f.Dataset)
+	e.flush()
+
+	return io.MultiReader(e.parts...), e.size, nil
+}
+
+// encoder collects the encoded file as buffered parts and bulk data readers
+type encoder struct {
+	buf   bytes.Buffer
+	parts []io.Reader
+	size  int64
+}
+
+func (e *encoder) flush() {
+	if e.buf.Len() > 0 {
+		e.size += int64(e.buf.Len())
+		e.parts = append(e.parts, bytes.NewReader(append([]byte(nil), e.buf.Bytes()...)))
+		e.buf.Reset()
+	}
+}
+
+func (e *encoder) le(v interface{}) {
+	binary.Write(&e.buf, binary.LittleEndian, v)
+}
+
+func (e *encoder) dataset(ds Dataset) {
+	for _, el := range ds.sorted() {
+		e.element(el)
+	}
+}
+
+// element writes an element whose length was validated by Dataset.length
+func (e *encoder) element(el Element) {
+	length, _ := el.valueLength()
+
+	e.le(el.Tag.Group)
+	e.le(el.Tag.Element)
+	e.buf.WriteString(el.VR)
+	if longVRs[el.VR] {
+		e.le(uint16(0))
+		e.le(uint32(length))
+	} else {
+		e.le(uint16(length))
+	}
+
+	switch value := el.Value.(type) {
+	case string:
+		e.buf.WriteString(padText(el.VR, value))
+	case uint16, uint32:
+		e.le(value)
+	case []byte:
+		e.buf.Write(value)
+		if len(value)%2 != 0 {
+			e.buf.WriteByte(0)
+		}
+	case BulkData:
+		e.flush()
+		e.parts = append(e.parts, &exactReader{r: value.Reader, n: value.Length})
+		e.size += value.Length
+		if value.Length%2 != 0 {
+			e.buf.WriteByte(0)
+		}
+	case []Dataset:
+		for _, item := range value {
+			itemLength, _ := item.length()
+			e.le(itemTag.Group)
+			e.le(itemTag.Element)
+			e.le(uint32(itemLength))
+			e.dataset(item)
+		}
+	}
+}
+
+// length returns the encoded length of the dataset, checking that every value
+// fits its length field
+func (ds Dataset) length() (int64, error) {
+	var total int64
+	for _, el := range ds {
+		length, err := el.valueLength()
+		if err != nil {
+			return 0, err
+		}
+		limit := int64(math.MaxUint16)
+		header := int64(8)
+		if longVRs[el.VR] {
+			limit = math.MaxUint32 - 1
+			header = 12
+		}
+		if length > limit {
+			return 0, fmt.Errorf("%w: %04X,%04X is %d bytes", ErrValueTooLong, el.Tag.Group, el.Tag.Element, length)
+		}
+		total += header + length
+	}
+	return total, nil
+}
+
+func (ds Dataset) sorted() Dataset {
+	sorted := append(Dataset(nil), ds...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Tag.less(sorted[j].Tag) })
+	return sorted
+}
+
+// valueLength returns the padded length of an element's value
+func (el Element) valueLength() (int64, error) {
+	switch value := el.Value.(type) {
+	case string:
+		return int64(len(padText(el.VR, value))), nil
+	case uint16:
+		return 2, nil
+	case uint32:
+		return 4, nil
+	case []byte:
+		return int64(len(value) + len(value)%2), nil
+	case BulkData:
+		return value.Length + value.Length%2, nil
+	case []Dataset:
+		var total int64
+		for _, item := range value {
+			length, err := item.length()
+			if err != nil {
+				return 0, err
+			}
+			if length > math.MaxUint32-1 {
+				return 0, fmt.Errorf("%w: item of %04X,%04X is %d bytes", ErrValueTooLong, el.Tag.Group, el.Tag.Element, length)
+			}
+			total += 8 + length
+		}
+		return total, nil
+	case nil:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("dicom: unsupported value %T for %04X,%04X", value, el.Tag.Group, el.Tag.Element)
+	}
+}
+
+// padText truncates each value of a text element to what its VR allows and
+// pads the result to an even length, UIDs with a NUL and text with a space
+func padText(vr, s string) string {
+	if limit, ok := maxValueLength[vr]; ok {
+		values := strings.Split(s, `\`)
+		for i, value := range values {
+			if len(value) > limit {
+				values[i] = value[:limit]
+			}
+		}
+		s = strings.Join(values, `\`)
+	}
+	if len(s)%2 != 0 {
+		if vr == "UI" {
+			return s + "\x00"
+		}
+		return s + " "
+	}
+	return s
+}
+
+// exactReader reads exactly n bytes, failing if the source ends early
+type exactReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *exactReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.n {
+		p = p[:r.n]
+	}
+	n, err := r.r.Read(p)
+	r.n -= int64(n)
+	if err == io.EOF && r.n > 0 {
+		err = io.ErrUnexpectedEOF
+	} else if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
@@ -0,0 +1,220 @@
+package dicom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// parsed is a data element read back from an encoded file
+type parsed struct {
+	Tag   Tag
+	VR    string
+	Value []byte
+	Items [][]parsed
+}
+
+// parseElements reads explicit VR little endian data elements until b ends
+func parseElements(t *testing.T, b []byte) []parsed {
+	t.Helper()
+
+	var elements []parsed
+	for len(b) > 0 {
+		if len(b) < 8 {
+			t.Fatalf("truncated element header % X", b)
+		}
+		el := parsed{
+			Tag: Tag{binary.LittleEndian.Uint16(b), binary.LittleEndian.Uint16(b[2:])},
+			VR:  string(b[4:6]),
+		}
+		length, header := int(binary.LittleEndian.Uint16(b[6:])), 8
+		if longVRs[el.VR] {
+			if b[6] != 0 || b[7] != 0 {
+				t.Fatalf("%04X,%04X: reserved bytes % X are not zero", el.Tag.Group, el.Tag.Element, b[6:8])
+			}
+			length, header = int(binary.LittleEndian.Uint32(b[8:])), 12
+		}
+		if length%2 != 0 || header+length > len(b) {
+			t.Fatalf("%04X,%04X: bad value length %d", el.Tag.Group, el.Tag.Element, length)
+		}
+		el.Value = b[header : header+length]
+		b = b[header+length:]
+
+		if el.VR == "SQ" {
+			items := el.Value
+			for len(items) > 0 {
+				if item := (Tag{binary.LittleEndian.Uint16(items), binary.LittleEndian.Uint16(items[2:])}); item != itemTag {
+					t.Fatalf("sequence item starts with %04X,%04X", item.Group, item.Element)
+				}
+				itemLength := int(binary.LittleEndian.Uint32(items[4:]))
+				el.Items = append(el.Items, parseElements(t, items[8:8+itemLength]))
+				items = items[8+itemLength:]
+			}
+		}
+		elements = append(elements, el)
+	}
+	return elements
+}
+
+// encode encodes a file and splits it at the end of the file meta information
+func encode(t *testing.T, f *File) (meta, dataset []parsed) {
+	t.Helper()
+
+	r, size, err := f.Encode()
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading encoded file: %v", err)
+	}
+	if int64(len(b)) != size {
+		t.Fatalf("encoded %d bytes, Encode reported %d", len(b), size)
+	}
+
+	if !bytes.Equal(b[:128], make([]byte, 128)) || string(b[128:132]) != "DICM" {
+		t.Fatalf("file does not start with a zero preamble and DICM: % X", b[:132])
+	}
+	groupLength := parseElements(t, b[132:144])[0]
+	if groupLength.Tag != (Tag{0x0002, 0x0000}) || groupLength.VR != "UL" {
+		t.Fatalf("first element is %+v, want the group length", groupLength)
+	}
+	end := 144 + int(binary.LittleEndian.Uint32(groupLength.Value))
+	return parseElements(t, b[144:end]), parseElements(t, b[end:])
+}
+
+func TestEncodeFileMeta(t *testing.T) {
+	meta, dataset := encode(t, &File{
+		SOPClassUID:    "1.2.840.10008.5.1.4.1.1.9.1.1",
+		SOPInstanceUID: "2.25.1234",
+	})
+
+	want := []struct {
+		tag   Tag
+		vr    string
+		value string
+	}{
+		{Tag{0x0002, 0x0001}, "OB", "\x00\x01"},
+		{Tag{0x0002, 0x0002}, "UI", "1.2.840.10008.5.1.4.1.1.9.1.1\x00"},
+		{Tag{0x0002, 0x0003}, "UI", "2.25.1234\x00"},
+		{Tag{0x0002, 0x0010}, "UI", "1.2.840.10008.1.2.1\x00"},
+		{Tag{0x0002, 0x0012}, "UI", ImplementationClassUID},
+		{Tag{0x0002, 0x0013}, "SH", ImplementationVersionName + " "},
+	}
+	if len(meta) != len(want) {
+		t.Fatalf("file meta has %d elements, want %d", len(meta), len(want))
+	}
+	for i, el := range meta {
+		if el.Tag != want[i].tag || el.VR != want[i].vr || string(el.Value) != want[i].value {
+			t.Errorf("meta element %d = %04X,%04X %s %q, want %04X,%04X %s %q", i,
+				el.Tag.Group, el.Tag.Element, el.VR, el.Value,
+				want[i].tag.Group, want[i].tag.Element, want[i].vr, want[i].value)
+		}
+	}
+	if len(dataset) != 0 {
+		t.Errorf("empty dataset encoded %d elements", len(dataset))
+	}
+}
+
+func TestEncodeDataset(t *testing.T) {
+	waveform := bytes.Repeat([]byte{0xAB}, 1001)
+	_, dataset := encode(t, &File{
+		SOPClassUID:    "1.2",
+		SOPInstanceUID: "1.3",
+		Dataset: Dataset{
+			// Listed out of order on purpose
+			{Tag{0x5400, 0x0100}, "SQ", []Dataset{
+				{
+					{Tag{0x5400, 0x1010}, "OW", BulkData{Reader: bytes.NewReader(waveform), Length: int64(len(waveform))}},
+					{Tag{0x003A, 0x0005}, "US", uint16(2)},
+				},
+				{{Tag{0x003A, 0x0010}, "UL", uint32(70000)}},
+			}},
+			{Tag{0x0010, 0x0010}, "PN", "Doe^Jane"},
+			{Tag{0x0008, 0x0060}, "CS", "ECG"},
+			{Tag{0x0008, 0x0016}, "UI", "1.2"},
+			{Tag{0x0018, 0x1030}, "LO", strings.Repeat("p", 70)},
+			{Tag{0x0008, 0x0008}, "CS", `ORIGINAL\PRIMARY_AND_A_VERY_LONG_VALUE`},
+			{Tag{0x0020, 0x4000}, "LT", nil},
+		},
+	})
+
+	want := []struct {
+		tag   Tag
+		vr    string
+		value string
+	}{
+		{Tag{0x0008, 0x0008}, "CS", `ORIGINAL\PRIMARY_AND_A_VE `},
+		{Tag{0x0008, 0x0016}, "UI", "1.2\x00"},
+		{Tag{0x0008, 0x0060}, "CS", "ECG "},
+		{Tag{0x0010, 0x0010}, "PN", "Doe^Jane"},
+		{Tag{0x0018, 0x1030}, "LO", strings.Repeat("p", 64)},
+		{Tag{0x0020, 0x4000}, "LT", ""},
+		{Tag{0x5400, 0x0100}, "SQ", ""},
+	}
+	if len(dataset) != len(want) {
+		t.Fatalf("dataset has %d elements, want %d", len(dataset), len(want))
+	}
+	for i, el := range dataset {
+		if el.Tag != want[i].tag || el.VR != want[i].vr || (el.VR != "SQ" && string(el.Value) != want[i].value) {
+			t.Errorf("element %d = %04X,%04X %s %q, want %04X,%04X %s %q", i,
+				el.Tag.Group, el.Tag.Element, el.VR, el.Value,
+				want[i].tag.Group, want[i].tag.Element, want[i].vr, want[i].value)
+		}
+	}
+
+	items := dataset[len(dataset)-1].Items
+	if len(items) != 2 || len(items[0]) != 2 || len(items[1]) != 1 {
+		t.Fatalf("sequence items %+v", items)
+	}
+	if channels := items[0][0]; channels.VR != "US" || binary.LittleEndian.Uint16(channels.Value) != 2 {
+		t.Errorf("first item starts with %+v, want the US channel count", channels)
+	}
+	if data := items[0][1].Value; len(data) != 1002 || !bytes.Equal(data[:1001], waveform) || data[1001] != 0 {
+		t.Errorf("bulk data of %d bytes is not the waveform padded to even length", len(data))
+	}
+	if samples := items[1][0]; binary.LittleEndian.Uint32(samples.Value) != 70000 {
+		t.Errorf("second item holds %+v", samples)
+	}
+}
+
+func TestEncodeValueTooLong(t *testing.T) {
+	f := &File{
+		SOPClassUID:    "1.2",
+		SOPInstanceUID: "1.3",
+		Dataset:        Dataset{{Tag{0x0018, 0x1030}, "DS", strings.Repeat("1", 70000)}},
+	}
+	if _, _, err := f.Encode(); !errors.Is(err, ErrValueTooLong) {
+		t.Errorf("got %v, want ErrValueTooLong", err)
+	}
+}
+
+func TestEncodeShortBulkData(t *testing.T) {
+	f := &File{
+		SOPClassUID:    "1.2",
+		SOPInstanceUID: "1.3",
+		Dataset: Dataset{
+			{Tag{0x5400, 0x1010}, "OW", BulkData{Reader: strings.NewReader("abc"), Length: 10}},
+		},
+	}
+	r, _, err := f.Encode()
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if _, err := io.ReadAll(r); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("reading a file with short bulk data: got %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestNewUID(t *testing.T) {
+	uid := NewUID()
+	if !strings.HasPrefix(uid, "2.25.") || len(uid) > 64 || strings.Trim(uid[5:], "0123456789") != "" {
+		t.Errorf("NewUID() = %q, want a 2.25 UID of at most 64 characters", uid)
+	}
+	if uid == NewUID() {
+		t.Error("NewUID returned the same UID twice")
+	}
+}
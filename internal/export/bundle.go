@@ -0,0 +1,63 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"acquire-app/internal/bundle"
+	"acquire-app/internal/models"
+)
+
+// Bundle exports the stored files of the acquisition unchanged, the index
+// and the data segments, as a tar archive together with a manifest of the
+// acquisition, its device, statistics, sample format and history, and a
+// SHA-256 checksum of every file (see package bundle). The archive is
+// streamed as the files are read; its size is not known in advance.
+func Bundle(src *Source) (io.Reader, int64, error) {
+	if src.Open == nil {
+		return nil, 0, fmt.Errorf("%w: stored files cannot be opened", ErrInvalidSettings)
+	}
+
+	// The manifest is taken now, before the history gains this export
+	acquisition := *src.Acquisition
+	acquisition.History = append([]models.AcquisitionEvent(nil), acquisition.History...)
+	acquisition.ResumeToken = ""
+	manifest := &bundle.Manifest{
+		FormatVersion: bundle.FormatVersion,
+		CreatedAt:     time.Now().UTC(),
+		Acquisition:   &acquisition,
+		Metadata:      acquisition.Metadata,
+		DeviceInfo:    src.device(),
+		FinalStats:    acquisition.Statistics,
+		Settings:      src.Settings,
+		History:       acquisition.History,
+	}
+	if src.Session != nil {
+		capabilities := src.Session.Capabilities
+		manifest.Capabilities = &capabilities
+	}
+
+	// The index goes first so that a verifier can check the segments' chunks
+	// as they stream past
+	files := src.Index.Files()
+	files = append([]string{files[len(files)-1]}, files[:len(files)-1]...)
+
+	stream := newPipeStream(func(w io.Writer) error {
+		writer := bundle.NewWriter(w, src.Acquisition.ID, manifest.CreatedAt)
+		for _, name := range files {
+			object, err := src.Open(name)
+			if err != nil {
+				return fmt.Errorf("open %s: %w", name, err)
+			}
+			err = writer.WriteFile(name, object.Size(), io.NewSectionReader(object, 0, object.Size()))
+			object.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return writer.Finish(manifest)
+	})
+
+	return stream, -1, nil
+}
@@ -0,0 +1,234 @@
+package export
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"acquire-app/internal/dicom"
+	"acquire-app/internal/models"
+)
+
+// dicomWaveform is a waveform IOD together with how its channels are coded
+type dicomWaveform struct {
+	sopClassUID string
+	modality    string
+	groupLabel  string
+	// Channel source code: value, coding scheme and meaning
+	source [3]string
+}
+
+var (
+	dicomGeneralECG = dicomWaveform{
+		sopClassUID: "1.2.840.10008.5.1.4.1.1.9.1.2",
+		modality:    "ECG",
+		groupLabel:  "ECG",
+		source:      [3]string{"2:0", "MDC", "Unspecified lead"},
+	}
+	dicomBasicVoiceAudio = dicomWaveform{
+		sopClassUID: "1.2.840.10008.5.1.4.1.1.9.4.1",
+		modality:    "AU",
+		groupLabel:  "VOICE",
+		source:      [3]string{"109110", "DCM", "Voice"},
+	}
+	dicomGeneralAudio = dicomWaveform{
+		sopClassUID: "1.2.840.10008.5.1.4.1.1.9.4.2",
+		modality:    "AU",
+		groupLabel:  "AUDIO",
+		source:      [3]string{"109115", "DCM", "Physiological audio signal"},
+	}
+)
+
+// DICOM exports the stored samples as a DICOM waveform object in a Part 10
+// file. ECG devices produce a General ECG object; everything else is audio,
+// stored as Basic Voice Audio when the recording fits that IOD (one channel
+// at 8 kHz) and as General Audio Waveform otherwise. Patient, procedure and
+// operator come from the acquisition metadata, manufacturer, model and serial
+// number from the device, and the UIDs are the acquisition's own, so
+// repeated exports describe the same instance. The samples are contiguous;
+// pauses are waveform annotations at the sample where the data resumes,
+// giving their length.
+func DICOM(src *Source) (io.Reader, int64, error) {
+	settings := src.Settings
+	containerBits, blockAlign, err := sampleLayout(settings)
+	if err != nil {
+		return nil, 0, err
+	}
+	acquisition := src.Acquisition
+	if acquisition.DICOMUIDs == nil {
+		return nil, 0, fmt.Errorf("acquisition %s has no DICOM UIDs", acquisition.ID)
+	}
+
+	device := src.device()
+	waveform, err := dicomWaveformFor(device, settings)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	frames := src.Data.Size() / blockAlign
+	if frames > math.MaxUint32 {
+		return nil, 0, fmt.Errorf("%w: %d samples per channel", ErrTooLarge, frames)
+	}
+
+	// Audio keeps unsigned 8-bit samples; everything else is 16-bit signed
+	bitsAllocated, interpretation, dataVR := 16, "SS", "OW"
+	if containerBits == 8 && waveform.modality == "AU" {
+		bitsAllocated, interpretation, dataVR = 8, "UB", "OB"
+	}
+	// Stored samples are left-aligned, so every bit of the container counts
+	bitsStored := containerBits
+	if bitsStored > bitsAllocated {
+		bitsStored = bitsAllocated
+	}
+
+	if _, err := src.Data.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	data := io.Reader(io.LimitReader(src.Data, frames*blockAlign))
+	if containerBits != bitsAllocated {
+		data = newPCM16Reader(data, containerBits/8)
+	}
+	dataLength := frames * int64(settings.Channels) * int64(bitsAllocated/8)
+
+	channels := make([]dicom.Dataset, settings.Channels)
+	for i := range channels {
+		channels[i] = dicom.Dataset{
+			dicomText(0x003A, 0x0203, "SH", fmt.Sprintf("Channel %d", i+1)),
+			{Tag: dicom.Tag{Group: 0x003A, Element: 0x0208}, VR: "SQ", Value: []dicom.Dataset{{
+				dicomText(0x0008, 0x0100, "SH", waveform.source[0]),
+				dicomText(0x0008, 0x0102, "SH", waveform.source[1]),
+				dicomText(0x0008, 0x0104, "LO", waveform.source[2]),
+			}}},
+			{Tag: dicom.Tag{Group: 0x003A, Element: 0x021A}, VR: "US", Value: uint16(bitsStored)},
+		}
+	}
+
+	start := acquisition.StartTime
+	uids := acquisition.DICOMUIDs
+	dataset := dicom.Dataset{
+		// SOP common
+		dicomText(0x0008, 0x0005, "CS", "ISO_IR 192"),
+		dicomText(0x0008, 0x0016, "UI", waveform.sopClassUID),
+		dicomText(0x0008, 0x0018, "UI", uids.SOPInstanceUID),
+		dicomText(0x0008, 0x0201, "SH", start.Format("-0700")),
+
+		// Patient
+		dicomText(0x0010, 0x0010, "PN", ""),
+		dicomText(0x0010, 0x0020, "LO", acquisition.Metadata.PatientID),
+		dicomText(0x0010, 0x0030, "DA", ""),
+		dicomText(0x0010, 0x0040, "CS", ""),
+
+		// General study
+		dicomText(0x0020, 0x000D, "UI", uids.StudyInstanceUID),
+		dicomText(0x0008, 0x0020, "DA", start.Format("20060102")),
+		dicomText(0x0008, 0x0030, "TM", start.Format("150405.000000")),
+		dicomText(0x0008, 0x0050, "SH", ""),
+		dicomText(0x0008, 0x0090, "PN", ""),
+		dicomText(0x0020, 0x0010, "SH", acquisition.ID),
+		dicomText(0x0008, 0x1030, "LO", acquisition.Metadata.ProcedureType),
+
+		// General series
+		dicomText(0x0008, 0x0060, "CS", waveform.modality),
+		dicomText(0x0020, 0x000E, "UI", uids.SeriesInstanceUID),
+		dicomText(0x0020, 0x0011, "IS", "1"),
+		dicomText(0x0008, 0x1070, "PN", acquisition.Metadata.Operator),
+
+		// General equipment
+		dicomText(0x0008, 0x0070, "LO", device.ManufacturerName),
+		dicomText(0x0008, 0x1090, "LO", device.ProductName),
+		dicomText(0x0018, 0x1000, "LO", device.SerialNumber),
+
+		// Waveform identification
+		dicomText(0x0020, 0x0013, "IS", "1"),
+		dicomText(0x0008, 0x0023, "DA", start.Format("20060102")),
+		dicomText(0x0008, 0x0033, "TM", start.Format("150405.000000")),
+		dicomText(0x0008, 0x002A, "DT", start.Format("20060102150405.000000-0700")),
+
+		// Acquisition context, left empty
+		{Tag: dicom.Tag{Group: 0x0040, Element: 0x0555}, VR: "SQ", Value: []dicom.Dataset{}},
+
+		// Waveform: a single multiplex group holding every channel
+		{Tag: dicom.Tag{Group: 0x5400, Element: 0x0100}, VR: "SQ", Value: []dicom.Dataset{{
+			dicomText(0x003A, 0x0004, "CS", "ORIGINAL"),
+			{Tag: dicom.Tag{Group: 0x003A, Element: 0x0005}, VR: "US", Value: uint16(settings.Channels)},
+			{Tag: dicom.Tag{Group: 0x003A, Element: 0x0010}, VR: "UL", Value: uint32(frames)},
+			dicomText(0x003A, 0x001A, "DS", strconv.Itoa(settings.SampleRate)),
+			dicomText(0x003A, 0x0020, "SH", waveform.groupLabel),
+			{Tag: dicom.Tag{Group: 0x003A, Element: 0x0200}, VR: "SQ", Value: channels},
+			{Tag: dicom.Tag{Group: 0x5400, Element: 0x1004}, VR: "US", Value: uint16(bitsAllocated)},
+			dicomText(0x5400, 0x1006, "CS", interpretation),
+			{Tag: dicom.Tag{Group: 0x5400, Element: 0x1010}, VR: dataVR, Value: dicom.BulkData{Reader: data, Length: dataLength}},
+		}}},
+	}
+
+	if annotations := dicomPauseAnnotations(timelineGaps(src.Index), blockAlign, frames); len(annotations) > 0 {
+		dataset = append(dataset, dicom.Element{Tag: dicom.Tag{Group: 0x0040, Element: 0xB020}, VR: "SQ", Value: annotations})
+	}
+
+	file := &dicom.File{
+		SOPClassUID:    waveform.sopClassUID,
+		SOPInstanceUID: uids.SOPInstanceUID,
+		Dataset:        dataset,
+	}
+	body, size, err := file.Encode()
+	if errors.Is(err, dicom.ErrValueTooLong) {
+		return nil, 0, fmt.Errorf("%w: %v", ErrTooLarge, err)
+	}
+	return body, size, err
+}
+
+// dicomWaveformFor picks the waveform IOD for a device and checks that the
+// recording fits its constraints
+func dicomWaveformFor(device models.DeviceInfo, settings models.AcquisitionSettings) (dicomWaveform, error) {
+	switch {
+	case strings.EqualFold(device.DeviceType, "ecg"):
+		if settings.Channels > 24 || settings.SampleRate < 200 || settings.SampleRate > 1000 {
+			return dicomWaveform{}, fmt.Errorf("%w: General ECG takes 1-24 channels at 200-1000 Hz, not %d channels at %d Hz",
+				ErrInvalidSettings, settings.Channels, settings.SampleRate)
+		}
+		return dicomGeneralECG, nil
+	case settings.Channels == 1 && settings.SampleRate == 8000:
+		return dicomBasicVoiceAudio, nil
+	case settings.Channels > 2:
+		return dicomWaveform{}, fmt.Errorf("%w: General Audio Waveform takes 1 or 2 channels, not %d",
+			ErrInvalidSettings, settings.Channels)
+	default:
+		return dicomGeneralAudio, nil
+	}
+}
+
+// dicomPauseAnnotations returns an item of the Waveform Annotation Sequence
+// for each gap in the timeline, marking the sample the data resumes at on
+// all channels of the multiplex group
+func dicomPauseAnnotations(gaps []timelineGap, blockAlign, frames int64) []dicom.Dataset {
+	// Multiplex group 1, channel 0 for all of its channels
+	allChannels := binary.LittleEndian.AppendUint16(binary.LittleEndian.AppendUint16(nil, 1), 0)
+
+	var annotations []dicom.Dataset
+	for _, gap := range gaps {
+		// Sample positions count from 1; a pause at the very end points at
+		// the last sample
+		position := gap.offset/blockAlign + 1
+		if position > frames {
+			position = frames
+		}
+		if position < 1 {
+			continue
+		}
+		annotations = append(annotations, dicom.Dataset{
+			{Tag: dicom.Tag{Group: 0x0040, Element: 0xA0B0}, VR: "US", Value: allChannels},
+			dicomText(0x0040, 0xA130, "CS", "POINT"),
+			{Tag: dicom.Tag{Group: 0x0040, Element: 0xA132}, VR: "UL", Value: uint32(position)},
+			dicomText(0x0070, 0x0006, "ST", pauseNote(gap)),
+		})
+	}
+	return annotations
+}
+
+func dicomText(group, element uint16, vr, value string) dicom.Element {
+	return dicom.Element{Tag: dicom.Tag{Group: group, Element: element}, VR: vr, Value: value}
+}
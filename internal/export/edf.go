@@ -0,0 +1,204 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"acquire-app/pkg/edf"
+)
+
+// Data record durations to try, longest first
+var edfRecordDurations = []time.Duration{
+	time.Second, 500 * time.Millisecond, 200 * time.Millisecond, 100 * time.Millisecond,
+	50 * time.Millisecond, 20 * time.Millisecond, 10 * time.Millisecond,
+	5 * time.Millisecond, 2 * time.Millisecond, time.Millisecond,
+}
+
+// EDF exports the stored samples as an EDF+C file with one signal per
+// channel. 8- and 16-bit samples are stored as they are; wider samples keep
+// their 16 most significant bits, as EDF samples are 16-bit. The header is
+// filled from the acquisition metadata, and annotations mark the procedure,
+// the gaps left by missing chunks, the pauses and how the recording ended.
+// The data records are contiguous, so onsets count recorded time only: a
+// pause is an annotation where the data resumes, giving its length. The last
+// data record is padded with zeros.
+func EDF(src *Source) (io.Reader, int64, error) {
+	settings := src.Settings
+	containerBits, blockAlign, err := sampleLayout(settings)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	samplesPerRecord, recordDuration := edfRecordLength(settings.SampleRate, settings.Channels)
+	frames := src.Data.Size() / blockAlign
+	records := (frames + int64(samplesPerRecord) - 1) / int64(samplesPerRecord)
+
+	digitalMin, digitalMax := -32768, 32767
+	if containerBits == 8 {
+		digitalMin, digitalMax = -128, 127
+	}
+	signals := make([]edf.Signal, settings.Channels)
+	for i := range signals {
+		signals[i] = edf.Signal{
+			Label:            fmt.Sprintf("Channel %d", i+1),
+			TransducerType:   edfEquipment(src),
+			PhysicalMin:      float64(digitalMin),
+			PhysicalMax:      float64(digitalMax),
+			DigitalMin:       digitalMin,
+			DigitalMax:       digitalMax,
+			SamplesPerRecord: samplesPerRecord,
+		}
+	}
+
+	acquisition := src.Acquisition
+	var additional []string
+	if acquisition.Metadata.ProcedureType != "" {
+		additional = append(additional, acquisition.Metadata.ProcedureType)
+	}
+	header := edf.Header{
+		Patient: edf.Patient{Code: acquisition.Metadata.PatientID},
+		Recording: edf.Recording{
+			Start:      acquisition.StartTime,
+			AdminCode:  acquisition.ID,
+			Technician: acquisition.Metadata.Operator,
+			Equipment:  edfEquipment(src),
+			Additional: additional,
+		},
+		RecordDuration: recordDuration,
+		Records:        int(records),
+		Signals:        signals,
+		Annotations:    edfAnnotations(src, blockAlign, frames),
+	}
+
+	writer, err := edf.NewWriter(io.Discard, header)
+	if err != nil {
+		return nil, 0, err
+	}
+	size := writer.Size()
+
+	if _, err := src.Data.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+
+	stream := newPipeStream(func(w io.Writer) error {
+		writer, err := edf.NewWriter(w, header)
+		if err != nil {
+			return err
+		}
+
+		raw := make([]byte, int64(samplesPerRecord)*blockAlign)
+		samples := make([][]int16, settings.Channels)
+		for i := range samples {
+			samples[i] = make([]int16, samplesPerRecord)
+		}
+
+		for record := 0; record < header.Records; record++ {
+			n, err := io.ReadFull(src.Data, raw)
+			if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return err
+			}
+			clear(raw[n:])
+
+			decodeEDFRecord(raw, samples, containerBits/8)
+			if err := writer.WriteRecord(samples); err != nil {
+				return err
+			}
+		}
+		return writer.Close()
+	})
+
+	return stream, size, nil
+}
+
+// edfRecordLength picks the longest data record that holds a whole number of
+// samples and stays within the recommended record size
+func edfRecordLength(sampleRate, channels int) (int, time.Duration) {
+	samples, duration := sampleRate, time.Second
+	for _, d := range edfRecordDurations {
+		if int64(sampleRate)*int64(d)%int64(time.Second) != 0 {
+			continue
+		}
+		samples, duration = int(int64(sampleRate)*int64(d)/int64(time.Second)), d
+		if 2*samples*channels <= edf.MaxRecordSize {
+			break
+		}
+	}
+	return samples, duration
+}
+
+// decodeEDFRecord splits interleaved sample frames into per-channel EDF
+// samples
+func decodeEDFRecord(raw []byte, samples [][]int16, sampleBytes int) {
+	channels := len(samples)
+	for frame := range samples[0] {
+		for channel := range samples {
+			offset := (frame*channels + channel) * sampleBytes
+			samples[channel][frame] = sample16(raw[offset : offset+sampleBytes])
+		}
+	}
+}
+
+// edfEquipment names the recording device
+func edfEquipment(src *Source) string {
+	if name := src.device().ProductName; name != "" {
+		return name
+	}
+	return src.Acquisition.DeviceID
+}
+
+// edfAnnotations lists the procedure at the start, a note wherever data
+// resumes after missing chunks or a pause and how the recording ended
+func edfAnnotations(src *Source, blockAlign, frames int64) []edf.Annotation {
+	acquisition := src.Acquisition
+	rate := float64(src.Settings.SampleRate)
+	at := func(offset int64) time.Duration {
+		return time.Duration(float64(offset/blockAlign) / rate * float64(time.Second))
+	}
+	missing := func(first, last int64) string {
+		if first == last {
+			return fmt.Sprintf("Missing chunk %d", first)
+		}
+		return fmt.Sprintf("Missing chunks %d-%d", first, last)
+	}
+
+	var annotations []edf.Annotation
+	if acquisition.Metadata.ProcedureType != "" {
+		annotations = append(annotations, edf.Annotation{Text: "Procedure " + acquisition.Metadata.ProcedureType})
+	}
+
+	var offset int64
+	next := int64(0)
+	if src.Index != nil {
+		for _, chunk := range src.Index.Chunks {
+			if chunk.Index > next {
+				annotations = append(annotations, edf.Annotation{Onset: at(offset), Text: missing(next, chunk.Index-1)})
+			}
+			offset += chunk.Length
+			next = chunk.Index + 1
+		}
+	}
+
+	for _, gap := range timelineGaps(src.Index) {
+		annotations = append(annotations, edf.Annotation{Onset: at(gap.offset), Text: pauseNote(gap)})
+	}
+
+	end := time.Duration(float64(frames) / rate * float64(time.Second))
+	for _, chunks := range acquisition.Statistics.MissingChunks {
+		if chunks.End >= next {
+			first := chunks.Start
+			if first < next {
+				first = next
+			}
+			annotations = append(annotations, edf.Annotation{Onset: end, Text: missing(first, chunks.End)})
+		}
+	}
+
+	if acquisition.Statistics.Complete {
+		annotations = append(annotations, edf.Annotation{Onset: end, Text: "Recording end"})
+	} else {
+		annotations = append(annotations, edf.Annotation{Onset: end, Text: "Recording interrupted"})
+	}
+	return annotations
+}
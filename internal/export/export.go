@@ -0,0 +1,204 @@
+// Package export converts stored acquisition data into file formats that
+// other tools can open directly.
+package export
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"acquire-app/internal/models"
+	"acquire-app/internal/storage"
+)
+
+var (
+	ErrInvalidSettings = errors.New("acquisition settings cannot be exported")
+	ErrTooLarge        = errors.New("acquisition too large for the export format")
+)
+
+// Source is a finished acquisition to export. Data is the stored stream in
+// chunk order: interleaved PCM sample frames as described by Settings, laid
+// out as in a WAV file (8-bit samples unsigned, wider ones signed
+// little-endian, left-aligned in whole bytes).
+type Source struct {
+	Acquisition *models.Acquisition
+	// Session is the session the acquisition was recorded in, or nil if it
+	// no longer exists
+	Session  *models.Session
+	Settings models.AcquisitionSettings
+	Data     *storage.Reader
+	Index    *storage.Index
+	// Open opens one of the stored files of the acquisition, as listed by
+	// Index.Files
+	Open func(name string) (storage.Object, error)
+}
+
+// device describes the recording device, from the acquisition or, for
+// acquisitions that predate keeping it there, from its session
+func (src *Source) device() models.DeviceInfo {
+	if src.Acquisition.DeviceInfo == (models.DeviceInfo{}) && src.Session != nil {
+		return src.Session.DeviceInfo
+	}
+	return src.Acquisition.DeviceInfo
+}
+
+// Format is an export file format
+type Format struct {
+	ContentType string
+	Extension   string
+
+	// Export returns the exported file as a stream and its size, or -1 if
+	// the size is not known in advance. The stream reads from src.Data,
+	// which the caller closes once the stream is consumed; if the stream is
+	// an io.Closer, it is closed first.
+	Export func(src *Source) (io.Reader, int64, error)
+}
+
+var formats = map[string]Format{
+	"wav":     {ContentType: "audio/wav", Extension: "wav", Export: WAV},
+	"edf":     {ContentType: "application/octet-stream", Extension: "edf", Export: EDF},
+	"dicom":   {ContentType: "application/dicom", Extension: "dcm", Export: DICOM},
+	"parquet": {ContentType: "application/vnd.apache.parquet", Extension: "parquet", Export: Parquet},
+	"bundle":  {ContentType: "application/x-tar", Extension: "tar", Export: Bundle},
+}
+
+// Lookup returns the export format with the given name
+func Lookup(name string) (Format, bool) {
+	format, ok := formats[name]
+	return format, ok
+}
+
+// Formats returns the names of all export formats, sorted
+func Formats() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// timelineGap is a gap in an acquisition's timeline, such as a pause, located
+// in the stored data: offset bytes are stored before it
+type timelineGap struct {
+	offset   int64
+	duration time.Duration
+}
+
+// timelineGaps locates the gaps recorded in an acquisition's index in its
+// stored data, in order
+func timelineGaps(index *storage.Index) []timelineGap {
+	if index == nil {
+		return nil
+	}
+
+	var gaps []timelineGap
+	for _, gap := range index.Gaps {
+		var offset int64
+		for _, chunk := range index.Chunks {
+			if chunk.Index < gap.BeforeChunk {
+				offset += chunk.Length
+			}
+		}
+		gaps = append(gaps, timelineGap{offset: offset, duration: gap.End.Sub(gap.Start)})
+	}
+	return gaps
+}
+
+// pauseNote describes a gap in the timeline for annotations and comments
+func pauseNote(gap timelineGap) string {
+	return fmt.Sprintf("Recording paused for %s", gap.duration.Round(time.Millisecond))
+}
+
+// sampleLayout validates the sample format of an acquisition and returns the
+// bits each sample occupies and the bytes of one frame of all channels
+func sampleLayout(settings models.AcquisitionSettings) (containerBits int, blockAlign int64, err error) {
+	if settings.SampleRate <= 0 || settings.Channels <= 0 || settings.Channels > math.MaxUint16 ||
+		settings.BitDepth <= 0 || settings.BitDepth > 32 {
+		return 0, 0, fmt.Errorf("%w: %d Hz, %d bit, %d channels",
+			ErrInvalidSettings, settings.SampleRate, settings.BitDepth, settings.Channels)
+	}
+
+	containerBits = (settings.BitDepth + 7) / 8 * 8
+	return containerBits, int64(settings.Channels * containerBits / 8), nil
+}
+
+// sample16 converts one stored sample to a 16-bit signed value: 8-bit
+// samples are re-centred on zero, wider ones keep their most significant bits
+func sample16(b []byte) int16 {
+	switch len(b) {
+	case 1:
+		return int16(b[0]) - 128
+	case 2:
+		return int16(binary.LittleEndian.Uint16(b))
+	default:
+		return int16(binary.LittleEndian.Uint16(b[len(b)-2:]))
+	}
+}
+
+// pcm16Reader converts a stream of stored samples of the given width to
+// 16-bit signed little-endian samples
+type pcm16Reader struct {
+	r     io.Reader
+	width int
+	in    []byte
+	buf   []byte
+	out   []byte
+}
+
+func newPCM16Reader(r io.Reader, width int) *pcm16Reader {
+	const samples = 4096
+	return &pcm16Reader{r: r, width: width, in: make([]byte, samples*width)}
+}
+
+func (p *pcm16Reader) Read(b []byte) (int, error) {
+	if len(p.out) == 0 {
+		n, err := io.ReadFull(p.r, p.in)
+		n -= n % p.width
+		if n == 0 {
+			if err == nil || errors.Is(err, io.ErrUnexpectedEOF) {
+				err = io.EOF
+			}
+			return 0, err
+		}
+		p.buf = p.buf[:0]
+		for i := 0; i < n; i += p.width {
+			p.buf = binary.LittleEndian.AppendUint16(p.buf, uint16(sample16(p.in[i:i+p.width])))
+		}
+		p.out = p.buf
+	}
+
+	n := copy(b, p.out)
+	p.out = p.out[n:]
+	return n, nil
+}
+
+// pipeStream streams what a writer goroutine produces. Closing it stops the
+// goroutine and waits for it, so the source is no longer in use afterwards.
+type pipeStream struct {
+	*io.PipeReader
+	done chan struct{}
+}
+
+// newPipeStream runs write in a goroutine and returns a stream of its output
+func newPipeStream(write func(w io.Writer) error) *pipeStream {
+	reader, writer := io.Pipe()
+	stream := &pipeStream{PipeReader: reader, done: make(chan struct{})}
+
+	go func() {
+		defer close(stream.done)
+		writer.CloseWithError(write(writer))
+	}()
+
+	return stream
+}
+
+func (s *pipeStream) Close() error {
+	s.PipeReader.Close()
+	<-s.done
+	return nil
+}
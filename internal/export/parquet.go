@@ -0,0 +1,212 @@
+package export
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"acquire-app/internal/parquet"
+	"acquire-app/internal/storage"
+)
+
+// parquetRowGroupRows is the number of sample frames per row group
+const parquetRowGroupRows = 1 << 16
+
+// Parquet exports the stored samples as a Parquet file with a timestamp
+// column, microseconds since the epoch computed from the acquisition start
+// and sample rate and moved on across the gaps in the stored timeline, such
+// as pauses, and one integer column per channel holding the samples as
+// stored (8-bit samples re-centred on zero). Acquisition, device and session
+// metadata go into the file's key-value metadata. The file is written one
+// row group at a time as the stored data is read; its size is not known in
+// advance.
+func Parquet(src *Source) (io.Reader, int64, error) {
+	settings := src.Settings
+	containerBits, blockAlign, err := sampleLayout(settings)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	intWidth := containerBits
+	if intWidth == 24 {
+		intWidth = 32
+	}
+	columns := []parquet.Column{{Name: "timestamp", Type: parquet.Int64, Timestamp: true}}
+	for i := 0; i < settings.Channels; i++ {
+		columns = append(columns, parquet.Column{
+			Name:     fmt.Sprintf("channel_%d", i+1),
+			Type:     parquet.Int32,
+			IntWidth: intWidth,
+		})
+	}
+
+	metadata, err := parquetMetadata(src)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if _, err := src.Data.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	frames := src.Data.Size() / blockAlign
+	start := src.Acquisition.StartTime.UnixMicro()
+	breaks := timelineBreaks(src.Index, blockAlign)
+	sampleBytes := containerBits / 8
+
+	stream := newPipeStream(func(w io.Writer) error {
+		writer := parquet.NewWriter(w, columns, metadata)
+
+		raw := make([]byte, parquetRowGroupRows*blockAlign)
+		timestamps := make([]int64, parquetRowGroupRows)
+		channels := make([][]int32, settings.Channels)
+		for i := range channels {
+			channels[i] = make([]int32, parquetRowGroupRows)
+		}
+		values := make([]interface{}, len(columns))
+
+		var shift int64
+		for frame := int64(0); frame < frames; {
+			rows := frames - frame
+			if rows > parquetRowGroupRows {
+				rows = parquetRowGroupRows
+			}
+			if _, err := io.ReadFull(src.Data, raw[:rows*blockAlign]); err != nil {
+				if errors.Is(err, io.EOF) {
+					err = io.ErrUnexpectedEOF
+				}
+				return err
+			}
+
+			for row := int64(0); row < rows; row++ {
+				for len(breaks) > 0 && frame+row >= breaks[0].frame {
+					shift = breaks[0].shift
+					breaks = breaks[1:]
+				}
+				// Computed from the frame number so that rounding never accumulates
+				timestamps[row] = start + shift + (frame+row)*int64(time.Second/time.Microsecond)/int64(settings.SampleRate)
+				for channel := range channels {
+					offset := (row*int64(settings.Channels) + int64(channel)) * int64(sampleBytes)
+					channels[channel][row] = sample32(raw[offset : offset+int64(sampleBytes)])
+				}
+			}
+
+			values[0] = timestamps[:rows]
+			for i := range channels {
+				values[i+1] = channels[i][:rows]
+			}
+			if err := writer.WriteRowGroup(values...); err != nil {
+				return err
+			}
+			frame += rows
+		}
+		return writer.Close()
+	})
+
+	return stream, -1, nil
+}
+
+// timelineBreak is where the stored data continues after a gap in the
+// timeline: from frame on, timestamps are moved on by shift microseconds
+type timelineBreak struct {
+	frame int64
+	shift int64
+}
+
+// timelineBreaks locates the gaps of an acquisition's timeline in its sample
+// frames, each with the total length of the gaps up to it
+func timelineBreaks(index *storage.Index, blockAlign int64) []timelineBreak {
+	var breaks []timelineBreak
+	var shift int64
+	for _, gap := range timelineGaps(index) {
+		shift += gap.duration.Microseconds()
+		breaks = append(breaks, timelineBreak{frame: gap.offset / blockAlign, shift: shift})
+	}
+	return breaks
+}
+
+// sample32 converts one stored sample to a signed value of its full width;
+// 8-bit samples are re-centred on zero
+func sample32(b []byte) int32 {
+	switch len(b) {
+	case 1:
+		return int32(b[0]) - 128
+	case 2:
+		return int32(int16(binary.LittleEndian.Uint16(b)))
+	case 3:
+		return int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+	default:
+		return int32(binary.LittleEndian.Uint32(b))
+	}
+}
+
+// parquetMetadata describes the acquisition, its device and session as
+// key-value metadata
+func parquetMetadata(src *Source) ([]parquet.KeyValue, error) {
+	acquisition := src.Acquisition
+	device := src.device()
+
+	var metadata []parquet.KeyValue
+	add := func(key, value string) {
+		if value != "" {
+			metadata = append(metadata, parquet.KeyValue{Key: key, Value: value})
+		}
+	}
+	formatTime := func(t *time.Time) string {
+		if t == nil || t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+
+	add("acquisition.id", acquisition.ID)
+	add("acquisition.session_id", acquisition.SessionID)
+	add("acquisition.status", string(acquisition.Status))
+	add("acquisition.start_time", formatTime(&acquisition.StartTime))
+	add("acquisition.end_time", formatTime(acquisition.EndTime))
+	add("acquisition.mode", acquisition.Parameters.Mode)
+	if endpoint := acquisition.Endpoint; endpoint != nil {
+		add("acquisition.interface_number", strconv.Itoa(endpoint.InterfaceNumber))
+		add("acquisition.endpoint_number", strconv.Itoa(endpoint.EndpointNumber))
+	}
+	add("acquisition.patient_id", acquisition.Metadata.PatientID)
+	add("acquisition.procedure_type", acquisition.Metadata.ProcedureType)
+	add("acquisition.operator", acquisition.Metadata.Operator)
+	add("acquisition.sample_rate", strconv.Itoa(src.Settings.SampleRate))
+	add("acquisition.bit_depth", strconv.Itoa(src.Settings.BitDepth))
+	add("acquisition.channels", strconv.Itoa(src.Settings.Channels))
+	add("acquisition.complete", strconv.FormatBool(acquisition.Statistics.Complete))
+	if len(acquisition.Statistics.MissingChunks) > 0 {
+		missing, err := json.Marshal(acquisition.Statistics.MissingChunks)
+		if err != nil {
+			return nil, err
+		}
+		add("acquisition.missing_chunks", string(missing))
+	}
+	if len(acquisition.Pauses) > 0 {
+		pauses, err := json.Marshal(acquisition.Pauses)
+		if err != nil {
+			return nil, err
+		}
+		add("acquisition.pauses", string(pauses))
+	}
+
+	add("device.id", acquisition.DeviceID)
+	add("device.type", device.DeviceType)
+	add("device.vendor_id", fmt.Sprintf("0x%04x", device.VendorID))
+	add("device.product_id", fmt.Sprintf("0x%04x", device.ProductID))
+	add("device.product_name", device.ProductName)
+	add("device.manufacturer", device.ManufacturerName)
+	add("device.serial_number", device.SerialNumber)
+
+	if session := src.Session; session != nil {
+		add("device.firmware_version", session.Capabilities.FirmwareVersion)
+		add("session.id", session.ID)
+		add("session.status", string(session.Status))
+		add("session.start_time", formatTime(&session.StartTime))
+	}
+	return metadata, nil
+}
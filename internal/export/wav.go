@@ -0,0 +1,155 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+const (
+	wavFormatPCM        = 0x0001
+	wavFormatExtensible = 0xFFFE
+
+	// Size of the fmt chunk body for plain PCM and for WAVE_FORMAT_EXTENSIBLE
+	wavFmtSizePCM        = 16
+	wavFmtSizeExtensible = 40
+
+	// Size of the ds64 chunk body without a table
+	rf64DS64Size = 28
+)
+
+// KSDATAFORMAT_SUBTYPE_PCM, the sub-format GUID of extensible PCM files
+var wavSubtypePCM = [16]byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71}
+
+// WAV exports the stored samples as a RIFF/WAVE file, or as RF64 once the
+// file no longer fits the 32-bit RIFF sizes. Samples wider than 16 bits,
+// bit depths that do not fill whole bytes and more than two channels use
+// WAVE_FORMAT_EXTENSIBLE. A trailing partial sample frame is dropped. The
+// samples are contiguous; pauses are cue points where the data resumes,
+// labelled with their length.
+func WAV(src *Source) (io.Reader, int64, error) {
+	settings := src.Settings
+	containerBits, blockAlign, err := sampleLayout(settings)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	frames := src.Data.Size() / blockAlign
+	dataSize := frames * blockAlign
+	padding := dataSize % 2
+
+	extensible := containerBits > 16 || settings.Channels > 2 || containerBits != settings.BitDepth
+	fmtSize := int64(wavFmtSizePCM)
+	if extensible {
+		fmtSize = wavFmtSizeExtensible
+	}
+	cues := wavCues(timelineGaps(src.Index), blockAlign)
+
+	// Everything after the RIFF size field
+	riffSize := 4 + (8 + fmtSize) + (8 + dataSize + padding) + int64(len(cues))
+	rf64 := riffSize > math.MaxUint32
+	if rf64 {
+		riffSize += 8 + rf64DS64Size
+	}
+
+	var header bytes.Buffer
+	le := func(v interface{}) { binary.Write(&header, binary.LittleEndian, v) }
+
+	if rf64 {
+		header.WriteString("RF64")
+		le(uint32(math.MaxUint32))
+		header.WriteString("WAVE")
+		header.WriteString("ds64")
+		le(uint32(rf64DS64Size))
+		le(uint64(riffSize))
+		le(uint64(dataSize))
+		le(uint64(frames))
+		le(uint32(0)) // no table entries
+	} else {
+		header.WriteString("RIFF")
+		le(uint32(riffSize))
+		header.WriteString("WAVE")
+	}
+
+	header.WriteString("fmt ")
+	le(uint32(fmtSize))
+	if extensible {
+		le(uint16(wavFormatExtensible))
+	} else {
+		le(uint16(wavFormatPCM))
+	}
+	le(uint16(settings.Channels))
+	le(uint32(settings.SampleRate))
+	le(uint32(int64(settings.SampleRate) * blockAlign)) // byte rate
+	le(uint16(blockAlign))
+	le(uint16(containerBits))
+	if extensible {
+		le(uint16(wavFmtSizeExtensible - wavFmtSizePCM - 2)) // cbSize
+		le(uint16(settings.BitDepth))                        // valid bits per sample
+		le(uint32(0))                                        // no speaker assignment
+		header.Write(wavSubtypePCM[:])
+	}
+
+	header.WriteString("data")
+	if rf64 {
+		le(uint32(math.MaxUint32))
+	} else {
+		le(uint32(dataSize))
+	}
+
+	if _, err := src.Data.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+
+	size := int64(header.Len()) + dataSize + padding + int64(len(cues))
+	body := io.MultiReader(&header, io.LimitReader(src.Data, dataSize), bytes.NewReader(make([]byte, padding)), bytes.NewReader(cues))
+	return body, size, nil
+}
+
+// wavCues returns a cue chunk with a point at each gap in the timeline and
+// a LIST/adtl chunk labelling them, or nothing if there are no gaps. Cue
+// positions are 32-bit, so gaps beyond them are left out.
+func wavCues(gaps []timelineGap, blockAlign int64) []byte {
+	var cues, labels bytes.Buffer
+	le := func(buf *bytes.Buffer, v interface{}) { binary.Write(buf, binary.LittleEndian, v) }
+
+	var count uint32
+	for _, gap := range gaps {
+		frame := gap.offset / blockAlign
+		if frame > math.MaxUint32 {
+			break
+		}
+		count++
+
+		le(&cues, count)         // cue point ID
+		le(&cues, uint32(frame)) // play order position
+		cues.WriteString("data")
+		le(&cues, uint32(0))     // chunk start
+		le(&cues, uint32(0))     // block start
+		le(&cues, uint32(frame)) // sample offset
+
+		text := pauseNote(gap) + "\x00"
+		labels.WriteString("labl")
+		le(&labels, uint32(4+len(text)))
+		le(&labels, count)
+		labels.WriteString(text)
+		if len(text)%2 != 0 {
+			labels.WriteByte(0)
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+
+	var chunks bytes.Buffer
+	chunks.WriteString("cue ")
+	le(&chunks, uint32(4+cues.Len()))
+	le(&chunks, count)
+	chunks.Write(cues.Bytes())
+	chunks.WriteString("LIST")
+	le(&chunks, uint32(4+labels.Len()))
+	chunks.WriteString("adtl")
+	chunks.Write(labels.Bytes())
+	return chunks.Bytes()
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"acquire-app/internal/models"
+	"acquire-app/internal/services"
+)
+
+// ListAcquisitions handles GET /api/webusb/acquisitions
+//
+// Filters: patientId, operator, procedureType, deviceId, status, from and to
+// (RFC 3339 start time bounds, from inclusive), minSize (bytes). Ordering:
+// sort=startTime|size, order=asc|desc (default newest first). Paging: limit
+// and the cursor returned as nextCursor.
+func (h *WebusbHandler) ListAcquisitions(c *fiber.Ctx) error {
+	query, err := parseAcquisitionQuery(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Error:   "Invalid acquisition query",
+			Code:    "INVALID_QUERY",
+			Details: err.Error(),
+		})
+	}
+
+	page, err := h.sessionManager.QueryAcquisitions(query)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCursor) {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+				Error:   "Invalid acquisition query",
+				Code:    "INVALID_CURSOR",
+				Details: err.Error(),
+			})
+		}
+		slog.Error("Failed to query acquisitions", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Error:   "Failed to query acquisitions",
+			Code:    "CATALOG_ERROR",
+			Details: err.Error(),
+		})
+	}
+
+	response := models.AcquisitionListResponse{
+		Acquisitions: make([]models.AcquisitionSummary, 0, len(page.Acquisitions)),
+		NextCursor:   page.NextCursor,
+	}
+	for _, acquisition := range page.Acquisitions {
+		response.Acquisitions = append(response.Acquisitions, models.AcquisitionSummary{
+			AcquisitionID: acquisition.ID,
+			SessionID:     acquisition.SessionID,
+			DeviceID:      acquisition.DeviceID,
+			Status:        acquisition.Status,
+			StartTime:     acquisition.StartTime,
+			EndTime:       acquisition.EndTime,
+			Metadata:      acquisition.Metadata,
+			TotalChunks:   acquisition.Statistics.TotalChunks,
+			TotalBytes:    acquisition.Statistics.TotalBytes,
+			Complete:      acquisition.Statistics.Complete,
+			Flagged:       acquisition.Flagged,
+			ArchivedAt:    acquisition.ArchivedAt,
+		})
+	}
+
+	return c.JSON(response)
+}
+
+// parseAcquisitionQuery reads the catalog query parameters
+func parseAcquisitionQuery(c *fiber.Ctx) (services.AcquisitionQuery, error) {
+	query := services.AcquisitionQuery{
+		PatientID:     c.Query("patientId"),
+		Operator:      c.Query("operator"),
+		ProcedureType: c.Query("procedureType"),
+		DeviceID:      c.Query("deviceId"),
+		Status:        models.AcquisitionState(c.Query("status")),
+		Cursor:        c.Query("cursor"),
+		Limit:         services.DefaultCatalogLimit,
+		Descending:    true,
+	}
+
+	for name, bound := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		if value := c.Query(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return query, fmt.Errorf("%s must be an RFC 3339 time: %w", name, err)
+			}
+			*bound = t
+		}
+	}
+
+	if value := c.Query("minSize"); value != "" {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size < 0 {
+			return query, fmt.Errorf("minSize must be a non-negative number of bytes, not %q", value)
+		}
+		query.MinSize = size
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > services.MaxCatalogLimit {
+			return query, fmt.Errorf("limit must be between 1 and %d, not %q", services.MaxCatalogLimit, value)
+		}
+		query.Limit = limit
+	}
+
+	switch sort := services.AcquisitionSort(c.Query("sort", string(services.SortByStartTime))); sort {
+	case services.SortByStartTime, services.SortBySize:
+		query.SortBy = sort
+	default:
+		return query, fmt.Errorf("sort must be %q or %q, not %q", services.SortByStartTime, services.SortBySize, sort)
+	}
+
+	switch order := c.Query("order", "desc"); order {
+	case "asc":
+		query.Descending = false
+	case "desc":
+		query.Descending = true
+	default:
+		return query, fmt.Errorf("order must be \"asc\" or \"desc\", not %q", order)
+	}
+
+	return query, nil
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"acquire-app/internal/models"
+)
+
+// ListDevices handles GET /api/webusb/devices
+func (h *WebusbHandler) ListDevices(c *fiber.Ctx) error {
+	return c.JSON(models.DeviceListResponse{Devices: h.sessionManager.ListDevices()})
+}
+
+// GetDevice handles GET /api/webusb/devices/{deviceId}
+func (h *WebusbHandler) GetDevice(c *fiber.Ctx) error {
+	device, err := h.sessionManager.GetDevice(c.Params("deviceId"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Error:   "Device not found",
+			Code:    "DEVICE_NOT_FOUND",
+			Details: err.Error(),
+		})
+	}
+	return c.JSON(device)
+}
+
+// AddDeviceNote handles POST /api/webusb/devices/{deviceId}/notes
+func (h *WebusbHandler) AddDeviceNote(c *fiber.Ctx) error {
+	deviceID := c.Params("deviceId")
+
+	var req models.DeviceNoteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Error:   "Invalid request body",
+			Code:    "INVALID_REQUEST",
+			Details: err.Error(),
+		})
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Error:   "Missing note text",
+			Code:    "INVALID_REQUEST",
+			Details: "text is required",
+		})
+	}
+
+	device, err := h.sessionManager.AddDeviceNote(deviceID, req.Operator, req.Text)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Error:   "Device not found",
+			Code:    "DEVICE_NOT_FOUND",
+			Details: err.Error(),
+		})
+	}
+
+	slog.Info("Device note added", "deviceId", deviceID, "operator", req.Operator)
+	return c.JSON(device)
+}
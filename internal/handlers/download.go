@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"acquire-app/internal/models"
+	"acquire-app/internal/storage"
+)
+
+// contentTypes maps AcquisitionParams.Format to the Content-Type and file
+// extension used when downloading stored data
+var contentTypes = map[string]struct {
+	mime      string
+	extension string
+}{
+	"raw":    {"application/octet-stream", "bin"},
+	"binary": {"application/octet-stream", "bin"},
+	"csv":    {"text/csv", "csv"},
+	"json":   {"application/json", "json"},
+	"wav":    {"audio/wav", "wav"},
+}
+
+// supportedFormats returns the accepted AcquisitionParams.Format values, sorted
+func supportedFormats() []string {
+	formats := make([]string, 0, len(contentTypes))
+	for format := range contentTypes {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// GetAcquisitionData handles GET /api/webusb/acquisition/{acquisitionId}/data
+func (h *WebusbHandler) GetAcquisitionData(c *fiber.Ctx) error {
+	acquisitionID := c.Params("acquisitionId")
+
+	acquisition, reader, index, err := h.openStoredData(c, acquisitionID)
+	if reader == nil {
+		return err
+	}
+
+	contentType, ok := contentTypes[acquisition.Parameters.Format]
+	if !ok {
+		contentType = contentTypes["raw"]
+	}
+
+	etag := fmt.Sprintf("%q", index.Checksum)
+	c.Set(fiber.HeaderContentType, contentType.mime)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", acquisitionID+"."+contentType.extension))
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	if index.Checksum != "" {
+		c.Set(fiber.HeaderETag, etag)
+		if match := c.Get(fiber.HeaderIfNoneMatch); match == etag || match == "*" {
+			reader.Close()
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+	}
+
+	size := reader.Size()
+	start, length := int64(0), size
+
+	// A Range request is only honoured while the representation still matches
+	// the client's If-Range validator
+	rangeHeader := c.Get(fiber.HeaderRange)
+	if ifRange := c.Get(fiber.HeaderIfRange); ifRange != "" && ifRange != etag {
+		rangeHeader = ""
+	}
+
+	if rangeHeader != "" {
+		var satisfiable bool
+		start, length, satisfiable, ok = parseByteRange(rangeHeader, size)
+		if ok && !satisfiable {
+			reader.Close()
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", size))
+			return c.Status(fiber.StatusRequestedRangeNotSatisfiable).JSON(models.ErrorResponse{
+				Error:   "Requested range not satisfiable",
+				Code:    "RANGE_NOT_SATISFIABLE",
+				Details: rangeHeader,
+			})
+		}
+		if ok {
+			c.Status(fiber.StatusPartialContent)
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, size))
+		} else {
+			start, length = 0, size
+		}
+	}
+
+	if _, err := reader.Seek(start, io.SeekStart); err != nil {
+		reader.Close()
+		return err
+	}
+
+	return c.SendStream(&limitedReadCloser{Reader: io.LimitReader(reader, length), Closer: reader}, int(length))
+}
+
+// openStoredData looks up a finished acquisition and opens its stored data.
+// If that fails, the error response has been sent and the returned reader is
+// nil; the handler should return the returned error.
+func (h *WebusbHandler) openStoredData(c *fiber.Ctx, acquisitionID string) (*models.Acquisition, *storage.Reader, *storage.Index, error) {
+	acquisition, err := h.sessionManager.GetAcquisition(acquisitionID)
+	if err != nil {
+		return nil, nil, nil, c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Error:   "Acquisition not found",
+			Code:    "ACQUISITION_NOT_FOUND",
+			Details: err.Error(),
+		})
+	}
+
+	if acquisition.Status.Ongoing() {
+		return nil, nil, nil, c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{
+			Error:   "Acquisition is still active",
+			Code:    "ACQUISITION_ACTIVE",
+			Details: "Stop the acquisition before downloading its data",
+		})
+	}
+
+	if acquisition.ArchivedAt != nil {
+		return nil, nil, nil, c.Status(fiber.StatusGone).JSON(models.ErrorResponse{
+			Error:   "Acquisition data has been archived",
+			Code:    "ACQUISITION_ARCHIVED",
+			Details: fmt.Sprintf("Archived at %s", acquisition.ArchivedAt.Format(time.RFC3339)),
+		})
+	}
+
+	reader, index, err := h.storage.OpenReader(acquisitionID)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, nil, c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+				Error:   "No data stored for acquisition",
+				Code:    "DATA_NOT_FOUND",
+				Details: acquisitionID,
+			})
+		}
+		slog.Error("Failed to open acquisition data", "acquisitionId", acquisitionID, "error", err)
+		return nil, nil, nil, c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Error:   "Failed to open acquisition data",
+			Code:    "STORAGE_ERROR",
+			Details: err.Error(),
+		})
+	}
+
+	return acquisition, reader, index, nil
+}
+
+// limitedReadCloser closes the underlying storage reader once fasthttp has
+// finished streaming the body
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// parseByteRange parses a single "bytes=" range against a representation of
+// size bytes. ok is false for headers that should be ignored (malformed or
+// multi-range), in which case the full body is served.
+func parseByteRange(header string, size int64) (start, length int64, satisfiable, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, false
+	}
+
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, false
+	}
+
+	if first == "" {
+		// Suffix range: the final N bytes
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix < 0 {
+			return 0, 0, false, false
+		}
+		if suffix == 0 || size == 0 {
+			return 0, 0, false, true
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, suffix, true, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false, false
+	}
+	if start >= size {
+		return 0, 0, false, true
+	}
+
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	return start, end - start + 1, true, true
+}
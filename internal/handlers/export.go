@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"acquire-app/internal/export"
+	"acquire-app/internal/models"
+	"acquire-app/internal/services"
+	"acquire-app/internal/storage"
+)
+
+// ExportAcquisition handles GET /api/webusb/acquisition/{acquisitionId}/export?format=...
+func (h *WebusbHandler) ExportAcquisition(c *fiber.Ctx) error {
+	acquisitionID := c.Params("acquisitionId")
+
+	name := strings.ToLower(c.Query("format"))
+	format, ok := export.Lookup(name)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Error:   "Unsupported export format",
+			Code:    "UNSUPPORTED_EXPORT_FORMAT",
+			Details: fmt.Sprintf("Format %q is not supported; supported export formats: %s", c.Query("format"), strings.Join(export.Formats(), ", ")),
+		})
+	}
+
+	acquisition, reader, index, err := h.openStoredData(c, acquisitionID)
+	if reader == nil {
+		return err
+	}
+
+	// Acquisitions recorded before settings were kept used the defaults
+	settings := acquisition.Settings
+	if settings == (models.AcquisitionSettings{}) {
+		settings = services.DefaultAcquisitionSettings
+	}
+
+	// The session is gone once the device was unregistered
+	session, _ := h.sessionManager.GetSession(acquisition.SessionID)
+
+	body, size, err := format.Export(&export.Source{
+		Acquisition: acquisition,
+		Session:     session,
+		Settings:    settings,
+		Data:        reader,
+		Index:       index,
+		Open: func(name string) (storage.Object, error) {
+			return h.storage.OpenFile(acquisitionID, name)
+		},
+	})
+	if err != nil {
+		reader.Close()
+		if errors.Is(err, export.ErrInvalidSettings) || errors.Is(err, export.ErrTooLarge) {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(models.ErrorResponse{
+				Error:   "Acquisition cannot be exported in this format",
+				Code:    "EXPORT_NOT_POSSIBLE",
+				Details: err.Error(),
+			})
+		}
+		slog.Error("Failed to export acquisition", "acquisitionId", acquisitionID, "format", name, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Error:   "Failed to export acquisition",
+			Code:    "EXPORT_ERROR",
+			Details: err.Error(),
+		})
+	}
+
+	slog.Info("Exporting acquisition", "acquisitionId", acquisitionID, "format", name, "size", size)
+	if err := h.sessionManager.RecordExport(acquisitionID, name); err != nil {
+		slog.Warn("Failed to record export", "acquisitionId", acquisitionID, "error", err)
+	}
+
+	c.Set(fiber.HeaderContentType, format.ContentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", acquisitionID+"."+format.Extension))
+	closer := io.Closer(reader)
+	if stream, ok := body.(io.Closer); ok {
+		closer = closeAll{stream, reader}
+	}
+	return c.SendStream(&limitedReadCloser{Reader: body, Closer: closer}, int(size))
+}
+
+// closeAll closes several closers in order, returning the first error
+type closeAll []io.Closer
+
+func (cs closeAll) Close() error {
+	var first error
+	for _, c := range cs {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
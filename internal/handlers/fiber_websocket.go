@@ -1,14 +1,28 @@
 package handlers
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
-	"net/http"
 	"log/slog"
+	"net"
+	"net/http"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gorilla/websocket"
+	"acquire-app/internal/models"
+	"acquire-app/internal/services"
 )
 
-// HandleFiberWebSocket provides WebSocket endpoint information for Fiber
+// HandleFiberWebSocket handles GET /api/webusb/stream/:acquisitionId
+//
+// Fiber runs on fasthttp, which gorilla/websocket cannot upgrade directly, so the
+// connection is hijacked from fasthttp and the gorilla handshake is performed on
+// the raw net.Conn. This works the same for plain HTTP and TLS listeners.
+//
+// A client whose connection dropped reconnects to the same URL with
+// ?resumeToken=<token from the start response> and continues streaming from
+// the position reported in the resume_ack message.
 func (h *WebusbHandler) HandleFiberWebSocket(c *fiber.Ctx) error {
 	acquisitionID := c.Params("acquisitionId")
 	if acquisitionID == "" {
@@ -18,7 +32,7 @@ func (h *WebusbHandler) HandleFiberWebSocket(c *fiber.Ctx) error {
 	}
 
 	// Validate acquisition exists
-	_, err := h.sessionManager.GetAcquisition(acquisitionID)
+	acquisition, err := h.sessionManager.GetAcquisition(acquisitionID)
 	if err != nil {
 		slog.Error("Acquisition not found", "acquisitionId", acquisitionID, "error", err)
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -26,28 +40,121 @@ func (h *WebusbHandler) HandleFiberWebSocket(c *fiber.Ctx) error {
 		})
 	}
 
-	// For now, return WebSocket connection information
-	// In production, you would either:
-	// 1. Use a WebSocket library compatible with Fiber
-	// 2. Set up a separate WebSocket server on a different port
-	// 3. Use Fiber's WebSocket middleware (if available)
-	
-	baseURL := fmt.Sprintf("%s://%s", c.Protocol(), c.Hostname())
-	if port := c.Port(); port != "" {
-		baseURL += ":" + port
-	}
-	
-	return c.JSON(fiber.Map{
-		"message": "WebSocket endpoint available",
-		"acquisitionId": acquisitionID,
-		"wsUrl": fmt.Sprintf("ws://%s/api/webusb/stream/%s", c.Hostname(), acquisitionID),
-		"protocol": "WebSocket required for real-time data streaming",
-		"instructions": "Use a WebSocket client to connect to this endpoint for real-time data transfer",
+	// The fasthttp request is recycled once this handler returns, so copy
+	// everything the handshake needs before hijacking the connection
+	req, err := newUpgradeRequest(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request URI",
+		})
+	}
+
+	if !websocket.IsWebSocketUpgrade(req) {
+		return c.Status(fiber.StatusUpgradeRequired).JSON(fiber.Map{
+			"error": "WebSocket upgrade required",
+		})
+	}
+
+	resumed, err := h.sessionManager.AttachStream(acquisitionID, req.URL.Query().Get("resumeToken"))
+	if err != nil {
+		slog.Warn("Stream connection rejected", "acquisitionId", acquisitionID, "error", err)
+		switch {
+		case errors.Is(err, services.ErrInvalidResumeToken):
+			return c.Status(fiber.StatusForbidden).JSON(models.ErrorResponse{
+				Error:   "Invalid resume token",
+				Code:    "INVALID_RESUME_TOKEN",
+				Details: err.Error(),
+			})
+		default:
+			return c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{
+				Error:   "Acquisition is not active",
+				Code:    "ACQUISITION_NOT_ACTIVE",
+				Details: err.Error(),
+			})
+		}
+	}
+
+	hijackWebSocket(c, req, func(conn *websocket.Conn) {
+		slog.Info("WebSocket connection established",
+			"acquisitionId", acquisitionID,
+			"sessionId", acquisition.SessionID,
+			"remoteAddr", req.RemoteAddr,
+			"resumed", resumed)
+
+		h.streamHandler.handleConnection(conn, acquisition, resumed)
+	})
+
+	return nil
+}
+
+// hijackWebSocket takes the connection over from fasthttp once the current
+// handler returns, performs the WebSocket handshake for req and runs handler
+// on the upgraded connection, closing it afterwards
+func hijackWebSocket(c *fiber.Ctx, req *http.Request, handler func(*websocket.Conn)) {
+	ctx := c.Context()
+	ctx.HijackSetNoResponse(true)
+	ctx.Hijack(func(netConn net.Conn) {
+		conn, err := upgrader.Upgrade(&hijackedResponseWriter{conn: netConn, header: http.Header{}}, req, nil)
+		if err != nil {
+			slog.Error("Failed to upgrade to websocket", "path", req.URL.Path, "error", err)
+			return
+		}
+		defer conn.Close()
+
+		handler(conn)
 	})
 }
 
-// CreateWebSocketRoute creates a WebSocket-compatible route that can be used with a separate HTTP server
-func CreateWebSocketRoute(webusbHandler *WebusbHandler) http.HandlerFunc {
-	wsHandler := NewWebSocketHandler(webusbHandler.GetSessionManager())
-	return wsHandler.HandleWebSocket
+// newUpgradeRequest builds a net/http request carrying a copy of the fasthttp
+// request line and headers, as expected by websocket.Upgrader
+func newUpgradeRequest(c *fiber.Ctx) (*http.Request, error) {
+	req, err := http.NewRequest(string(c.Request().Header.Method()), string(c.Request().RequestURI()), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Host = string(c.Request().Host())
+	req.RemoteAddr = c.Context().RemoteAddr().String()
+	req.TLS = c.Context().TLSConnectionState()
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		req.Header.Add(string(key), string(value))
+	})
+
+	return req, nil
+}
+
+// hijackedResponseWriter adapts a hijacked fasthttp connection to the
+// http.ResponseWriter and http.Hijacker interfaces used by websocket.Upgrader
+type hijackedResponseWriter struct {
+	conn        net.Conn
+	header      http.Header
+	wroteHeader bool
+}
+
+func (w *hijackedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader is only reached when the handshake is rejected
+func (w *hijackedResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	w.header.Set("Connection", "close")
+	fmt.Fprintf(w.conn, "HTTP/1.1 %d %s\r\n", statusCode, http.StatusText(statusCode))
+	w.header.Write(w.conn)
+	fmt.Fprint(w.conn, "\r\n")
+}
+
+func (w *hijackedResponseWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.conn.Write(data)
+}
+
+func (w *hijackedResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.conn, bufio.NewReadWriter(bufio.NewReader(w.conn), bufio.NewWriter(w.conn)), nil
 }
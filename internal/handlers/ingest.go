@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"acquire-app/internal/models"
+	"acquire-app/internal/services"
+	"acquire-app/internal/storage"
+)
+
+// ingestError is a failure to ingest a chunk, with the error code and message
+// reported to the client
+type ingestError struct {
+	code    string
+	message string
+	err     error
+}
+
+func (e *ingestError) Error() string {
+	return e.message + ": " + e.err.Error()
+}
+
+func (e *ingestError) Unwrap() error {
+	return e.err
+}
+
+// chunkIngester stores validated chunks and records them with the session
+// manager. The WebSocket stream and the HTTP upload fallback both feed their
+// chunks through it so storage, statistics and gap tracking behave the same.
+type chunkIngester struct {
+	sessionManager *services.SessionManager
+	storage        *storage.Manager
+	viewers        *ViewerHub
+	quota          services.StorageQuota
+}
+
+func newChunkIngester(sessionManager *services.SessionManager, storageManager *storage.Manager, viewers *ViewerHub, quota services.StorageQuota) *chunkIngester {
+	return &chunkIngester{
+		sessionManager: sessionManager,
+		storage:        storageManager,
+		viewers:        viewers,
+		quota:          quota,
+	}
+}
+
+// ingest persists a chunk and updates statistics. A chunk that is already
+// stored is a retransmission: it is not written again and the returned
+// receipt has New set to false. Chunks that arrive while the acquisition is
+// paused, or that would exceed the storage quota or fill the storage, are
+// refused.
+func (in *chunkIngester) ingest(acquisition *models.Acquisition, chunk queuedChunk) (*services.ChunkReceipt, error) {
+	if in.sessionManager.IsPaused(acquisition.ID) {
+		err := fmt.Errorf("acquisition %s: %w", acquisition.ID, services.ErrAcquisitionPaused)
+		return nil, &ingestError{code: "ACQUISITION_PAUSED", message: "Acquisition is paused", err: err}
+	}
+	if err := in.checkQuota(acquisition, int64(len(chunk.payload))); err != nil {
+		return nil, &ingestError{code: "STORAGE_QUOTA_EXCEEDED", message: "Storage quota exceeded", err: err}
+	}
+
+	writer, err := in.storage.Get(acquisition.ID)
+	if err == nil {
+		err = writer.WriteChunkAt(chunk.index, chunk.channel, chunk.capturedAt, chunk.payload)
+	}
+	if err != nil && !errors.Is(err, storage.ErrDuplicateChunk) {
+		return nil, &ingestError{code: "STORAGE_ERROR", message: "Failed to store data chunk", err: err}
+	}
+
+	receipt, err := in.sessionManager.RecordChunk(acquisition.ID, chunk.index, int64(len(chunk.payload)), chunk.expectedTotal)
+	if err != nil {
+		return nil, &ingestError{code: "ACQUISITION_NOT_ACTIVE", message: "Acquisition is not accepting data", err: err}
+	}
+
+	if !receipt.New {
+		slog.Debug("Duplicate data chunk ignored", "acquisitionId", acquisition.ID, "chunkIndex", chunk.index)
+		return receipt, nil
+	}
+
+	if receipt.Gap != nil {
+		slog.Warn("Chunk gap detected",
+			"acquisitionId", acquisition.ID,
+			"missingStart", receipt.Gap.Start,
+			"missingEnd", receipt.Gap.End)
+	}
+
+	// Decimated signal for live viewers, only computed when someone watches
+	if in.viewers.hasViewers(acquisition.ID) {
+		in.viewers.broadcast(acquisition.ID, map[string]interface{}{
+			"type":          "preview",
+			"acquisitionId": acquisition.ID,
+			"chunkIndex":    chunk.index,
+			"channel":       chunk.channel,
+			"samples":       previewSamples(chunk.payload),
+		})
+	}
+
+	return receipt, nil
+}
+
+// checkQuota checks that size more bytes of the acquisition fit in storage.
+// If storage cannot be measured the chunk is let through; the next
+// measurement catches up with it.
+func (in *chunkIngester) checkQuota(acquisition *models.Acquisition, size int64) error {
+	deviceID := ""
+	if in.quota.PerDevice > 0 {
+		deviceID = acquisition.DeviceID
+	}
+
+	usage, err := storageUsage(in.sessionManager, in.storage, deviceID)
+	if err != nil {
+		slog.Warn("Failed to measure storage usage", "acquisitionId", acquisition.ID, "error", err)
+		return nil
+	}
+	return in.quota.Check(usage, size)
+}
+
+// checksumMatches reports whether data hashes to the hex SHA-256 checksum
+func checksumMatches(data []byte, expectedChecksum string) bool {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]) == expectedChecksum
+}
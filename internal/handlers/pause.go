@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"acquire-app/internal/models"
+	"acquire-app/internal/services"
+	"acquire-app/internal/storage"
+)
+
+// PauseAcquisition handles POST /api/webusb/acquisition/{acquisitionId}/pause
+//
+// The streaming client is told to halt transfers and gets no more credit
+// until the acquisition is resumed. Chunks that arrive in the meantime, also
+// those already in flight, are refused with ACQUISITION_PAUSED; on resume
+// the client continues from the chunk index the pause began at.
+func (h *WebusbHandler) PauseAcquisition(c *fiber.Ctx) error {
+	acquisitionID := c.Params("acquisitionId")
+
+	reason, err := pauseReason(c, "paused by operator")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Error:   "Invalid request body",
+			Code:    "INVALID_REQUEST",
+			Details: err.Error(),
+		})
+	}
+
+	acquisition, err := h.sessionManager.PauseAcquisition(acquisitionID, reason)
+	if errors.Is(err, services.ErrInvalidTransition) {
+		slog.Warn("Refused to pause acquisition", "acquisitionId", acquisitionID, "error", err)
+		return stateConflict(c, err)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Error:   "Acquisition not found",
+			Code:    "ACQUISITION_NOT_FOUND",
+			Details: err.Error(),
+		})
+	}
+
+	h.streamHandler.notifyStreams(acquisitionID, streamControl(acquisition, "pause", reason))
+	h.viewers.broadcast(acquisitionID, map[string]interface{}{
+		"type":          "acquisition_paused",
+		"acquisitionId": acquisitionID,
+		"reason":        reason,
+	})
+
+	slog.Info("Acquisition paused", "acquisitionId", acquisitionID, "reason", reason)
+
+	return c.JSON(acquisitionStatus(acquisition))
+}
+
+// ResumeAcquisition handles POST /api/webusb/acquisition/{acquisitionId}/resume
+//
+// The pause is recorded as a gap in the stored data's timeline, before the
+// chunk index it began at, and the streaming client is told to continue from
+// that index.
+func (h *WebusbHandler) ResumeAcquisition(c *fiber.Ctx) error {
+	acquisitionID := c.Params("acquisitionId")
+
+	reason, err := pauseReason(c, "resumed by operator")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Error:   "Invalid request body",
+			Code:    "INVALID_REQUEST",
+			Details: err.Error(),
+		})
+	}
+
+	acquisition, err := h.sessionManager.ResumeAcquisition(acquisitionID, reason)
+	if errors.Is(err, services.ErrInvalidTransition) {
+		slog.Warn("Refused to resume acquisition", "acquisitionId", acquisitionID, "error", err)
+		return stateConflict(c, err)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Error:   "Acquisition not found",
+			Code:    "ACQUISITION_NOT_FOUND",
+			Details: err.Error(),
+		})
+	}
+
+	pause := acquisition.Pauses[len(acquisition.Pauses)-1]
+	writer, err := h.storage.Get(acquisitionID)
+	if err == nil {
+		err = writer.AddGap(storage.Gap{BeforeChunk: pause.ResumeChunk, Start: pause.Start, End: *pause.End})
+	}
+	if err != nil {
+		slog.Error("Failed to record pause in acquisition timeline", "acquisitionId", acquisitionID, "error", err)
+	}
+
+	h.streamHandler.resumeStreams(acquisition, streamControl(acquisition, "resume", reason))
+	h.viewers.broadcast(acquisitionID, map[string]interface{}{
+		"type":          "acquisition_resumed",
+		"acquisitionId": acquisitionID,
+		"reason":        reason,
+	})
+
+	slog.Info("Acquisition resumed",
+		"acquisitionId", acquisitionID,
+		"reason", reason,
+		"paused", pause.End.Sub(pause.Start),
+		"resumeChunk", pause.ResumeChunk)
+
+	return c.JSON(acquisitionStatus(acquisition))
+}
+
+// pauseReason reads the reason from the optional body of a pause or resume
+// request
+func pauseReason(c *fiber.Ctx, fallback string) (string, error) {
+	var req models.AcquisitionPauseRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return "", err
+		}
+	}
+	if req.Reason == "" {
+		return fallback, nil
+	}
+	return req.Reason, nil
+}
+
+// streamControl builds the message that tells a streaming client to halt
+// ("pause") or continue ("resume") its transfers. On resume, nextChunk is the
+// index the client should continue from.
+func streamControl(acquisition *models.Acquisition, action, reason string) map[string]interface{} {
+	message := map[string]interface{}{
+		"type":          "stream_control",
+		"acquisitionId": acquisition.ID,
+		"action":        action,
+		"reason":        reason,
+	}
+	if n := len(acquisition.Pauses); action == "resume" && n > 0 {
+		message["nextChunk"] = acquisition.Pauses[n-1].ResumeChunk
+	}
+	return message
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"acquire-app/internal/models"
+	"acquire-app/internal/services"
+	"acquire-app/internal/storage"
+)
+
+// EnforceRetention deletes or archives every finished acquisition older than
+// the retention period, except flagged ones - can be called periodically
+func (h *WebusbHandler) EnforceRetention() {
+	now := time.Now()
+	removed := 0
+
+	for acquisitionID, acquisition := range h.sessionManager.GetAcquisitions() {
+		if !h.retention.Expired(acquisition, now) {
+			continue
+		}
+
+		if h.archive != nil {
+			if err := h.storage.Archive(acquisitionID, acquisition.DataPath, h.archive); err != nil {
+				slog.Error("Failed to archive acquisition", "acquisitionId", acquisitionID, "error", err)
+				continue
+			}
+			if err := h.sessionManager.MarkArchived(acquisitionID); err != nil {
+				slog.Error("Failed to record archived acquisition", "acquisitionId", acquisitionID, "error", err)
+				continue
+			}
+		} else {
+			if err := h.storage.Delete(acquisitionID, acquisition.DataPath); err != nil {
+				slog.Error("Failed to delete acquisition data", "acquisitionId", acquisitionID, "error", err)
+				continue
+			}
+			if err := h.sessionManager.RemoveAcquisition(acquisitionID); err != nil {
+				slog.Error("Failed to remove acquisition", "acquisitionId", acquisitionID, "error", err)
+				continue
+			}
+		}
+		removed++
+	}
+
+	if removed > 0 {
+		usage, err := storageUsage(h.sessionManager, h.storage, "")
+		if err != nil {
+			slog.Warn("Failed to measure storage usage", "error", err)
+		}
+		slog.Info("Enforced acquisition retention",
+			"removed", removed,
+			"archived", h.archive != nil,
+			"storageUsed", usage.Total,
+			"storageUtilization", h.quota.Utilization(usage))
+	}
+}
+
+// storageUsage measures primary storage and, if deviceID is not empty, the
+// part of it taken up by the acquisitions of that device
+func storageUsage(sessionManager *services.SessionManager, storageManager *storage.Manager, deviceID string) (services.StorageUsage, error) {
+	measured, err := storageManager.Usage()
+	if err != nil {
+		return services.StorageUsage{DeviceID: deviceID}, err
+	}
+
+	usage := services.StorageUsage{
+		Total:    measured.Total,
+		DeviceID: deviceID,
+		Capacity: measured.Capacity,
+		Free:     measured.Free,
+	}
+	if deviceID != "" {
+		usage.Device = sessionManager.DeviceStorage(deviceID, measured.Acquisitions)
+	}
+	return usage, nil
+}
+
+// FlagAcquisition handles POST /api/webusb/acquisition/{acquisitionId}/flag
+func (h *WebusbHandler) FlagAcquisition(c *fiber.Ctx) error {
+	acquisitionID := c.Params("acquisitionId")
+
+	var req models.AcquisitionFlagRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Error:   "Invalid request body",
+			Code:    "INVALID_REQUEST",
+			Details: err.Error(),
+		})
+	}
+
+	acquisition, err := h.sessionManager.SetAcquisitionFlag(acquisitionID, req.Flagged)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Error:   "Acquisition not found",
+			Code:    "ACQUISITION_NOT_FOUND",
+			Details: err.Error(),
+		})
+	}
+
+	slog.Info("Acquisition retention flag changed", "acquisitionId", acquisitionID, "flagged", acquisition.Flagged)
+
+	return c.JSON(acquisitionStatus(acquisition))
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Credit-based flow control: the server grants the client an allowance of
+// chunks and bytes with "credit" messages, and the client must not send data
+// beyond what has been granted. Grants are topped up as chunks are processed,
+// and every creditRefreshInterval, and shrink when the processing queue or the
+// storage writer falls behind.
+// Bytes are counted after decompression, since that is what gets queued.
+const (
+	// creditWindowChunks and creditWindowBytes are the largest allowance a
+	// client may hold when the server is idle
+	creditWindowChunks = 64
+	creditWindowBytes  = 1 << 20
+
+	// minCreditChunks and minCreditBytes keep a fully loaded server from
+	// stalling a client forever; minCreditBytes is also the largest chunk a
+	// client can ever send
+	minCreditChunks = 1
+	minCreditBytes  = 256 << 10
+
+	// processingQueueCapacity is the number of queued chunks, across all
+	// connections, at which the server considers itself fully loaded
+	processingQueueCapacity = 1024
+
+	// creditRefreshInterval is how often a connection's credit is topped up
+	// independently of processed chunks, so a client that used up its
+	// allowance while the server was loaded gets more once the load eases
+	creditRefreshInterval = time.Second
+)
+
+// queuedChunk is a validated chunk waiting to be stored
+type queuedChunk struct {
+	index         int64
+	channel       uint16
+	capturedAt    time.Time
+	payload       []byte
+	expectedTotal int64
+}
+
+// streamConn is the per-connection state of a stream. Writes are serialized so
+// acknowledgments, credit grants and server-initiated messages can be sent
+// from several goroutines.
+type streamConn struct {
+	*websocket.Conn
+	writeMutex sync.Mutex
+
+	// queue hands validated chunks from the read loop to the storage worker
+	queue chan queuedChunk
+
+	// Credit accounting, guarded by creditMutex
+	creditMutex    sync.Mutex
+	grantedChunks  int64
+	grantedBytes   int64
+	consumedChunks int64
+	consumedBytes  int64
+
+	// Statistics for this connection, owned by the storage worker;
+	// acquisition totals are kept by the session manager and survive
+	// reconnections
+	totalChunks int64
+	totalBytes  int64
+}
+
+func newStreamConn(conn *websocket.Conn) *streamConn {
+	return &streamConn{
+		Conn:  conn,
+		queue: make(chan queuedChunk, creditWindowChunks),
+	}
+}
+
+func (c *streamConn) WriteJSON(v interface{}) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return c.Conn.WriteJSON(v)
+}
+
+func (c *streamConn) WriteMessage(messageType int, data []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return c.Conn.WriteMessage(messageType, data)
+}
+
+// consumeCredit charges one chunk of size bytes against the granted credit.
+// It returns false, without charging anything, if the client has exceeded
+// its allowance.
+func (c *streamConn) consumeCredit(size int64) bool {
+	c.creditMutex.Lock()
+	defer c.creditMutex.Unlock()
+
+	if c.consumedChunks+1 > c.grantedChunks || c.consumedBytes+size > c.grantedBytes {
+		return false
+	}
+
+	c.consumedChunks++
+	c.consumedBytes += size
+	return true
+}
+
+// topUpCredit extends the client's allowance so that outstanding credit plus
+// queued chunks fill a window of windowChunks/windowBytes. It returns the
+// additional chunks and bytes granted, both zero if no grant is needed yet;
+// either may be zero while the client still holds enough of it.
+func (c *streamConn) topUpCredit(windowChunks, windowBytes int64) (int64, int64) {
+	c.creditMutex.Lock()
+	defer c.creditMutex.Unlock()
+
+	queued := int64(len(c.queue))
+	remainingChunks := c.grantedChunks - c.consumedChunks
+	remainingBytes := c.grantedBytes - c.consumedBytes
+
+	// Only grant once half of the window has been used, to batch grants
+	if remainingChunks+queued > windowChunks/2 && remainingBytes > windowBytes/2 {
+		return 0, 0
+	}
+
+	// Chunks and bytes are topped up independently: a window that shrank
+	// below the bytes still held must not withhold chunks, or a client with
+	// no chunk credit left would never get any again
+	chunks := max(windowChunks-remainingChunks-queued, 0)
+	bytes := max(windowBytes-remainingBytes, 0)
+	if chunks == 0 && bytes == 0 {
+		return 0, 0
+	}
+
+	c.grantedChunks += chunks
+	c.grantedBytes += bytes
+	return chunks, bytes
+}
+
+// credit returns the allowance the client still holds
+func (c *streamConn) credit() (int64, int64) {
+	c.creditMutex.Lock()
+	defer c.creditMutex.Unlock()
+	return c.grantedChunks - c.consumedChunks, c.grantedBytes - c.consumedBytes
+}
@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"acquire-app/internal/compression"
+	"acquire-app/internal/models"
+	"acquire-app/internal/protocol"
+	"acquire-app/internal/services"
+)
+
+// maxBatchChunks caps the number of chunks accepted in one batch upload
+const maxBatchChunks = 256
+
+// UploadChunk handles PUT /api/webusb/acquisition/{acquisitionId}/chunks/{index}
+//
+// HTTP fallback for networks whose proxies block WebSocket upgrades. The body
+// is the chunk payload, compressed with the acquisition's codec if one was
+// negotiated, and is validated, stored and counted exactly like a data_chunk
+// stream message. Headers:
+//
+//	X-Chunk-Checksum  hex SHA-256 of the uncompressed payload (required)
+//	X-Chunk-Channel   source channel, defaults to 0
+//	X-Total-Chunks    expected number of chunks in the acquisition, if known
+func (h *WebusbHandler) UploadChunk(c *fiber.Ctx) error {
+	acquisition, err := h.uploadTarget(c)
+	if acquisition == nil {
+		return err
+	}
+
+	chunkIndex, err := strconv.ParseInt(c.Params("index"), 10, 64)
+	if err != nil || chunkIndex < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Error:   "Invalid chunk index",
+			Code:    "INVALID_CHUNK_INDEX",
+			Details: c.Params("index"),
+		})
+	}
+
+	channel, err := parseUintHeader(c, "X-Chunk-Channel", 16)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Error:   "Invalid chunk channel",
+			Code:    "INVALID_REQUEST",
+			Details: err.Error(),
+		})
+	}
+
+	totalChunks, err := parseUintHeader(c, "X-Total-Chunks", 63)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Error:   "Invalid total chunk count",
+			Code:    "INVALID_REQUEST",
+			Details: err.Error(),
+		})
+	}
+
+	checksum := c.Get("X-Chunk-Checksum")
+	if checksum == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Error:   "Missing chunk checksum",
+			Code:    "MISSING_CHECKSUM",
+			Details: "X-Chunk-Checksum must carry the hex SHA-256 of the uncompressed payload",
+		})
+	}
+
+	payload, err := compression.Decompress(acquisition.Compression, c.Body())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Error:   "Failed to decompress data",
+			Code:    "DECOMPRESSION_ERROR",
+			Details: err.Error(),
+		})
+	}
+
+	if !checksumMatches(payload, strings.ToLower(checksum)) {
+		slog.Warn("Checksum mismatch for uploaded chunk", "acquisitionId", acquisition.ID, "chunkIndex", chunkIndex)
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Error:   "Data integrity check failed",
+			Code:    "CHECKSUM_MISMATCH",
+			Details: fmt.Sprintf("Chunk %d", chunkIndex),
+		})
+	}
+
+	receipt, err := h.ingestUpload(acquisition, queuedChunk{
+		index:         chunkIndex,
+		channel:       uint16(channel),
+		payload:       payload,
+		expectedTotal: int64(totalChunks),
+	})
+	if err != nil {
+		var ingestErr *ingestError
+		if !errors.As(err, &ingestErr) {
+			return err
+		}
+		status := fiber.StatusInternalServerError
+		switch ingestErr.code {
+		case "ACQUISITION_NOT_ACTIVE", "ACQUISITION_PAUSED":
+			status = fiber.StatusConflict
+		case "STORAGE_QUOTA_EXCEEDED":
+			status = fiber.StatusInsufficientStorage
+		}
+		slog.Error("Failed to ingest uploaded chunk", "acquisitionId", acquisition.ID, "chunkIndex", chunkIndex, "error", err)
+		return c.Status(status).JSON(models.ErrorResponse{
+			Error:   ingestErr.message,
+			Code:    ingestErr.code,
+			Details: ingestErr.err.Error(),
+		})
+	}
+
+	processingStatus := "validated"
+	if !receipt.New {
+		processingStatus = "duplicate"
+	}
+
+	return c.JSON(models.ChunkUploadResponse{
+		Success:          true,
+		AcquisitionID:    acquisition.ID,
+		ChunkIndex:       chunkIndex,
+		Channel:          uint16(channel),
+		ProcessingStatus: processingStatus,
+		MissingRanges:    receipt.Gaps,
+	})
+}
+
+// UploadChunkBatch handles POST /api/webusb/acquisition/{acquisitionId}/chunks
+//
+// Accepts up to maxBatchChunks chunks in one request, either as JSON
+// ({"chunks": [data_chunk messages]}) or as application/octet-stream carrying
+// binary frames back to back (see internal/protocol). Every chunk gets its own
+// result; a rejected chunk does not prevent the others from being stored.
+func (h *WebusbHandler) UploadChunkBatch(c *fiber.Ctx) error {
+	acquisition, err := h.uploadTarget(c)
+	if acquisition == nil {
+		return err
+	}
+
+	var chunks []queuedChunk
+	var results []models.ChunkUploadResult
+
+	contentType := c.Get(fiber.HeaderContentType)
+	switch {
+	case strings.HasPrefix(contentType, fiber.MIMEOctetStream):
+		frames, err := protocol.DecodeFrames(c.Body())
+		if err != nil {
+			code := "INVALID_FRAME"
+			if errors.Is(err, protocol.ErrChecksumMismatch) {
+				code = "CHECKSUM_MISMATCH"
+			}
+			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+				Error:   "Failed to parse binary frames",
+				Code:    code,
+				Details: err.Error(),
+			})
+		}
+		if len(frames) == 0 || len(frames) > maxBatchChunks {
+			return invalidBatchSize(c, len(frames))
+		}
+
+		totalChunks, err := parseUintHeader(c, "X-Total-Chunks", 63)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+				Error:   "Invalid total chunk count",
+				Code:    "INVALID_REQUEST",
+				Details: err.Error(),
+			})
+		}
+
+		for _, frame := range frames {
+			payload, err := compression.Decompress(acquisition.Compression, frame.Payload)
+			if err != nil {
+				results = append(results, rejectedChunk(frame.ChunkIndex, frame.Channel, "DECOMPRESSION_ERROR", err.Error()))
+				continue
+			}
+			chunks = append(chunks, queuedChunk{
+				index:         frame.ChunkIndex,
+				channel:       frame.Channel,
+				capturedAt:    frame.Timestamp,
+				payload:       payload,
+				expectedTotal: int64(totalChunks),
+			})
+		}
+
+	case strings.HasPrefix(contentType, fiber.MIMEApplicationJSON):
+		var req models.ChunkBatchUploadRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+				Error:   "Invalid request body",
+				Code:    "INVALID_REQUEST",
+				Details: err.Error(),
+			})
+		}
+		if len(req.Chunks) == 0 || len(req.Chunks) > maxBatchChunks {
+			return invalidBatchSize(c, len(req.Chunks))
+		}
+
+		for _, chunkMsg := range req.Chunks {
+			decodedData, err := base64.StdEncoding.DecodeString(chunkMsg.Data)
+			if err != nil {
+				results = append(results, rejectedChunk(chunkMsg.ChunkIndex, 0, "DECODE_ERROR", err.Error()))
+				continue
+			}
+
+			payload, err := compression.Decompress(acquisition.Compression, decodedData)
+			switch {
+			case err != nil:
+				results = append(results, rejectedChunk(chunkMsg.ChunkIndex, 0, "DECOMPRESSION_ERROR", err.Error()))
+			case !checksumMatches(payload, chunkMsg.Checksum):
+				results = append(results, rejectedChunk(chunkMsg.ChunkIndex, 0, "CHECKSUM_MISMATCH", "Data integrity check failed"))
+			default:
+				chunks = append(chunks, queuedChunk{
+					index:         chunkMsg.ChunkIndex,
+					capturedAt:    chunkMsg.Timestamp,
+					payload:       payload,
+					expectedTotal: chunkMsg.TotalChunks,
+				})
+			}
+		}
+
+	default:
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(models.ErrorResponse{
+			Error:   "Unsupported content type",
+			Code:    "UNSUPPORTED_CONTENT_TYPE",
+			Details: "Use application/json or application/octet-stream",
+		})
+	}
+
+	response := models.ChunkBatchUploadResponse{
+		AcquisitionID: acquisition.ID,
+		Rejected:      len(results),
+	}
+
+	for _, chunk := range chunks {
+		if chunk.index < 0 {
+			results = append(results, rejectedChunk(chunk.index, chunk.channel, "INVALID_CHUNK_INDEX", "Chunk index must not be negative"))
+			response.Rejected++
+			continue
+		}
+
+		receipt, err := h.ingestUpload(acquisition, chunk)
+		if err != nil {
+			var ingestErr *ingestError
+			if !errors.As(err, &ingestErr) {
+				return err
+			}
+			slog.Error("Failed to ingest uploaded chunk", "acquisitionId", acquisition.ID, "chunkIndex", chunk.index, "error", err)
+			results = append(results, rejectedChunk(chunk.index, chunk.channel, ingestErr.code, ingestErr.message))
+			response.Rejected++
+			continue
+		}
+
+		result := models.ChunkUploadResult{
+			ChunkIndex:       chunk.index,
+			Channel:          chunk.channel,
+			ProcessingStatus: "validated",
+		}
+		if receipt.New {
+			response.Accepted++
+		} else {
+			result.ProcessingStatus = "duplicate"
+			response.Duplicates++
+		}
+		results = append(results, result)
+	}
+
+	response.Success = response.Rejected == 0
+	response.Results = results
+	response.MissingRanges = h.sessionManager.ChunkGaps(acquisition.ID)
+
+	slog.Debug("Chunk batch uploaded",
+		"acquisitionId", acquisition.ID,
+		"accepted", response.Accepted,
+		"duplicates", response.Duplicates,
+		"rejected", response.Rejected)
+
+	return c.JSON(response)
+}
+
+// uploadTarget resolves the acquisition an upload is addressed to. If it
+// cannot take data right now the error response is written and a nil
+// acquisition is returned together with the result of writing it.
+func (h *WebusbHandler) uploadTarget(c *fiber.Ctx) (*models.Acquisition, error) {
+	acquisitionID := c.Params("acquisitionId")
+
+	acquisition, err := h.sessionManager.GetAcquisition(acquisitionID)
+	if err != nil {
+		return nil, c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Error:   "Acquisition not found",
+			Code:    "ACQUISITION_NOT_FOUND",
+			Details: err.Error(),
+		})
+	}
+
+	if !acquisition.Status.Ongoing() {
+		return nil, c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{
+			Error:   "Acquisition is not active",
+			Code:    "ACQUISITION_NOT_ACTIVE",
+			Details: acquisitionID,
+		})
+	}
+
+	// HTTP clients have no credit window, so shed load once the processing
+	// queue is full and let them retry
+	if h.flow.Load() >= 1 {
+		c.Set(fiber.HeaderRetryAfter, "1")
+		return nil, c.Status(fiber.StatusServiceUnavailable).JSON(models.ErrorResponse{
+			Error:   "Server is busy",
+			Code:    "SERVER_BUSY",
+			Details: "Processing queue is full, retry later",
+		})
+	}
+
+	return acquisition, nil
+}
+
+// ingestUpload ingests an uploaded chunk, counting it in the processing queue
+// while it is being stored
+func (h *WebusbHandler) ingestUpload(acquisition *models.Acquisition, chunk queuedChunk) (*services.ChunkReceipt, error) {
+	h.flow.Enqueued()
+	defer h.flow.Dequeued()
+
+	return h.ingester.ingest(acquisition, chunk)
+}
+
+func invalidBatchSize(c *fiber.Ctx, count int) error {
+	return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+		Error:   "Invalid batch size",
+		Code:    "INVALID_BATCH_SIZE",
+		Details: fmt.Sprintf("Batch contains %d chunks, expected 1 to %d", count, maxBatchChunks),
+	})
+}
+
+func rejectedChunk(chunkIndex int64, channel uint16, code, message string) models.ChunkUploadResult {
+	return models.ChunkUploadResult{
+		ChunkIndex:       chunkIndex,
+		Channel:          channel,
+		ProcessingStatus: "rejected",
+		Code:             code,
+		Error:            message,
+	}
+}
+
+// parseUintHeader parses an optional unsigned integer header, returning 0 if
+// it is absent
+func parseUintHeader(c *fiber.Ctx, name string, bitSize int) (uint64, error) {
+	value := c.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	parsed, err := strconv.ParseUint(value, 10, bitSize)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	return parsed, nil
+}
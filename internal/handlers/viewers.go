@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gorilla/websocket"
+	"acquire-app/internal/models"
+)
+
+const (
+	// viewerBufferSize is how many messages may wait for a slow viewer before
+	// further messages to it are dropped
+	viewerBufferSize = 64
+
+	// previewPoints is the number of samples per chunk sent to viewers
+	previewPoints = 64
+)
+
+// viewer is one read-only subscriber to an acquisition's stream events
+type viewer struct {
+	send chan []byte
+}
+
+// ViewerHub fans out stream events of each acquisition (status updates,
+// processing feedback, preview data) to any number of read-only viewers.
+// Broadcasting never blocks: a viewer that cannot keep up misses messages
+// instead of slowing down the ingest connection.
+type ViewerHub struct {
+	viewers map[string]map[*viewer]struct{}
+	mutex   sync.RWMutex
+}
+
+func NewViewerHub() *ViewerHub {
+	return &ViewerHub{
+		viewers: make(map[string]map[*viewer]struct{}),
+	}
+}
+
+func (hub *ViewerHub) subscribe(acquisitionID string) *viewer {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	v := &viewer{send: make(chan []byte, viewerBufferSize)}
+	if hub.viewers[acquisitionID] == nil {
+		hub.viewers[acquisitionID] = make(map[*viewer]struct{})
+	}
+	hub.viewers[acquisitionID][v] = struct{}{}
+	return v
+}
+
+func (hub *ViewerHub) unsubscribe(acquisitionID string, v *viewer) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	if _, exists := hub.viewers[acquisitionID][v]; !exists {
+		return
+	}
+	delete(hub.viewers[acquisitionID], v)
+	if len(hub.viewers[acquisitionID]) == 0 {
+		delete(hub.viewers, acquisitionID)
+	}
+	close(v.send)
+}
+
+// hasViewers reports whether anyone is watching an acquisition, so callers
+// can skip building messages nobody will receive
+func (hub *ViewerHub) hasViewers(acquisitionID string) bool {
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+	return len(hub.viewers[acquisitionID]) > 0
+}
+
+// broadcast sends message to every viewer of an acquisition without blocking
+func (hub *ViewerHub) broadcast(acquisitionID string, message interface{}) {
+	if !hub.hasViewers(acquisitionID) {
+		return
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		slog.Error("Failed to encode viewer message", "acquisitionId", acquisitionID, "error", err)
+		return
+	}
+
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+
+	for v := range hub.viewers[acquisitionID] {
+		select {
+		case v.send <- data:
+		default:
+			// Viewer is too slow; drop the message for it
+		}
+	}
+}
+
+// closeAcquisition sends a final message to every viewer of an acquisition
+// and disconnects them
+func (hub *ViewerHub) closeAcquisition(acquisitionID string, message interface{}) {
+	hub.broadcast(acquisitionID, message)
+
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	for v := range hub.viewers[acquisitionID] {
+		close(v.send)
+	}
+	delete(hub.viewers, acquisitionID)
+}
+
+// WatchAcquisition handles GET /api/webusb/acquisition/{acquisitionId}/watch
+//
+// It upgrades to a read-only WebSocket that receives the acquisition's
+// status_update, processing_feedback and preview messages as they happen.
+func (h *WebusbHandler) WatchAcquisition(c *fiber.Ctx) error {
+	acquisitionID := c.Params("acquisitionId")
+
+	acquisition, err := h.sessionManager.GetAcquisition(acquisitionID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Error:   "Acquisition not found",
+			Code:    "ACQUISITION_NOT_FOUND",
+			Details: err.Error(),
+		})
+	}
+
+	if !acquisition.Status.Ongoing() {
+		return c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{
+			Error:   "Acquisition is not active",
+			Code:    "ACQUISITION_NOT_ACTIVE",
+			Details: "Only active acquisitions can be watched",
+		})
+	}
+
+	req, err := newUpgradeRequest(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request URI",
+		})
+	}
+
+	if !websocket.IsWebSocketUpgrade(req) {
+		return c.Status(fiber.StatusUpgradeRequired).JSON(fiber.Map{
+			"error": "WebSocket upgrade required",
+		})
+	}
+
+	hijackWebSocket(c, req, func(conn *websocket.Conn) {
+		slog.Info("Viewer connected", "acquisitionId", acquisitionID, "remoteAddr", req.RemoteAddr)
+		h.viewers.serveViewer(conn, acquisition)
+		slog.Info("Viewer disconnected", "acquisitionId", acquisitionID, "remoteAddr", req.RemoteAddr)
+	})
+
+	return nil
+}
+
+// serveViewer writes the acquisition's events to conn until either side
+// closes. Anything the viewer sends is ignored.
+func (hub *ViewerHub) serveViewer(conn *websocket.Conn, acquisition *models.Acquisition) {
+	v := hub.subscribe(acquisition.ID)
+	defer hub.unsubscribe(acquisition.ID, v)
+
+	// Read loop only detects the viewer going away and answers pings
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	if err := conn.WriteJSON(map[string]interface{}{
+		"type":          "watch_ready",
+		"acquisitionId": acquisition.ID,
+		"sessionId":     acquisition.SessionID,
+		"startTime":     acquisition.StartTime,
+	}); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(54 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case data, ok := <-v.send:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, "acquisition ended"),
+					time.Now().Add(time.Second))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+
+		case <-closed:
+			return
+		}
+	}
+}
+
+// previewSamples decimates a chunk for live display. Payloads are read as
+// 16-bit little-endian PCM, the format handed out at device registration.
+func previewSamples(payload []byte) []int16 {
+	count := len(payload) / 2
+	if count == 0 {
+		return nil
+	}
+
+	step := (count + previewPoints - 1) / previewPoints
+	samples := make([]int16, 0, previewPoints)
+	for i := 0; i < count; i += step {
+		samples = append(samples, int16(binary.LittleEndian.Uint16(payload[i*2:])))
+	}
+	return samples
+}
@@ -1,18 +1,21 @@
 package handlers
 
 import (
-	"crypto/sha256"
 	"encoding/base64"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"acquire-app/internal/compression"
 	"acquire-app/internal/models"
+	"acquire-app/internal/protocol"
 	"acquire-app/internal/services"
+	"acquire-app/internal/storage"
 )
 
 var upgrader = websocket.Upgrader{
@@ -24,52 +27,101 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+const (
+	// retransmitRequestInterval is how often (in chunk indices) outstanding
+	// gaps are re-requested from the client
+	retransmitRequestInterval = 50
+
+	// maxRetransmitRanges caps the ranges listed in one retransmit_request
+	maxRetransmitRanges = 64
+)
+
+// WebSocketHandler runs the streaming protocol on upgraded connections for
+// /api/webusb/stream/{acquisitionId}
 type WebSocketHandler struct {
 	sessionManager *services.SessionManager
+	storage        *storage.Manager
+	flow           *services.FlowController
+	viewers        *ViewerHub
+	ingester       *chunkIngester
+
+	// streams holds the open stream connections of each acquisition
+	streams     map[string]map[*streamConn]struct{}
+	streamMutex sync.Mutex
 }
 
-func NewWebSocketHandler(sessionManager *services.SessionManager) *WebSocketHandler {
+func NewWebSocketHandler(sessionManager *services.SessionManager, storageManager *storage.Manager, flow *services.FlowController, viewers *ViewerHub, quota services.StorageQuota) *WebSocketHandler {
 	return &WebSocketHandler{
 		sessionManager: sessionManager,
+		storage:        storageManager,
+		flow:           flow,
+		viewers:        viewers,
+		ingester:       newChunkIngester(sessionManager, storageManager, viewers, quota),
+		streams:        make(map[string]map[*streamConn]struct{}),
 	}
 }
 
-// HandleWebSocket handles WebSocket connections for data streaming
-// This will be mounted at /api/webusb/stream/{acquisitionId}
-func (ws *WebSocketHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	// Extract acquisition ID from URL path (this depends on your router setup)
-	acquisitionID := extractAcquisitionID(r.URL.Path)
-	if acquisitionID == "" {
-		http.Error(w, "Missing acquisition ID", http.StatusBadRequest)
-		return
+func (ws *WebSocketHandler) addStream(acquisitionID string, conn *streamConn) {
+	ws.streamMutex.Lock()
+	defer ws.streamMutex.Unlock()
+
+	if ws.streams[acquisitionID] == nil {
+		ws.streams[acquisitionID] = make(map[*streamConn]struct{})
 	}
+	ws.streams[acquisitionID][conn] = struct{}{}
+}
 
-	// Validate acquisition exists
-	acquisition, err := ws.sessionManager.GetAcquisition(acquisitionID)
-	if err != nil {
-		slog.Error("Acquisition not found", "acquisitionId", acquisitionID, "error", err)
-		http.Error(w, "Acquisition not found", http.StatusNotFound)
-		return
+func (ws *WebSocketHandler) removeStream(acquisitionID string, conn *streamConn) {
+	ws.streamMutex.Lock()
+	defer ws.streamMutex.Unlock()
+
+	delete(ws.streams[acquisitionID], conn)
+	if len(ws.streams[acquisitionID]) == 0 {
+		delete(ws.streams, acquisitionID)
 	}
+}
 
-	// Upgrade HTTP connection to WebSocket
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		slog.Error("Failed to upgrade to websocket", "error", err)
-		return
+// streamConns returns the open stream connections of an acquisition
+func (ws *WebSocketHandler) streamConns(acquisitionID string) []*streamConn {
+	ws.streamMutex.Lock()
+	defer ws.streamMutex.Unlock()
+
+	conns := make([]*streamConn, 0, len(ws.streams[acquisitionID]))
+	for conn := range ws.streams[acquisitionID] {
+		conns = append(conns, conn)
 	}
-	defer conn.Close()
+	return conns
+}
 
-	slog.Info("WebSocket connection established", 
-		"acquisitionId", acquisitionID,
-		"sessionId", acquisition.SessionID,
-		"remoteAddr", r.RemoteAddr)
+// notifyStreams sends a server-initiated message to every client streaming
+// an acquisition
+func (ws *WebSocketHandler) notifyStreams(acquisitionID string, message interface{}) {
+	for _, conn := range ws.streamConns(acquisitionID) {
+		if err := conn.WriteJSON(message); err != nil {
+			slog.Error("Failed to notify stream client", "acquisitionId", acquisitionID, "error", err)
+		}
+	}
+}
 
-	// Handle the WebSocket connection
-	ws.handleConnection(conn, acquisition)
+// resumeStreams tells the clients streaming a resumed acquisition to continue
+// and grants them credit again, which was withheld during the pause
+func (ws *WebSocketHandler) resumeStreams(acquisition *models.Acquisition, message interface{}) {
+	for _, conn := range ws.streamConns(acquisition.ID) {
+		err := conn.WriteJSON(message)
+		if err == nil {
+			err = ws.grantCredit(conn, acquisition)
+		}
+		if err != nil {
+			slog.Error("Failed to resume stream client", "acquisitionId", acquisition.ID, "error", err)
+		}
+	}
 }
 
-func (ws *WebSocketHandler) handleConnection(conn *websocket.Conn, acquisition *models.Acquisition) {
+func (ws *WebSocketHandler) handleConnection(wsConn *websocket.Conn, acquisition *models.Acquisition, resumed bool) {
+	conn := newStreamConn(wsConn)
+	ws.addStream(acquisition.ID, conn)
+	defer ws.removeStream(acquisition.ID, conn)
+
 	// Set up ping/pong handlers for connection health
 	conn.SetPingHandler(func(appData string) error {
 		return conn.WriteMessage(websocket.PongMessage, []byte(appData))
@@ -86,9 +138,44 @@ func (ws *WebSocketHandler) handleConnection(conn *websocket.Conn, acquisition *
 	ticker := time.NewTicker(54 * time.Second)
 	defer ticker.Stop()
 
-	// Track statistics
-	var totalChunks int64 = 0
-	var totalBytes int64 = 0
+	// Tell a reconnecting client where to continue from
+	if resumed {
+		if err := ws.sendResumeAck(conn, acquisition); err != nil {
+			slog.Error("Failed to send resume acknowledgment", "acquisitionId", acquisition.ID, "error", err)
+			return
+		}
+	}
+
+	// Chunks are stored by a separate worker so the read loop keeps draining
+	// the socket; whatever is still queued when the connection drops is
+	// stored before returning
+	workerDone := make(chan struct{})
+	go ws.processChunks(conn, acquisition, workerDone)
+	defer func() {
+		close(conn.queue)
+		<-workerDone
+	}()
+
+	ws.broadcastIngestStatus(acquisition, true)
+	defer ws.broadcastIngestStatus(acquisition, false)
+
+	// A client connecting during a pause waits for it to end
+	if ws.sessionManager.IsPaused(acquisition.ID) {
+		if err := conn.WriteJSON(streamControl(acquisition, "pause", "acquisition is paused")); err != nil {
+			slog.Error("Failed to send pause notice", "acquisitionId", acquisition.ID, "error", err)
+			return
+		}
+	}
+
+	// Grant the initial credit window
+	if err := ws.grantCredit(conn, acquisition); err != nil {
+		slog.Error("Failed to send initial credit", "acquisitionId", acquisition.ID, "error", err)
+		return
+	}
+
+	stopRefresh := make(chan struct{})
+	defer close(stopRefresh)
+	go ws.refreshCredit(conn, acquisition, stopRefresh)
 
 	// Handle messages
 	for {
@@ -115,14 +202,14 @@ func (ws *WebSocketHandler) handleConnection(conn *websocket.Conn, acquisition *
 			// Handle different message types
 			switch messageType {
 			case websocket.TextMessage:
-				err = ws.handleTextMessage(conn, acquisition, data, &totalChunks, &totalBytes)
+				err = ws.handleTextMessage(conn, acquisition, data)
 				if err != nil {
 					slog.Error("Failed to handle text message", "acquisitionId", acquisition.ID, "error", err)
 					return
 				}
 
 			case websocket.BinaryMessage:
-				err = ws.handleBinaryMessage(conn, acquisition, data, &totalChunks, &totalBytes)
+				err = ws.handleBinaryMessage(conn, acquisition, data)
 				if err != nil {
 					slog.Error("Failed to handle binary message", "acquisitionId", acquisition.ID, "error", err)
 					return
@@ -135,15 +222,19 @@ func (ws *WebSocketHandler) handleConnection(conn *websocket.Conn, acquisition *
 	}
 }
 
-func (ws *WebSocketHandler) handleTextMessage(conn *websocket.Conn, acquisition *models.Acquisition, data []byte, totalChunks, totalBytes *int64) error {
-	var message models.WSMessage
+func (ws *WebSocketHandler) handleTextMessage(conn *streamConn, acquisition *models.Acquisition, data []byte) error {
+	// Only the type is decoded here; the payload shape depends on it (data_chunk
+	// carries a base64 string in "data", which does not fit WSMessage.Data)
+	var message struct {
+		Type string `json:"type"`
+	}
 	if err := json.Unmarshal(data, &message); err != nil {
 		return ws.sendErrorMessage(conn, "INVALID_MESSAGE", "Failed to parse message", err.Error())
 	}
 
 	switch message.Type {
 	case "data_chunk":
-		return ws.handleDataChunk(conn, acquisition, data, totalChunks, totalBytes)
+		return ws.handleDataChunk(conn, acquisition, data)
 
 	case "status_update":
 		return ws.handleStatusUpdate(conn, acquisition, data)
@@ -156,74 +247,233 @@ func (ws *WebSocketHandler) handleTextMessage(conn *websocket.Conn, acquisition
 	}
 }
 
-func (ws *WebSocketHandler) handleBinaryMessage(conn *websocket.Conn, acquisition *models.Acquisition, data []byte, totalChunks, totalBytes *int64) error {
-	// For binary messages, we might handle raw data chunks
-	// This is a simple implementation - in practice, you'd have a more sophisticated binary protocol
-	
-	*totalChunks++
-	*totalBytes += int64(len(data))
-
-	// Update acquisition statistics
-	ws.sessionManager.UpdateAcquisitionStats(acquisition.ID, *totalChunks, *totalBytes)
+// handleBinaryMessage handles a binary chunk frame (see internal/protocol for
+// the header layout). Unlike data_chunk messages the payload is sent raw.
+func (ws *WebSocketHandler) handleBinaryMessage(conn *streamConn, acquisition *models.Acquisition, data []byte) error {
+	frame, err := protocol.DecodeFrame(data)
+	if err != nil {
+		switch {
+		case errors.Is(err, protocol.ErrChecksumMismatch):
+			return ws.sendErrorMessage(conn, "CHECKSUM_MISMATCH", "Data integrity check failed", err.Error())
+		case errors.Is(err, protocol.ErrUnsupportedVersion):
+			return ws.sendErrorMessage(conn, "UNSUPPORTED_FRAME_VERSION", "Unsupported binary frame version", err.Error())
+		default:
+			return ws.sendErrorMessage(conn, "INVALID_FRAME", "Failed to parse binary frame", err.Error())
+		}
+	}
 
-	// Send acknowledgment
-	ackMessage := map[string]interface{}{
-		"type":       "ack",
-		"chunkIndex": *totalChunks,
-		"received":   true,
-		"processingStatus": "validated",
+	payload, err := compression.Decompress(acquisition.Compression, frame.Payload)
+	if err != nil {
+		return ws.sendErrorMessage(conn, "DECOMPRESSION_ERROR", "Failed to decompress data", err.Error())
 	}
 
-	return conn.WriteJSON(ackMessage)
+	return ws.enqueueChunk(conn, acquisition, queuedChunk{
+		index:      frame.ChunkIndex,
+		channel:    frame.Channel,
+		capturedAt: frame.Timestamp,
+		payload:    payload,
+	})
 }
 
-func (ws *WebSocketHandler) handleDataChunk(conn *websocket.Conn, acquisition *models.Acquisition, data []byte, totalChunks, totalBytes *int64) error {
+func (ws *WebSocketHandler) handleDataChunk(conn *streamConn, acquisition *models.Acquisition, data []byte) error {
 	var chunkMsg models.DataChunkMessage
 	if err := json.Unmarshal(data, &chunkMsg); err != nil {
 		return ws.sendErrorMessage(conn, "INVALID_DATA_CHUNK", "Failed to parse data chunk", err.Error())
 	}
 
+	// Decode base64 data
+	decodedData, err := base64.StdEncoding.DecodeString(chunkMsg.Data)
+	if err != nil {
+		return ws.sendErrorMessage(conn, "DECODE_ERROR", "Failed to decode data", err.Error())
+	}
+
+	// The checksum covers the uncompressed payload
+	payload, err := compression.Decompress(acquisition.Compression, decodedData)
+	if err != nil {
+		return ws.sendErrorMessage(conn, "DECOMPRESSION_ERROR", "Failed to decompress data", err.Error())
+	}
+
 	// Validate checksum
-	if !ws.validateChecksum(chunkMsg.Data, chunkMsg.Checksum) {
+	if !checksumMatches(payload, chunkMsg.Checksum) {
 		return ws.sendErrorMessage(conn, "CHECKSUM_MISMATCH", "Data integrity check failed", "")
 	}
 
-	// Decode base64 data
-	decodedData, err := base64.StdEncoding.DecodeString(chunkMsg.Data)
+	return ws.enqueueChunk(conn, acquisition, queuedChunk{
+		index:         chunkMsg.ChunkIndex,
+		capturedAt:    chunkMsg.Timestamp,
+		payload:       payload,
+		expectedTotal: chunkMsg.TotalChunks,
+	})
+}
+
+// enqueueChunk charges a validated chunk against the client's credit and
+// queues it for the storage worker. Chunks sent without credit are dropped;
+// they show up as gaps and are requested again once credit is available.
+func (ws *WebSocketHandler) enqueueChunk(conn *streamConn, acquisition *models.Acquisition, chunk queuedChunk) error {
+	if chunk.index < 0 {
+		return ws.sendErrorMessage(conn, "INVALID_CHUNK_INDEX", "Chunk index must not be negative", "")
+	}
+
+	if !conn.consumeCredit(int64(len(chunk.payload))) {
+		chunks, bytes := conn.credit()
+		slog.Warn("Chunk dropped, client exceeded its credit",
+			"acquisitionId", acquisition.ID,
+			"chunkIndex", chunk.index,
+			"creditChunks", chunks,
+			"creditBytes", bytes)
+		return ws.sendErrorMessage(conn, "CREDIT_EXCEEDED", "Chunk sent without credit was dropped",
+			fmt.Sprintf("chunk %d; remaining credit %d chunks / %d bytes", chunk.index, chunks, bytes))
+	}
+
+	// The credit is spent all the same, as the client counted it
+	if ws.sessionManager.IsPaused(acquisition.ID) {
+		return ws.sendErrorMessage(conn, "ACQUISITION_PAUSED", "Chunk sent during a pause was dropped",
+			fmt.Sprintf("chunk %d", chunk.index))
+	}
+
+	ws.flow.Enqueued()
+	conn.queue <- chunk
+	return nil
+}
+
+// processChunks is the storage worker of a connection. It stores queued
+// chunks in arrival order and tops up the client's credit as it goes.
+func (ws *WebSocketHandler) processChunks(conn *streamConn, acquisition *models.Acquisition, done chan<- struct{}) {
+	defer close(done)
+
+	for chunk := range conn.queue {
+		err := ws.acceptChunk(conn, acquisition, chunk)
+		ws.flow.Dequeued()
+
+		if err == nil {
+			err = ws.grantCredit(conn, acquisition)
+		}
+		if err != nil {
+			// Keep storing what was already received, but stop the read loop
+			slog.Error("Failed to process data chunk", "acquisitionId", acquisition.ID, "error", err)
+			conn.Close()
+		}
+	}
+}
+
+// refreshCredit tops up a connection's credit every creditRefreshInterval
+// until stop is closed. Grants otherwise only follow processed chunks, so a
+// client holding no credit while the queue is empty would wait forever.
+func (ws *WebSocketHandler) refreshCredit(conn *streamConn, acquisition *models.Acquisition, stop <-chan struct{}) {
+	ticker := time.NewTicker(creditRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := ws.grantCredit(conn, acquisition); err != nil {
+				slog.Error("Failed to refresh credit", "acquisitionId", acquisition.ID, "error", err)
+				return
+			}
+		}
+	}
+}
+
+// grantCredit sends a credit message if the client's allowance has run low.
+// The window shrinks with the processing queue and the storage writer's
+// out-of-order backlog, whichever is further behind.
+func (ws *WebSocketHandler) grantCredit(conn *streamConn, acquisition *models.Acquisition) error {
+	// A paused stream gets no credit until it is resumed
+	if ws.sessionManager.IsPaused(acquisition.ID) {
+		return nil
+	}
+
+	load := ws.flow.Load()
+	if writer, err := ws.storage.Get(acquisition.ID); err == nil {
+		if backlog := writer.Backlog(); backlog > load {
+			load = backlog
+		}
+	}
+
+	windowChunks := max(int64(float64(creditWindowChunks)*(1-load)), minCreditChunks)
+	windowBytes := max(int64(float64(creditWindowBytes)*(1-load)), minCreditBytes)
+
+	chunks, bytes := conn.topUpCredit(windowChunks, windowBytes)
+	if chunks == 0 && bytes == 0 {
+		return nil
+	}
+
+	return conn.WriteJSON(map[string]interface{}{
+		"type":          "credit",
+		"acquisitionId": acquisition.ID,
+		"chunks":        chunks,
+		"bytes":         bytes,
+		"windowChunks":  windowChunks,
+		"windowBytes":   windowBytes,
+	})
+}
+
+// acceptChunk stores a validated chunk, updates statistics and acknowledges it.
+// It is shared by the JSON data_chunk path and the binary frame path.
+func (ws *WebSocketHandler) acceptChunk(conn *streamConn, acquisition *models.Acquisition, chunk queuedChunk) error {
+	chunkIndex, channel, payload := chunk.index, chunk.channel, chunk.payload
+
+	receipt, err := ws.ingester.ingest(acquisition, chunk)
 	if err != nil {
-		return ws.sendErrorMessage(conn, "DECODE_ERROR", "Failed to decode data", err.Error())
+		var ingestErr *ingestError
+		if errors.As(err, &ingestErr) {
+			return ws.sendErrorMessage(conn, ingestErr.code, ingestErr.message, ingestErr.err.Error())
+		}
+		return err
+	}
+
+	// A retransmission of a stored chunk is acknowledged without being counted
+	if !receipt.New {
+		return conn.WriteJSON(map[string]interface{}{
+			"type":             "ack",
+			"chunkIndex":       chunkIndex,
+			"channel":          channel,
+			"received":         true,
+			"processingStatus": "duplicate",
+		})
 	}
 
 	// Update statistics
-	*totalChunks = chunkMsg.ChunkIndex + 1
-	*totalBytes += int64(len(decodedData))
+	conn.totalChunks++
+	conn.totalBytes += int64(len(payload))
 
-	// Update acquisition statistics
-	ws.sessionManager.UpdateAcquisitionStats(acquisition.ID, *totalChunks, *totalBytes)
+	// Ask the client to resend chunks skipped by this one
+	if receipt.Gap != nil {
+		if err := ws.sendNack(conn, acquisition, []models.ChunkRange{*receipt.Gap}); err != nil {
+			return err
+		}
+	} else if len(receipt.Gaps) > 0 && chunkIndex%retransmitRequestInterval == 0 {
+		if err := ws.sendRetransmitRequest(conn, acquisition, receipt.Gaps); err != nil {
+			return err
+		}
+	}
 
-	// In a real implementation, you would:
-	// 1. Store the data to persistent storage
-	// 2. Validate data format
-	// 3. Process data if needed
-	// 4. Update progress tracking
+	// In a real implementation, you would also:
+	// 1. Validate data format
+	// 2. Process data if needed
+	// 3. Update progress tracking
 
 	slog.Debug("Data chunk received", 
 		"acquisitionId", acquisition.ID,
-		"chunkIndex", chunkMsg.ChunkIndex,
-		"dataSize", len(decodedData),
-		"totalChunks", *totalChunks,
-		"totalBytes", *totalBytes)
+		"chunkIndex", chunkIndex,
+		"channel", channel,
+		"dataSize", len(payload),
+		"totalChunks", conn.totalChunks,
+		"totalBytes", conn.totalBytes)
 
 	// Send acknowledgment
 	ackMessage := map[string]interface{}{
 		"type":               "ack",
-		"chunkIndex":         chunkMsg.ChunkIndex,
+		"chunkIndex":         chunkIndex,
+		"channel":            channel,
 		"received":           true,
 		"processingStatus":   "validated",
 	}
 
 	// Optionally send processing feedback
-	if chunkMsg.ChunkIndex%10 == 0 { // Every 10th chunk
+	if chunkIndex%10 == 0 { // Every 10th chunk
 		qualityMetrics := map[string]interface{}{
 			"signalStrength": 0.92,
 			"noiseLevel":     0.05,
@@ -237,6 +487,7 @@ func (ws *WebSocketHandler) handleDataChunk(conn *websocket.Conn, acquisition *m
 			"recommendations": []string{"Signal quality is excellent", "Continue current position"},
 		}
 
+		ws.viewers.broadcast(acquisition.ID, feedbackMessage)
 		if err := conn.WriteJSON(feedbackMessage); err != nil {
 			return err
 		}
@@ -245,7 +496,7 @@ func (ws *WebSocketHandler) handleDataChunk(conn *websocket.Conn, acquisition *m
 	return conn.WriteJSON(ackMessage)
 }
 
-func (ws *WebSocketHandler) handleStatusUpdate(conn *websocket.Conn, acquisition *models.Acquisition, data []byte) error {
+func (ws *WebSocketHandler) handleStatusUpdate(conn *streamConn, acquisition *models.Acquisition, data []byte) error {
 	var statusMsg models.StatusUpdateMessage
 	if err := json.Unmarshal(data, &statusMsg); err != nil {
 		return ws.sendErrorMessage(conn, "INVALID_STATUS_UPDATE", "Failed to parse status update", err.Error())
@@ -258,6 +509,8 @@ func (ws *WebSocketHandler) handleStatusUpdate(conn *websocket.Conn, acquisition
 		})
 	}
 
+	ws.viewers.broadcast(acquisition.ID, statusMsg)
+
 	slog.Info("Status update received", 
 		"acquisitionId", acquisition.ID,
 		"status", statusMsg.Status,
@@ -273,7 +526,7 @@ func (ws *WebSocketHandler) handleStatusUpdate(conn *websocket.Conn, acquisition
 	return conn.WriteJSON(ackMessage)
 }
 
-func (ws *WebSocketHandler) handleClientError(conn *websocket.Conn, acquisition *models.Acquisition, data []byte) error {
+func (ws *WebSocketHandler) handleClientError(conn *streamConn, acquisition *models.Acquisition, data []byte) error {
 	var errorMsg map[string]interface{}
 	if err := json.Unmarshal(data, &errorMsg); err != nil {
 		return ws.sendErrorMessage(conn, "INVALID_ERROR_MESSAGE", "Failed to parse error message", err.Error())
@@ -309,40 +562,82 @@ func (ws *WebSocketHandler) handleClientError(conn *websocket.Conn, acquisition
 	return conn.WriteJSON(response)
 }
 
-func (ws *WebSocketHandler) sendErrorMessage(conn *websocket.Conn, errorCode, errorMessage, details string) error {
-	errorResponse := map[string]interface{}{
-		"type":         "server_error",
-		"errorCode":    errorCode,
-		"errorMessage": errorMessage,
-		"details":      details,
-		"timestamp":    time.Now(),
-	}
-
-	return conn.WriteJSON(errorResponse)
+// broadcastIngestStatus tells viewers whether the uploading client is connected
+func (ws *WebSocketHandler) broadcastIngestStatus(acquisition *models.Acquisition, connected bool) {
+	ws.viewers.broadcast(acquisition.ID, map[string]interface{}{
+		"type":          "ingest_status",
+		"acquisitionId": acquisition.ID,
+		"connected":     connected,
+		"timestamp":     time.Now(),
+	})
 }
 
-func (ws *WebSocketHandler) validateChecksum(data, expectedChecksum string) bool {
-	// Decode base64 data
-	decodedData, err := base64.StdEncoding.DecodeString(data)
+// sendResumeAck reports the last chunk index that is durably stored, so the
+// client resumes with the chunk after it. Chunks received out of order beyond
+// that point may be sent again; they are acknowledged as duplicates.
+func (ws *WebSocketHandler) sendResumeAck(conn *streamConn, acquisition *models.Acquisition) error {
+	writer, err := ws.storage.Get(acquisition.ID)
 	if err != nil {
-		return false
+		return ws.sendErrorMessage(conn, "STORAGE_ERROR", "Acquisition storage unavailable", err.Error())
+	}
+
+	if err := writer.Sync(); err != nil {
+		return ws.sendErrorMessage(conn, "STORAGE_ERROR", "Failed to sync acquisition storage", err.Error())
+	}
+	nextChunk := writer.NextIndex()
+
+	session, _ := ws.sessionManager.GetSession(acquisition.SessionID)
+	reconnections := 0
+	if session != nil {
+		reconnections = session.Statistics.ReconnectionCount
 	}
 
-	// Calculate SHA-256 hash
-	hash := sha256.Sum256(decodedData)
-	actualChecksum := hex.EncodeToString(hash[:])
+	slog.Info("Stream resumed",
+		"acquisitionId", acquisition.ID,
+		"nextChunkIndex", nextChunk,
+		"reconnectionCount", reconnections)
+
+	return conn.WriteJSON(map[string]interface{}{
+		"type":              "resume_ack",
+		"acquisitionId":     acquisition.ID,
+		"lastStoredChunk":   nextChunk - 1,
+		"nextChunkIndex":    nextChunk,
+		"missingRanges":     ws.sessionManager.ChunkGaps(acquisition.ID),
+		"reconnectionCount": reconnections,
+	})
+}
 
-	return actualChecksum == expectedChecksum
+// sendNack reports newly detected missing chunk ranges
+func (ws *WebSocketHandler) sendNack(conn *streamConn, acquisition *models.Acquisition, missing []models.ChunkRange) error {
+	return conn.WriteJSON(map[string]interface{}{
+		"type":          "nack",
+		"acquisitionId": acquisition.ID,
+		"missingRanges": missing,
+		"reason":        "gap_detected",
+	})
 }
 
-// Helper function to extract acquisition ID from URL path
-func extractAcquisitionID(path string) string {
-	// This is a simple implementation - in practice, you'd use your router's parameter extraction
-	// For path like "/api/webusb/stream/acq_12345", this extracts "acq_12345"
-	parts := strings.Split(path, "/")
-	if len(parts) >= 4 && parts[len(parts)-2] == "stream" {
-		return parts[len(parts)-1]
+// sendRetransmitRequest re-requests every chunk range that is still missing
+func (ws *WebSocketHandler) sendRetransmitRequest(conn *streamConn, acquisition *models.Acquisition, missing []models.ChunkRange) error {
+	if len(missing) > maxRetransmitRanges {
+		missing = missing[:maxRetransmitRanges]
 	}
-	return ""
+
+	return conn.WriteJSON(map[string]interface{}{
+		"type":          "retransmit_request",
+		"acquisitionId": acquisition.ID,
+		"missingRanges": missing,
+	})
 }
 
+func (ws *WebSocketHandler) sendErrorMessage(conn *streamConn, errorCode, errorMessage, details string) error {
+	errorResponse := map[string]interface{}{
+		"type":         "server_error",
+		"errorCode":    errorCode,
+		"errorMessage": errorMessage,
+		"details":      details,
+		"timestamp":    time.Now(),
+	}
+
+	return conn.WriteJSON(errorResponse)
+}
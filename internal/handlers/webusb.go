@@ -1,25 +1,270 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"acquire-app/internal/compression"
+	"acquire-app/internal/config"
 	"acquire-app/internal/models"
 	"acquire-app/internal/services"
+	"acquire-app/internal/storage"
+	"acquire-app/internal/store"
 )
 
+// defaultExpectedDataSize is the storage reserved for an acquisition whose
+// size cannot be estimated
+const defaultExpectedDataSize = 10 << 20
+
 type WebusbHandler struct {
 	sessionManager *services.SessionManager
+	storage        *storage.Manager
+	flow           *services.FlowController
+	viewers        *ViewerHub
+	ingester       *chunkIngester
+	streamHandler  *WebSocketHandler
+
+	// compressionEnabled is whether acquisitions may negotiate compressed
+	// chunk payloads
+	compressionEnabled bool
+	// anonymousDevices is whether devices without a serial number may
+	// register
+	anonymousDevices bool
+
+	quota     services.StorageQuota
+	retention services.RetentionPolicy
+	// archive receives expired acquisitions; nil if they are deleted instead
+	archive storage.Backend
+}
+
+func NewWebusbHandler(cfg *config.Config) (*WebusbHandler, error) {
+	repository, err := openRepository(cfg.SessionStore)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionManager, err := services.NewSessionManager(repository)
+	if err != nil {
+		repository.Close()
+		return nil, err
+	}
+
+	// The local backend stores into the same directory the acquisitions'
+	// DataPath points into, so stored files stay where the writer staged them
+	backend, err := openBackend(cfg, "./data/acquisitions", cfg.S3.Prefix)
+	if err != nil {
+		sessionManager.Close()
+		return nil, err
+	}
+
+	var archive storage.Backend
+	switch cfg.Retention.Action {
+	case "delete":
+	case "archive":
+		archive, err = openBackend(cfg, cfg.Retention.ArchivePath, cfg.Retention.ArchivePrefix)
+		if err != nil {
+			sessionManager.Close()
+			return nil, err
+		}
+	default:
+		sessionManager.Close()
+		return nil, fmt.Errorf("unknown retention action %q, expected delete or archive", cfg.Retention.Action)
+	}
+
+	storageManager := storage.NewManager(backend)
+	flow := services.NewFlowController(processingQueueCapacity)
+	viewers := NewViewerHub()
+	quota := services.StorageQuota{
+		Global:    cfg.StorageQuota,
+		PerDevice: cfg.DeviceStorageQuota,
+	}
+	h := &WebusbHandler{
+		sessionManager:     sessionManager,
+		storage:            storageManager,
+		flow:               flow,
+		viewers:            viewers,
+		ingester:           newChunkIngester(sessionManager, storageManager, viewers, quota),
+		streamHandler:      NewWebSocketHandler(sessionManager, storageManager, flow, viewers, quota),
+		compressionEnabled: cfg.CompressionEnabled,
+		anonymousDevices:   cfg.AnonymousDevices,
+		quota:              quota,
+		retention: services.RetentionPolicy{
+			MaxAge: time.Duration(cfg.Retention.Days) * 24 * time.Hour,
+		},
+		archive: archive,
+	}
+	sessionManager.OnAutoStop(h.completeAcquisition)
+	h.continueAcquisitions()
+	h.recoverAcquisitions()
+	return h, nil
+}
+
+// completeAcquisition finishes an acquisition the session manager stopped
+// because its requested duration elapsed, the way StopAcquisition does for a
+// client's stop request, and tells its stream clients that it is complete
+func (h *WebusbHandler) completeAcquisition(acquisition *models.Acquisition) {
+	if err := h.storage.Close(acquisition.ID); err != nil {
+		slog.Error("Failed to finalize acquisition storage", "acquisitionId", acquisition.ID, "error", err)
+	}
+
+	h.streamHandler.notifyStreams(acquisition.ID, map[string]interface{}{
+		"type":          "acquisition_complete",
+		"acquisitionId": acquisition.ID,
+		"reason":        services.StopReasonDurationReached,
+		"finalStats":    acquisition.Statistics,
+		"dataLocation":  fmt.Sprintf("/api/webusb/acquisition/%s/data", acquisition.ID),
+	})
+
+	h.viewers.closeAcquisition(acquisition.ID, map[string]interface{}{
+		"type":          "acquisition_stopped",
+		"acquisitionId": acquisition.ID,
+		"reason":        services.StopReasonDurationReached,
+		"finalStats":    acquisition.Statistics,
+	})
+}
+
+// continueAcquisitions reopens the storage of acquisitions that carry on
+// after a restart, so their clients can reconnect and keep sending chunks
+// from where the stored data ends. An acquisition whose storage cannot be
+// reopened is interrupted, and its data is then recovered like that of any
+// other interrupted acquisition.
+func (h *WebusbHandler) continueAcquisitions() {
+	for acquisitionID, acquisition := range h.sessionManager.GetAcquisitions() {
+		if !acquisition.Status.Ongoing() {
+			continue
+		}
+
+		err := h.restoreStream(acquisitionID, acquisition.DataPath)
+		if err == nil {
+			continue
+		}
+		slog.Error("Failed to continue acquisition after restart", "acquisitionId", acquisitionID, "error", err)
+		if err := h.sessionManager.InterruptAcquisition(acquisitionID); err != nil {
+			slog.Error("Failed to interrupt acquisition", "acquisitionId", acquisitionID, "error", err)
+		}
+	}
+}
+
+// restoreStream reopens the storage writer of an acquisition and rebuilds its
+// chunk bookkeeping from the chunks stored so far
+func (h *WebusbHandler) restoreStream(acquisitionID, dataPath string) error {
+	writer, err := h.storage.Open(acquisitionID, dataPath)
+	if err != nil {
+		return err
+	}
+
+	index := writer.Index()
+	chunks := make([]int64, len(index.Chunks))
+	for i, chunk := range index.Chunks {
+		chunks[i] = chunk.Index
+	}
+	restored, err := h.sessionManager.RestoreStream(acquisitionID, chunks, index.TotalBytes)
+	if err != nil {
+		// Ended meanwhile, e.g. by its timer: finish the data as a stop would
+		if closeErr := h.storage.Close(acquisitionID); closeErr != nil {
+			slog.Error("Failed to finalize acquisition storage", "acquisitionId", acquisitionID, "error", closeErr)
+		}
+		return err
+	}
+
+	slog.Info("Continuing acquisition after restart",
+		"acquisitionId", acquisitionID,
+		"status", restored.Status,
+		"totalChunks", restored.Statistics.TotalChunks,
+		"stopAt", restored.StopAt)
+	return nil
+}
+
+// recoverAcquisitions finishes the storage of acquisitions whose writer was
+// still open when the previous server process stopped, and records which of
+// their chunks survived. An acquisition that fails to recover keeps its
+// journal and is tried again on the next start.
+func (h *WebusbHandler) recoverAcquisitions() {
+	for acquisitionID, acquisition := range h.sessionManager.GetAcquisitions() {
+		if acquisition.Status.Ongoing() {
+			continue
+		}
+
+		index, err := h.storage.Recover(acquisitionID, acquisition.DataPath)
+		if err != nil {
+			slog.Error("Failed to recover acquisition data", "acquisitionId", acquisitionID, "error", err)
+			continue
+		}
+		if index == nil {
+			continue
+		}
+
+		chunks := make([]int64, len(index.Chunks))
+		for i, chunk := range index.Chunks {
+			chunks[i] = chunk.Index
+		}
+		recovered, err := h.sessionManager.RecordRecovery(acquisitionID, chunks, index.TotalBytes)
+		if err != nil {
+			slog.Error("Failed to record recovered acquisition", "acquisitionId", acquisitionID, "error", err)
+			continue
+		}
+
+		slog.Info("Recovered acquisition data",
+			"acquisitionId", acquisitionID,
+			"status", recovered.Status,
+			"totalChunks", recovered.Statistics.TotalChunks,
+			"intactChunks", recovered.Statistics.IntactChunks,
+			"missingChunks", recovered.Statistics.MissingChunks)
+	}
 }
 
-func NewWebusbHandler() *WebusbHandler {
-	return &WebusbHandler{
-		sessionManager: services.NewSessionManager(),
+// compressionCodecs returns the chunk payload codecs clients may offer, none
+// if compression is disabled
+func (h *WebusbHandler) compressionCodecs() []string {
+	if !h.compressionEnabled {
+		return []string{}
+	}
+	return compression.Supported()
+}
+
+// openBackend creates a storage backend of the kind configured by
+// STORAGE_BACKEND, rooted at localRoot or s3Prefix
+func openBackend(cfg *config.Config, localRoot, s3Prefix string) (storage.Backend, error) {
+	switch cfg.StorageBackend {
+	case "local":
+		return storage.NewLocalBackend(localRoot), nil
+	case "s3":
+		backend, err := storage.NewS3Backend(storage.S3Config{
+			Endpoint:        cfg.S3.Endpoint,
+			Region:          cfg.S3.Region,
+			Bucket:          cfg.S3.Bucket,
+			AccessKeyID:     cfg.S3.AccessKeyID,
+			SecretAccessKey: cfg.S3.SecretAccessKey,
+			Prefix:          s3Prefix,
+			PathStyle:       cfg.S3.PathStyle,
+			Capacity:        cfg.S3.Capacity,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return backend, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q, expected local or s3", cfg.StorageBackend)
 	}
 }
 
+// openRepository opens the session repository configured by SESSION_STORE
+func openRepository(path string) (services.Repository, error) {
+	if path == config.MemorySessionStore {
+		return services.NewMemoryRepository(), nil
+	}
+
+	repository, err := store.OpenBolt(path)
+	if err != nil {
+		return nil, err
+	}
+	return repository, nil
+}
+
 // RegisterDevice handles POST /api/webusb/devices/register
 func (h *WebusbHandler) RegisterDevice(c *fiber.Ctx) error {
 	var req models.DeviceRegistrationRequest
@@ -32,8 +277,9 @@ func (h *WebusbHandler) RegisterDevice(c *fiber.Ctx) error {
 		})
 	}
 
-	// Validate required fields
-	if req.DeviceInfo.ProductName == "" || req.DeviceInfo.SerialNumber == "" {
+	// Validate required fields. Devices without a serial number are only
+	// registered, anonymously, if the server is configured to allow it.
+	if req.DeviceInfo.ProductName == "" || (req.DeviceInfo.SerialNumber == "" && !h.anonymousDevices) {
 		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
 			Error:   "Missing required device information",
 			Code:    "MISSING_DEVICE_INFO",
@@ -42,7 +288,7 @@ func (h *WebusbHandler) RegisterDevice(c *fiber.Ctx) error {
 	}
 
 	// Create new session
-	session, err := h.sessionManager.CreateSession(req.DeviceInfo, req.Capabilities)
+	session, err := h.sessionManager.CreateSession(req.DeviceInfo, req.Capabilities, req.ConnectionDetails)
 	if err != nil {
 		slog.Error("Failed to create session", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
@@ -60,13 +306,11 @@ func (h *WebusbHandler) RegisterDevice(c *fiber.Ctx) error {
 		ServerConfig: models.ServerConfig{
 			BufferSize:         8192,
 			Timeout:            5000,
-			CompressionEnabled: true,
-		},
-		AcquisitionSettings: models.AcquisitionSettings{
-			SampleRate: 44100,
-			BitDepth:   16,
-			Channels:   1,
+			CompressionEnabled: h.compressionEnabled,
+			CompressionCodecs:  h.compressionCodecs(),
+			SupportedFormats:   supportedFormats(),
 		},
+		AcquisitionSettings: session.AcquisitionSettings,
 	}
 
 	slog.Info("Device registered successfully", 
@@ -100,9 +344,14 @@ func (h *WebusbHandler) ConnectDevice(c *fiber.Ctx) error {
 		})
 	}
 
+	// Closed and expired sessions cannot be revived
+	if err := h.sessionManager.ActivateSession(req.SessionID); err != nil {
+		slog.Warn("Refused to connect device", "sessionId", req.SessionID, "error", err)
+		return stateConflict(c, err)
+	}
+
 	// Update session with connection status
 	err = h.sessionManager.UpdateSession(req.SessionID, func(s *models.Session) {
-		s.Status = "active"
 		s.DeviceConnected = req.ConnectionStatus.Connected
 		s.DeviceHealth.Temperature = req.DeviceState.Temperature
 		s.DeviceHealth.BatteryLevel = req.DeviceState.BatteryLevel
@@ -158,7 +407,15 @@ func (h *WebusbHandler) DisconnectDevice(c *fiber.Ctx) error {
 	}
 
 	// Close session
-	err := h.sessionManager.CloseSession(req.SessionID)
+	reason := req.DisconnectionReason
+	if reason == "" {
+		reason = "device disconnected"
+	}
+	err := h.sessionManager.CloseSession(req.SessionID, reason)
+	if errors.Is(err, services.ErrInvalidTransition) {
+		slog.Warn("Refused to close session", "sessionId", req.SessionID, "error", err)
+		return stateConflict(c, err)
+	}
 	if err != nil {
 		slog.Error("Failed to close session", "sessionId", req.SessionID, "error", err)
 		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
@@ -168,11 +425,14 @@ func (h *WebusbHandler) DisconnectDevice(c *fiber.Ctx) error {
 		})
 	}
 
+	// Closing the session stops its acquisitions, so flush their data to disk
+	dataPreserved := h.releaseInactiveAcquisitions() == nil
+
 	response := models.DeviceDisconnectionResponse{
 		Success:       true,
 		Message:       "Device disconnected successfully",
 		SessionClosed: true,
-		DataPreserved: true,
+		DataPreserved: dataPreserved,
 	}
 
 	slog.Info("Device disconnected successfully", 
@@ -196,7 +456,7 @@ func (h *WebusbHandler) StartAcquisition(c *fiber.Ctx) error {
 	}
 
 	// Validate session exists
-	_, err := h.sessionManager.GetSession(req.SessionID)
+	session, err := h.sessionManager.GetSession(req.SessionID)
 	if err != nil {
 		slog.Error("Session not found", "sessionId", req.SessionID, "error", err)
 		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
@@ -206,8 +466,79 @@ func (h *WebusbHandler) StartAcquisition(c *fiber.Ctx) error {
 		})
 	}
 
+	if req.AcquisitionParams.Duration < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Error:   "Invalid acquisition duration",
+			Code:    "INVALID_REQUEST",
+			Details: "Duration must not be negative; use 0 to record until stopped",
+		})
+	}
+
+	// Only accept formats the stored data can be served back as
+	format := strings.ToLower(req.AcquisitionParams.Format)
+	if format == "" {
+		format = "raw"
+	}
+	if _, supported := contentTypes[format]; !supported {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Error:   "Unsupported acquisition format",
+			Code:    "UNSUPPORTED_FORMAT",
+			Details: fmt.Sprintf("Format %q is not supported; supported formats: %s", req.AcquisitionParams.Format, strings.Join(supportedFormats(), ", ")),
+		})
+	}
+	req.AcquisitionParams.Format = format
+
+	// Pick the codec chunk payloads will be compressed with
+	codec, err := compression.Negotiate(h.compressionEnabled && req.AcquisitionParams.Compression, req.AcquisitionParams.CompressionCodecs)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Error:   "Unsupported compression",
+			Code:    "UNSUPPORTED_COMPRESSION",
+			Details: fmt.Sprintf("%v; supported codecs: %s", err, strings.Join(compression.Supported(), ", ")),
+		})
+	}
+
+	// Refuse to start a recording that would not fit in the storage quota
+	expectedSize := expectedDataSize(req.AcquisitionParams, session.Capabilities)
+	usage, err := storageUsage(h.sessionManager, h.storage, session.DeviceID)
+	if err != nil {
+		slog.Error("Failed to measure storage usage", "sessionId", req.SessionID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Error:   "Failed to measure storage usage",
+			Code:    "STORAGE_ERROR",
+			Details: err.Error(),
+		})
+	}
+	if err := h.quota.Check(usage, expectedSize); err != nil {
+		slog.Warn("Acquisition refused by storage quota", "sessionId", req.SessionID, "deviceId", session.DeviceID, "error", err)
+		return c.Status(fiber.StatusInsufficientStorage).JSON(models.ErrorResponse{
+			Error:   "Storage quota exceeded",
+			Code:    "STORAGE_QUOTA_EXCEEDED",
+			Details: err.Error(),
+		})
+	}
+
 	// Create acquisition
-	acquisition, err := h.sessionManager.CreateAcquisition(req.SessionID, req.AcquisitionParams, req.Metadata)
+	acquisition, err := h.sessionManager.CreateAcquisition(req.SessionID, req.AcquisitionParams, req.Metadata, codec)
+	if errors.Is(err, services.ErrInvalidTransition) {
+		slog.Warn("Refused to start acquisition", "sessionId", req.SessionID, "error", err)
+		return stateConflict(c, err)
+	}
+	if errors.Is(err, services.ErrUnknownEndpoint) || errors.Is(err, services.ErrAmbiguousEndpoint) {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Error:   "Invalid endpoint",
+			Code:    "INVALID_ENDPOINT",
+			Details: err.Error(),
+		})
+	}
+	if errors.Is(err, services.ErrEndpointBusy) {
+		slog.Warn("Refused to start acquisition", "sessionId", req.SessionID, "error", err)
+		return c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{
+			Error:   "Endpoint is already recording",
+			Code:    "ENDPOINT_BUSY",
+			Details: err.Error(),
+		})
+	}
 	if err != nil {
 		slog.Error("Failed to create acquisition", "sessionId", req.SessionID, "error", err)
 		return c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{
@@ -217,29 +548,56 @@ func (h *WebusbHandler) StartAcquisition(c *fiber.Ctx) error {
 		})
 	}
 
-	// Build WebSocket endpoint URL
-	baseURL := fmt.Sprintf("%s://%s", c.Protocol(), c.Hostname())
-	if port := c.Port(); port != "" {
-		baseURL += ":" + port
+	// Open the storage writer for the acquisition data
+	if _, err := h.storage.Open(acquisition.ID, acquisition.DataPath); err != nil {
+		slog.Error("Failed to open acquisition storage", "acquisitionId", acquisition.ID, "error", err)
+		h.sessionManager.StopAcquisition(acquisition.ID, "storage_error")
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Error:   "Failed to open acquisition storage",
+			Code:    "STORAGE_ERROR",
+			Details: err.Error(),
+		})
+	}
+
+	// Build WebSocket endpoint URL, using wss:// when served over TLS
+	wsScheme := "ws"
+	if c.Protocol() == "https" {
+		wsScheme = "wss"
 	}
-	streamEndpoint := fmt.Sprintf("ws://%s/api/webusb/stream/%s", c.Hostname(), acquisition.ID)
+	streamEndpoint := fmt.Sprintf("%s://%s/api/webusb/stream/%s", wsScheme, c.Hostname(), acquisition.ID)
 
 	response := models.AcquisitionStartResponse{
 		Success:          true,
 		AcquisitionID:    acquisition.ID,
 		StreamEndpoint:   streamEndpoint,
-		ExpectedDataSize: 10485760, // 10MB default
+		ExpectedDataSize: expectedSize,
 		ChunkSize:        4096,     // 4KB chunks
+		ResumeToken:      acquisition.ResumeToken,
+		Compression:      acquisition.Compression,
+		Endpoint:         acquisition.Endpoint,
 	}
 
 	slog.Info("Acquisition started successfully", 
 		"acquisitionId", acquisition.ID, 
 		"sessionId", req.SessionID,
-		"mode", req.AcquisitionParams.Mode)
+		"mode", req.AcquisitionParams.Mode,
+		"format", format,
+		"compression", codec,
+		"endpoint", acquisition.Endpoint)
 
 	return c.JSON(response)
 }
 
+// expectedDataSize estimates how much data an acquisition will store: its
+// duration at the device's maximum data rate, or defaultExpectedDataSize for
+// open-ended recordings
+func expectedDataSize(params models.AcquisitionParams, capabilities models.DeviceCapabilities) int64 {
+	if params.Duration > 0 && capabilities.MaxDataRate > 0 {
+		return int64(params.Duration) * capabilities.MaxDataRate
+	}
+	return defaultExpectedDataSize
+}
+
 // StopAcquisition handles POST /api/webusb/acquisition/stop
 func (h *WebusbHandler) StopAcquisition(c *fiber.Ctx) error {
 	var req models.AcquisitionStopRequest
@@ -254,6 +612,10 @@ func (h *WebusbHandler) StopAcquisition(c *fiber.Ctx) error {
 
 	// Stop acquisition
 	acquisition, err := h.sessionManager.StopAcquisition(req.AcquisitionID, req.Reason)
+	if errors.Is(err, services.ErrInvalidTransition) {
+		slog.Warn("Refused to stop acquisition", "acquisitionId", req.AcquisitionID, "error", err)
+		return stateConflict(c, err)
+	}
 	if err != nil {
 		slog.Error("Failed to stop acquisition", "acquisitionId", req.AcquisitionID, "error", err)
 		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
@@ -263,6 +625,24 @@ func (h *WebusbHandler) StopAcquisition(c *fiber.Ctx) error {
 		})
 	}
 
+	// Flush and fsync everything received for this acquisition
+	if err := h.storage.Close(req.AcquisitionID); err != nil {
+		slog.Error("Failed to finalize acquisition storage", "acquisitionId", req.AcquisitionID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Error:   "Failed to finalize acquisition data",
+			Code:    "STORAGE_ERROR",
+			Details: err.Error(),
+		})
+	}
+
+	// Let anyone watching know the recording is over
+	h.viewers.closeAcquisition(req.AcquisitionID, map[string]interface{}{
+		"type":          "acquisition_stopped",
+		"acquisitionId": req.AcquisitionID,
+		"reason":        req.Reason,
+		"finalStats":    acquisition.Statistics,
+	})
+
 	response := models.AcquisitionStopResponse{
 		Success:      true,
 		Message:      "Acquisition stopped successfully",
@@ -278,6 +658,44 @@ func (h *WebusbHandler) StopAcquisition(c *fiber.Ctx) error {
 	return c.JSON(response)
 }
 
+// GetAcquisitionStatus handles GET /api/webusb/acquisition/{acquisitionId}/status
+func (h *WebusbHandler) GetAcquisitionStatus(c *fiber.Ctx) error {
+	acquisitionID := c.Params("acquisitionId")
+
+	acquisition, err := h.sessionManager.GetAcquisition(acquisitionID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Error:   "Acquisition not found",
+			Code:    "ACQUISITION_NOT_FOUND",
+			Details: err.Error(),
+		})
+	}
+
+	return c.JSON(acquisitionStatus(acquisition))
+}
+
+// acquisitionStatus describes an acquisition for API responses
+func acquisitionStatus(acquisition *models.Acquisition) models.AcquisitionStatusResponse {
+	response := models.AcquisitionStatusResponse{
+		AcquisitionID: acquisition.ID,
+		SessionID:     acquisition.SessionID,
+		Status:        acquisition.Status,
+		Endpoint:      acquisition.Endpoint,
+		StartTime:     acquisition.StartTime,
+		EndTime:       acquisition.EndTime,
+		StopAt:        acquisition.StopAt,
+		Statistics:    acquisition.Statistics,
+		Flagged:       acquisition.Flagged,
+		ArchivedAt:    acquisition.ArchivedAt,
+		History:       acquisition.History,
+		Pauses:        acquisition.Pauses,
+	}
+	if !acquisition.Status.Ongoing() && acquisition.ArchivedAt == nil {
+		response.DataLocation = fmt.Sprintf("/api/webusb/acquisition/%s/data", acquisition.ID)
+	}
+	return response
+}
+
 // GetSessionStatus handles GET /api/webusb/sessions/{sessionId}/status
 func (h *WebusbHandler) GetSessionStatus(c *fiber.Ctx) error {
 	sessionID := c.Params("sessionId")
@@ -300,14 +718,23 @@ func (h *WebusbHandler) GetSessionStatus(c *fiber.Ctx) error {
 	}
 
 	response := models.SessionStatusResponse{
-		SessionID:          session.ID,
-		Status:             session.Status,
-		DeviceConnected:    session.DeviceConnected,
-		CurrentAcquisition: session.CurrentAcquisition,
-		StartTime:          session.StartTime,
-		LastActivity:       session.LastActivity,
-		Statistics:         session.Statistics,
-		DeviceHealth:       session.DeviceHealth,
+		SessionID:       session.ID,
+		Status:          session.Status,
+		DeviceConnected: session.DeviceConnected,
+		StartTime:       session.StartTime,
+		LastActivity:    session.LastActivity,
+		Statistics:      session.Statistics,
+		DeviceHealth:    session.DeviceHealth,
+		Transitions:     session.Transitions,
+		Acquisitions:    []models.AcquisitionStatusResponse{},
+	}
+	var newest time.Time
+	for _, acquisition := range h.sessionManager.SessionAcquisitions(sessionID) {
+		response.Acquisitions = append(response.Acquisitions, acquisitionStatus(acquisition))
+		if !acquisition.StartTime.Before(newest) {
+			newest = acquisition.StartTime
+			response.CurrentAcquisition = acquisition.ID
+		}
 	}
 
 	return c.JSON(response)
@@ -346,9 +773,17 @@ func (h *WebusbHandler) ProcessHeartbeat(c *fiber.Ctx) error {
 	}
 
 	// Prepare server state and instructions
+	deviceID := ""
+	if session, err := h.sessionManager.GetSession(sessionID); err == nil {
+		deviceID = session.DeviceID
+	}
+	usage, err := storageUsage(h.sessionManager, h.storage, deviceID)
+	if err != nil {
+		slog.Warn("Failed to measure storage usage", "sessionId", sessionID, "error", err)
+	}
 	serverState := models.ServerState{
-		ProcessingQueue:    len(h.sessionManager.GetActiveAcquisitions()),
-		StorageUtilization: 0.23, // This would be calculated from actual storage usage
+		ProcessingQueue:    int(h.flow.QueueDepth()),
+		StorageUtilization: h.quota.Utilization(usage),
 		SystemHealth:       "optimal",
 	}
 
@@ -371,7 +806,7 @@ func (h *WebusbHandler) ProcessHeartbeat(c *fiber.Ctx) error {
 	return c.JSON(response)
 }
 
-// Helper methods for WebSocket support (to be used with gorilla/websocket)
+// GetSessionManager exposes the shared session manager
 func (h *WebusbHandler) GetSessionManager() *services.SessionManager {
 	return h.sessionManager
 }
@@ -383,4 +818,71 @@ func (h *WebusbHandler) CleanupExpiredSessions() {
 	if cleaned > 0 {
 		slog.Info("Cleaned up expired sessions", "count", cleaned)
 	}
+
+	if err := h.releaseInactiveAcquisitions(); err != nil {
+		slog.Error("Failed to close storage for expired acquisitions", "error", err)
+	}
+}
+
+// Close flushes and closes the storage of every acquisition still being
+// written and persists the final session state. Acquisitions recording for a
+// requested duration carry on after a restart, so their storage is
+// suspended rather than finalized.
+func (h *WebusbHandler) Close() error {
+	var err error
+	for _, acquisitionID := range h.storage.OpenAcquisitions() {
+		closeStorage := h.storage.Close
+		if acquisition, getErr := h.sessionManager.GetAcquisition(acquisitionID); getErr == nil &&
+			acquisition.Status.Ongoing() && acquisition.StopAt != nil {
+			closeStorage = h.storage.Suspend
+		}
+		if closeErr := closeStorage(acquisitionID); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	if closeErr := h.sessionManager.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// stateConflict sends the response for an operation that the state of a
+// session or acquisition does not allow
+func stateConflict(c *fiber.Ctx, err error) error {
+	return c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{
+		Error:   "Invalid state transition",
+		Code:    "INVALID_STATE_TRANSITION",
+		Details: err.Error(),
+	})
+}
+
+// releaseInactiveAcquisitions closes the storage writers and viewers of
+// acquisitions that are no longer active, e.g. after their session was closed
+// or expired
+func (h *WebusbHandler) releaseInactiveAcquisitions() error {
+	var firstErr error
+	for _, acquisitionID := range h.storage.OpenAcquisitions() {
+		acquisition, err := h.sessionManager.GetAcquisition(acquisitionID)
+		if err == nil && acquisition.Status.Ongoing() {
+			continue
+		}
+
+		status := "removed"
+		if acquisition != nil {
+			status = string(acquisition.Status)
+		}
+		h.viewers.closeAcquisition(acquisitionID, map[string]interface{}{
+			"type":          "acquisition_stopped",
+			"acquisitionId": acquisitionID,
+			"reason":        status,
+		})
+
+		if err := h.storage.Close(acquisitionID); err != nil {
+			slog.Error("Failed to close acquisition storage", "acquisitionId", acquisitionID, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
 }
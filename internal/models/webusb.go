@@ -10,6 +10,8 @@ type DeviceInfo struct {
 	ManufacturerName string `json:"manufacturerName"`
 	SerialNumber     string `json:"serialNumber"`
 	USBVersion       string `json:"usbVersion"`
+	// DeviceType is the kind of signal the device records, "ecg" or "audio"
+	DeviceType string `json:"deviceType,omitempty"`
 }
 
 type DeviceCapabilities struct {
@@ -20,10 +22,13 @@ type DeviceCapabilities struct {
 }
 
 type EndpointInfo struct {
-	Number        int    `json:"number"`
-	Direction     string `json:"direction"`
-	Type          string `json:"type"`
-	MaxPacketSize int    `json:"maxPacketSize"`
+	// InterfaceNumber is the interface the endpoint belongs to; nil for
+	// the interface of the connection
+	InterfaceNumber *int   `json:"interfaceNumber,omitempty"`
+	Number          int    `json:"number"`
+	Direction       string `json:"direction"`
+	Type            string `json:"type"`
+	MaxPacketSize   int    `json:"maxPacketSize"`
 }
 
 type ConnectionDetails struct {
@@ -31,17 +36,81 @@ type ConnectionDetails struct {
 	Endpoints       []EndpointInfo `json:"endpoints"`
 }
 
+// EndpointBinding is the device interface and endpoint an acquisition
+// records from
+type EndpointBinding struct {
+	InterfaceNumber int `json:"interfaceNumber"`
+	EndpointNumber  int `json:"endpointNumber"`
+}
+
 type DeviceRegistrationRequest struct {
 	DeviceInfo        DeviceInfo        `json:"deviceInfo"`
 	Capabilities      DeviceCapabilities `json:"capabilities"`
 	ConnectionDetails ConnectionDetails `json:"connectionDetails"`
 }
 
+// Device registry structures
+
+// Device is a device known to the server, recognized across sessions by its
+// vendor ID, product ID and serial number
+type Device struct {
+	ID           string             `json:"id"`
+	DeviceInfo   DeviceInfo         `json:"deviceInfo"`
+	Capabilities DeviceCapabilities `json:"capabilities"`
+	FirstSeen    time.Time          `json:"firstSeen"`
+	LastSeen     time.Time          `json:"lastSeen"`
+	// Anonymous devices reported no serial number. They cannot be
+	// recognized when they return, so each registration has its own record.
+	Anonymous bool `json:"anonymous,omitempty"`
+	// LastSessionID is the session the device last registered for
+	LastSessionID string `json:"lastSessionId,omitempty"`
+	// FirmwareHistory lists each firmware version the device reported,
+	// oldest first
+	FirmwareHistory []FirmwareRecord `json:"firmwareHistory,omitempty"`
+	Statistics      DeviceStatistics `json:"statistics"`
+	Notes           []DeviceNote     `json:"notes,omitempty"`
+}
+
+type FirmwareRecord struct {
+	Version   string    `json:"version"`
+	FirstSeen time.Time `json:"firstSeen"`
+}
+
+// DeviceStatistics accumulate over every session of a device
+type DeviceStatistics struct {
+	Sessions     int64 `json:"sessions"`
+	Acquisitions int64 `json:"acquisitions"`
+	TotalChunks  int64 `json:"totalChunks"`
+	TotalBytes   int64 `json:"totalBytes"`
+	// RecordingSeconds is the combined duration of finished acquisitions
+	RecordingSeconds int64 `json:"recordingSeconds"`
+}
+
+// DeviceNote is a note an operator left on a device
+type DeviceNote struct {
+	Time     time.Time `json:"time"`
+	Operator string    `json:"operator,omitempty"`
+	Text     string    `json:"text"`
+}
+
+type DeviceNoteRequest struct {
+	Operator string `json:"operator"`
+	Text     string `json:"text"`
+}
+
+type DeviceListResponse struct {
+	Devices []Device `json:"devices"`
+}
+
 // Server configuration response structures
 type ServerConfig struct {
 	BufferSize          int  `json:"bufferSize"`
 	Timeout             int  `json:"timeout"`
 	CompressionEnabled  bool `json:"compressionEnabled"`
+	// CompressionCodecs lists the chunk payload codecs the server accepts
+	CompressionCodecs []string `json:"compressionCodecs"`
+	// SupportedFormats lists the acquisition formats the server accepts
+	SupportedFormats []string `json:"supportedFormats"`
 }
 
 type AcquisitionSettings struct {
@@ -105,11 +174,19 @@ type DeviceDisconnectionResponse struct {
 
 // Data acquisition structures
 type AcquisitionParams struct {
-	Mode        string `json:"mode"`
+	Mode string `json:"mode"`
+	// Duration is the recording length in seconds; 0 records until stopped
 	Duration    int    `json:"duration"`
 	Format      string `json:"format"`
 	Compression bool   `json:"compression"`
 	Quality     string `json:"quality"`
+	// Interface and Endpoint name the IN endpoint to record from. Either
+	// may be left out: the first registered IN endpoint that matches the
+	// rest is picked.
+	Interface *int `json:"interface,omitempty"`
+	Endpoint  int  `json:"endpoint,omitempty"`
+	// CompressionCodecs lists the codecs the client can send, most preferred first
+	CompressionCodecs []string `json:"compressionCodecs,omitempty"`
 }
 
 type AcquisitionMetadata struct {
@@ -130,6 +207,10 @@ type AcquisitionStartResponse struct {
 	StreamEndpoint   string `json:"streamEndpoint"`
 	ExpectedDataSize int64  `json:"expectedDataSize"`
 	ChunkSize        int    `json:"chunkSize"`
+	ResumeToken      string `json:"resumeToken"`
+	Compression      string `json:"compression"`
+	// Endpoint is the device endpoint the acquisition records from
+	Endpoint *EndpointBinding `json:"endpoint,omitempty"`
 }
 
 type AcquisitionStopRequest struct {
@@ -138,11 +219,26 @@ type AcquisitionStopRequest struct {
 	Timestamp     time.Time `json:"timestamp"`
 }
 
+// ChunkRange is an inclusive range of chunk indices
+type ChunkRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
 type FinalStats struct {
-	TotalChunks     int64 `json:"totalChunks"`
-	TotalBytes      int64 `json:"totalBytes"`
-	Duration        int   `json:"duration"`
-	AverageDataRate int64 `json:"averageDataRate"`
+	TotalChunks     int64        `json:"totalChunks"`
+	TotalBytes      int64        `json:"totalBytes"`
+	Duration        int          `json:"duration"`
+	AverageDataRate int64        `json:"averageDataRate"`
+	DuplicateChunks int64        `json:"duplicateChunks"`
+	MissingChunks   []ChunkRange `json:"missingChunks,omitempty"`
+	// IntactChunks lists the chunk ranges whose data survived a server
+	// restart; only set for acquisitions recovered from their journal
+	IntactChunks []ChunkRange `json:"intactChunks,omitempty"`
+	Complete     bool         `json:"complete"`
+	// PausedDuration is the part of Duration spent paused, in seconds;
+	// AverageDataRate only counts the rest
+	PausedDuration int `json:"pausedDuration,omitempty"`
 }
 
 type AcquisitionStopResponse struct {
@@ -152,6 +248,83 @@ type AcquisitionStopResponse struct {
 	DataLocation string     `json:"dataLocation"`
 }
 
+type AcquisitionStatusResponse struct {
+	AcquisitionID string             `json:"acquisitionId"`
+	SessionID     string             `json:"sessionId"`
+	Status        AcquisitionState   `json:"status"`
+	Endpoint      *EndpointBinding   `json:"endpoint,omitempty"`
+	StartTime     time.Time          `json:"startTime"`
+	EndTime       *time.Time         `json:"endTime,omitempty"`
+	StopAt        *time.Time         `json:"stopAt,omitempty"`
+	Statistics    FinalStats         `json:"statistics"`
+	Flagged       bool               `json:"flagged"`
+	ArchivedAt    *time.Time         `json:"archivedAt,omitempty"`
+	DataLocation  string             `json:"dataLocation,omitempty"`
+	History       []AcquisitionEvent `json:"history,omitempty"`
+	Pauses        []PauseInterval    `json:"pauses,omitempty"`
+}
+
+// DICOMUIDs are the study, series and instance UIDs of an acquisition's
+// DICOM export, kept so that every export describes the same objects
+type DICOMUIDs struct {
+	StudyInstanceUID  string `json:"studyInstanceUid"`
+	SeriesInstanceUID string `json:"seriesInstanceUid"`
+	SOPInstanceUID    string `json:"sopInstanceUid"`
+}
+
+// PauseInterval is a period during which an acquisition was paused
+type PauseInterval struct {
+	Start time.Time `json:"start"`
+	// End is nil while the acquisition is paused
+	End *time.Time `json:"end,omitempty"`
+	// ResumeChunk is the chunk index the stream continues from after the
+	// pause: one past the highest chunk received when it began. Chunks are
+	// refused while paused, so this is where the pause falls in the data.
+	ResumeChunk int64 `json:"resumeChunk,omitempty"`
+}
+
+// AcquisitionEvent is one entry of an acquisition's processing history
+type AcquisitionEvent struct {
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event"`
+	Details string    `json:"details,omitempty"`
+	// From and To are set on events that changed the acquisition's
+	// Status; From is empty for the initial state
+	From AcquisitionState `json:"from,omitempty"`
+	To   AcquisitionState `json:"to,omitempty"`
+}
+
+// AcquisitionSummary is an acquisition as listed in the catalog
+type AcquisitionSummary struct {
+	AcquisitionID string              `json:"acquisitionId"`
+	SessionID     string              `json:"sessionId"`
+	DeviceID      string              `json:"deviceId,omitempty"`
+	Status        AcquisitionState    `json:"status"`
+	StartTime     time.Time           `json:"startTime"`
+	EndTime       *time.Time          `json:"endTime,omitempty"`
+	Metadata      AcquisitionMetadata `json:"metadata"`
+	TotalChunks   int64               `json:"totalChunks"`
+	TotalBytes    int64               `json:"totalBytes"`
+	Complete      bool                `json:"complete"`
+	Flagged       bool                `json:"flagged"`
+	ArchivedAt    *time.Time          `json:"archivedAt,omitempty"`
+}
+
+type AcquisitionListResponse struct {
+	Acquisitions []AcquisitionSummary `json:"acquisitions"`
+	// NextCursor fetches the next page; empty on the last page
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+type AcquisitionFlagRequest struct {
+	Flagged bool `json:"flagged"`
+}
+
+// AcquisitionPauseRequest is the optional body of pause and resume requests
+type AcquisitionPauseRequest struct {
+	Reason string `json:"reason"`
+}
+
 // Session management structures
 type SessionStatistics struct {
 	TotalDataTransferred int64 `json:"totalDataTransferred"`
@@ -168,13 +341,17 @@ type DeviceHealth struct {
 
 type SessionStatusResponse struct {
 	SessionID           string            `json:"sessionId"`
-	Status              string            `json:"status"`
+	Status              SessionState      `json:"status"`
 	DeviceConnected     bool              `json:"deviceConnected"`
+	// CurrentAcquisition is the most recently started of Acquisitions
 	CurrentAcquisition  string            `json:"currentAcquisition"`
 	StartTime           time.Time         `json:"startTime"`
 	LastActivity        time.Time         `json:"lastActivity"`
 	Statistics          SessionStatistics `json:"statistics"`
 	DeviceHealth        DeviceHealth      `json:"deviceHealth"`
+	Transitions         []StateTransition `json:"transitions,omitempty"`
+	// Acquisitions lists the session's ongoing acquisitions, oldest first
+	Acquisitions []AcquisitionStatusResponse `json:"acquisitions"`
 }
 
 // Heartbeat structures
@@ -224,6 +401,38 @@ type DataChunkMessage struct {
 	Timestamp     time.Time `json:"timestamp"`
 }
 
+// HTTP chunk upload structures
+type ChunkBatchUploadRequest struct {
+	Chunks []DataChunkMessage `json:"chunks"`
+}
+
+type ChunkUploadResult struct {
+	ChunkIndex       int64  `json:"chunkIndex"`
+	Channel          uint16 `json:"channel"`
+	ProcessingStatus string `json:"processingStatus"`
+	Code             string `json:"code,omitempty"`
+	Error            string `json:"error,omitempty"`
+}
+
+type ChunkUploadResponse struct {
+	Success          bool         `json:"success"`
+	AcquisitionID    string       `json:"acquisitionId"`
+	ChunkIndex       int64        `json:"chunkIndex"`
+	Channel          uint16       `json:"channel"`
+	ProcessingStatus string       `json:"processingStatus"`
+	MissingRanges    []ChunkRange `json:"missingRanges"`
+}
+
+type ChunkBatchUploadResponse struct {
+	Success       bool                `json:"success"`
+	AcquisitionID string              `json:"acquisitionId"`
+	Accepted      int                 `json:"accepted"`
+	Duplicates    int                 `json:"duplicates"`
+	Rejected      int                 `json:"rejected"`
+	Results       []ChunkUploadResult `json:"results"`
+	MissingRanges []ChunkRange        `json:"missingRanges"`
+}
+
 type StatusUpdateMessage struct {
 	Type          string      `json:"type"`
 	AcquisitionID string      `json:"acquisitionId"`
@@ -239,30 +448,111 @@ type ErrorResponse struct {
 	Details string `json:"details,omitempty"`
 }
 
+// SessionState is the lifecycle state of a session
+type SessionState string
+
+const (
+	// SessionCreated sessions were registered but the device has not
+	// connected yet
+	SessionCreated SessionState = "created"
+	SessionActive  SessionState = "active"
+	SessionClosed  SessionState = "closed"
+	SessionExpired SessionState = "expired"
+)
+
+// AcquisitionState is the lifecycle state of an acquisition
+type AcquisitionState string
+
+const (
+	AcquisitionActive AcquisitionState = "active"
+	// AcquisitionPaused acquisitions are halted by the operator and can be
+	// resumed
+	AcquisitionPaused  AcquisitionState = "paused"
+	AcquisitionStopped AcquisitionState = "stopped"
+	AcquisitionExpired AcquisitionState = "expired"
+	// AcquisitionInterrupted acquisitions lost their stream when the server
+	// stopped
+	AcquisitionInterrupted AcquisitionState = "interrupted"
+)
+
+// Ongoing reports whether an acquisition in this state has not ended yet,
+// whether it is recording or paused
+func (s AcquisitionState) Ongoing() bool {
+	return s == AcquisitionActive || s == AcquisitionPaused
+}
+
+// StateTransition records a change of a session's state. From is empty for
+// the initial state.
+type StateTransition struct {
+	From   string    `json:"from,omitempty"`
+	To     string    `json:"to"`
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason,omitempty"`
+}
+
 // Session store entry
 type Session struct {
 	ID                 string            `json:"id"`
 	DeviceID          string            `json:"deviceId"`
-	Status            string            `json:"status"`
+	Status            SessionState      `json:"status"`
 	DeviceConnected   bool              `json:"deviceConnected"`
-	CurrentAcquisition string           `json:"currentAcquisition,omitempty"`
+	// ActiveAcquisitions lists the IDs of the ongoing acquisitions, oldest
+	// first
+	ActiveAcquisitions []string         `json:"activeAcquisitions,omitempty"`
 	StartTime         time.Time         `json:"startTime"`
 	LastActivity      time.Time         `json:"lastActivity"`
 	Statistics        SessionStatistics `json:"statistics"`
 	DeviceHealth      DeviceHealth      `json:"deviceHealth"`
 	DeviceInfo        DeviceInfo        `json:"deviceInfo"`
 	Capabilities      DeviceCapabilities `json:"capabilities"`
+	// AcquisitionSettings is the sample format handed out at registration
+	AcquisitionSettings AcquisitionSettings `json:"acquisitionSettings"`
+	// ConnectionDetails is the interface and endpoints the device
+	// registered with
+	ConnectionDetails ConnectionDetails `json:"connectionDetails"`
+	// Transitions records every change of Status, oldest first
+	Transitions []StateTransition `json:"transitions,omitempty"`
 }
 
 // Acquisition store entry
 type Acquisition struct {
 	ID          string              `json:"id"`
 	SessionID   string              `json:"sessionId"`
-	Status      string              `json:"status"`
+	Status      AcquisitionState    `json:"status"`
 	StartTime   time.Time           `json:"startTime"`
 	EndTime     *time.Time          `json:"endTime,omitempty"`
 	Parameters  AcquisitionParams   `json:"parameters"`
 	Metadata    AcquisitionMetadata `json:"metadata"`
 	Statistics  FinalStats          `json:"statistics"`
 	DataPath    string              `json:"dataPath"`
+	// StopAt is when the acquisition stops on its own, set when a Duration
+	// was requested
+	StopAt *time.Time `json:"stopAt,omitempty"`
+	// Compression is the codec negotiated for chunk payloads
+	Compression string `json:"compression"`
+	// Endpoint is the device endpoint the acquisition records from; nil
+	// if the device registered no endpoints
+	Endpoint *EndpointBinding `json:"endpoint,omitempty"`
+	// Settings is the sample format of the stored data
+	Settings AcquisitionSettings `json:"settings"`
+	// DeviceID is the device the acquisition was recorded from
+	DeviceID string `json:"deviceId,omitempty"`
+	// DeviceInfo describes that device as it registered for the session
+	DeviceInfo DeviceInfo `json:"deviceInfo"`
+	// DICOMUIDs identify the acquisition in DICOM exports
+	DICOMUIDs *DICOMUIDs `json:"dicomUids,omitempty"`
+	// Flagged acquisitions are kept regardless of the retention policy
+	Flagged bool `json:"flagged"`
+	// ArchivedAt is set once the data was moved to the archive
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
+	// History records what happened to the acquisition, every change of
+	// Status included, oldest first
+	History []AcquisitionEvent `json:"history,omitempty"`
+	// Pauses lists the intervals the acquisition was paused, oldest first
+	Pauses []PauseInterval `json:"pauses,omitempty"`
+
+	// ResumeToken authorizes reconnecting to the stream after a drop. It
+	// is stored so that streams can also be resumed after a restart.
+	ResumeToken       string `json:"resumeToken,omitempty"`
+	StreamConnections int    `json:"streamConnections"`
 }
@@ -0,0 +1,298 @@
+// Package parquet writes Apache Parquet files with a flat schema of required
+// integer columns. Rows are written one row group at a time and the footer
+// last, so a file can be streamed without holding the data set in memory.
+// Column data is PLAIN encoded and snappy compressed, one page per column
+// chunk.
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/klauspost/compress/snappy"
+)
+
+// Type is the physical type of a column
+type Type int32
+
+const (
+	Int32 Type = 1
+	Int64 Type = 2
+)
+
+// createdBy is the application recorded in the file metadata
+const createdBy = "acquire-app"
+
+// Parquet enum values used in the metadata
+const (
+	repetitionRequired       = 0
+	encodingPlain            = 0
+	encodingRLE              = 3
+	codecSnappy              = 1
+	pageData                 = 0
+	convertedTimestampMicros = 10
+)
+
+// convertedInts maps integer widths to the INT_8 ... INT_64 converted types
+var convertedInts = map[int]int32{8: 15, 16: 16, 32: 17, 64: 18}
+
+var (
+	magic = []byte("PAR1")
+
+	ErrSchemaMismatch = errors.New("parquet: values do not match the schema")
+)
+
+// Column describes a required column
+type Column struct {
+	Name string
+	Type Type
+	// IntWidth annotates the column as a signed integer of 8, 16, 32 or 64
+	// bits; other widths leave it unannotated
+	IntWidth int
+	// Timestamp annotates an Int64 column as microseconds since the Unix
+	// epoch, UTC
+	Timestamp bool
+}
+
+// KeyValue is an entry of the file's key-value metadata
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// Writer writes a Parquet file to an underlying writer
+type Writer struct {
+	w        io.Writer
+	columns  []Column
+	metadata []KeyValue
+
+	offset    int64
+	rows      int64
+	rowGroups []rowGroup
+
+	page       []byte
+	compressed []byte
+}
+
+type rowGroup struct {
+	rows    int64
+	columns []columnChunk
+}
+
+type columnChunk struct {
+	offset       int64
+	uncompressed int64
+	compressed   int64
+}
+
+// NewWriter prepares a writer for the given columns. The metadata is stored
+// in the footer. Nothing is written until the first row group or Close.
+func NewWriter(w io.Writer, columns []Column, metadata []KeyValue) *Writer {
+	return &Writer{w: w, columns: columns, metadata: metadata}
+}
+
+// WriteRowGroup writes one row group from one slice of values per column,
+// []int32 for Int32 columns and []int64 for Int64 columns, all of the same
+// length
+func (w *Writer) WriteRowGroup(values ...interface{}) error {
+	if len(values) != len(w.columns) {
+		return fmt.Errorf("%w: %d columns of values for %d columns", ErrSchemaMismatch, len(values), len(w.columns))
+	}
+
+	rows := -1
+	for i, column := range w.columns {
+		n := -1
+		switch v := values[i].(type) {
+		case []int32:
+			if column.Type == Int32 {
+				n = len(v)
+			}
+		case []int64:
+			if column.Type == Int64 {
+				n = len(v)
+			}
+		}
+		if n < 0 || (rows >= 0 && n != rows) {
+			return fmt.Errorf("%w: column %q", ErrSchemaMismatch, column.Name)
+		}
+		rows = n
+	}
+	if rows <= 0 {
+		return nil
+	}
+
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	group := rowGroup{rows: int64(rows)}
+	for i := range w.columns {
+		chunk, err := w.writeColumnChunk(values[i], rows)
+		if err != nil {
+			return err
+		}
+		group.columns = append(group.columns, chunk)
+	}
+	w.rowGroups = append(w.rowGroups, group)
+	w.rows += int64(rows)
+	return nil
+}
+
+// Close writes the footer. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	footer := w.footer()
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(len(footer)))
+	footer = append(footer, magic...)
+	return w.write(footer)
+}
+
+func (w *Writer) start() error {
+	if w.offset > 0 {
+		return nil
+	}
+	return w.write(magic)
+}
+
+func (w *Writer) write(p []byte) error {
+	n, err := w.w.Write(p)
+	w.offset += int64(n)
+	return err
+}
+
+// writeColumnChunk writes the values of one column as a single data page
+func (w *Writer) writeColumnChunk(values interface{}, rows int) (columnChunk, error) {
+	w.page = w.page[:0]
+	switch v := values.(type) {
+	case []int32:
+		for _, value := range v {
+			w.page = binary.LittleEndian.AppendUint32(w.page, uint32(value))
+		}
+	case []int64:
+		for _, value := range v {
+			w.page = binary.LittleEndian.AppendUint64(w.page, uint64(value))
+		}
+	}
+	if len(w.page) > math.MaxInt32 || rows > math.MaxInt32 {
+		return columnChunk{}, fmt.Errorf("parquet: page of %d bytes is too large", len(w.page))
+	}
+	w.compressed = snappy.Encode(w.compressed[:cap(w.compressed)], w.page)
+
+	var header thriftWriter
+	header.begin()
+	header.i32(1, pageData)
+	header.i32(2, int32(len(w.page)))
+	header.i32(3, int32(len(w.compressed)))
+	header.structField(5)
+	header.i32(1, int32(rows))
+	header.i32(2, encodingPlain)
+	header.i32(3, encodingRLE)
+	header.i32(4, encodingRLE)
+	header.end()
+	header.end()
+
+	chunk := columnChunk{
+		offset:       w.offset,
+		uncompressed: int64(header.buf.Len() + len(w.page)),
+		compressed:   int64(header.buf.Len() + len(w.compressed)),
+	}
+	if err := w.write(header.buf.Bytes()); err != nil {
+		return columnChunk{}, err
+	}
+	if err := w.write(w.compressed); err != nil {
+		return columnChunk{}, err
+	}
+	return chunk, nil
+}
+
+// footer encodes the FileMetaData structure
+func (w *Writer) footer() []byte {
+	var t thriftWriter
+	t.begin()
+	t.i32(1, 1) // format version
+
+	t.list(2, thriftStruct, len(w.columns)+1)
+	t.begin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(w.columns)))
+	t.end()
+	for _, column := range w.columns {
+		t.begin()
+		t.i32(1, int32(column.Type))
+		t.i32(3, repetitionRequired)
+		t.binary(4, column.Name)
+		switch {
+		case column.Timestamp:
+			t.i32(6, convertedTimestampMicros)
+			t.structField(10)
+			t.structField(8)
+			t.boolField(1, true) // adjusted to UTC
+			t.structField(2)
+			t.structField(2) // microseconds
+			t.end()
+			t.end()
+			t.end()
+			t.end()
+		case convertedInts[column.IntWidth] != 0:
+			t.i32(6, convertedInts[column.IntWidth])
+			t.structField(10)
+			t.structField(10)
+			t.byteField(1, int8(column.IntWidth))
+			t.boolField(2, true) // signed
+			t.end()
+			t.end()
+		}
+		t.end()
+	}
+
+	t.i64(3, w.rows)
+
+	t.list(4, thriftStruct, len(w.rowGroups))
+	for _, group := range w.rowGroups {
+		t.begin()
+		t.list(1, thriftStruct, len(group.columns))
+		var size int64
+		for i, chunk := range group.columns {
+			column := w.columns[i]
+			t.begin()
+			t.i64(2, chunk.offset)
+			t.structField(3)
+			t.i32(1, int32(column.Type))
+			t.list(2, thriftI32, 1)
+			t.zigzag(encodingPlain)
+			t.list(3, thriftBinary, 1)
+			t.rawBinary(column.Name)
+			t.i32(4, codecSnappy)
+			t.i64(5, group.rows)
+			t.i64(6, chunk.uncompressed)
+			t.i64(7, chunk.compressed)
+			t.i64(9, chunk.offset)
+			t.end()
+			t.end()
+			size += chunk.uncompressed
+		}
+		t.i64(2, size)
+		t.i64(3, group.rows)
+		t.end()
+	}
+
+	if len(w.metadata) > 0 {
+		t.list(5, thriftStruct, len(w.metadata))
+		for _, kv := range w.metadata {
+			t.begin()
+			t.binary(1, kv.Key)
+			t.binary(2, kv.Value)
+			t.end()
+		}
+	}
+	t.binary(6, createdBy)
+	t.end()
+
+	return append([]byte(nil), t.buf.Bytes()...)
+}
@@ -0,0 +1,198 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+)
+
+// footerOf checks the trailing magic and footer length of a Parquet file and
+// decodes its FileMetaData
+func footerOf(t *testing.T, file []byte) fields {
+	t.Helper()
+
+	if len(file) < 12 || !bytes.HasPrefix(file, magic) || !bytes.HasSuffix(file, magic) {
+		t.Fatalf("file of %d bytes is not framed by %q", len(file), magic)
+	}
+	length := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	start := len(file) - 8 - length
+	if start < len(magic) {
+		t.Fatalf("footer length %d overruns the file", length)
+	}
+
+	metadata, n := decodeStruct(t, file[start:len(file)-8])
+	if n != length {
+		t.Fatalf("FileMetaData is %d bytes, footer length says %d", n, length)
+	}
+	return metadata
+}
+
+// readColumnChunk decodes the single data page of a column chunk
+func readColumnChunk(t *testing.T, file []byte, chunk fields) []byte {
+	t.Helper()
+
+	meta := chunk[3].(fields)
+	offset := meta[9].(int64)
+	if chunk[2].(int64) != offset {
+		t.Errorf("file_offset %d differs from data_page_offset %d", chunk[2], offset)
+	}
+
+	header, n := decodeStruct(t, file[offset:])
+	if header[1].(int64) != pageData {
+		t.Fatalf("page type %d, want a data page", header[1])
+	}
+	compressed := int(header[3].(int64))
+	if int64(n+compressed) != meta[7].(int64) {
+		t.Errorf("total_compressed_size %d, page is %d bytes", meta[7], n+compressed)
+	}
+
+	page, err := snappy.Decode(nil, file[int(offset)+n:int(offset)+n+compressed])
+	if err != nil {
+		t.Fatalf("decompressing page: %v", err)
+	}
+	if int64(len(page)) != header[2].(int64) {
+		t.Errorf("page decompressed to %d bytes, header says %d", len(page), header[2])
+	}
+	if int64(n+len(page)) != meta[6].(int64) {
+		t.Errorf("total_uncompressed_size %d, page is %d bytes", meta[6], n+len(page))
+	}
+
+	dataPage := header[5].(fields)
+	if dataPage[1] != meta[5] {
+		t.Errorf("page has %d values, column metadata %d", dataPage[1], meta[5])
+	}
+	if dataPage[2].(int64) != encodingPlain {
+		t.Errorf("page encoding %d, want PLAIN", dataPage[2])
+	}
+	return page
+}
+
+func TestWriterFileLayout(t *testing.T) {
+	columns := []Column{
+		{Name: "timestamp", Type: Int64, Timestamp: true},
+		{Name: "ch0", Type: Int32, IntWidth: 16},
+		{Name: "raw", Type: Int32},
+	}
+	var out bytes.Buffer
+	w := NewWriter(&out, columns, []KeyValue{{"device", "dev_1"}})
+
+	groups := [][]interface{}{
+		{[]int64{1000, 2000, 3000}, []int32{-1, 0, 1}, []int32{7, 8, 9}},
+		{[]int64{4000}, []int32{32767}, []int32{-7}},
+	}
+	for _, group := range groups {
+		if err := w.WriteRowGroup(group...); err != nil {
+			t.Fatalf("WriteRowGroup: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	file := out.Bytes()
+	metadata := footerOf(t, file)
+
+	if metadata[1] != int64(1) || metadata[3] != int64(4) || metadata[6] != createdBy {
+		t.Errorf("version %v, num_rows %v, created_by %v", metadata[1], metadata[3], metadata[6])
+	}
+
+	wantSchema := []string{
+		"map[4:schema 5:3]",
+		"map[1:2 3:0 4:timestamp 6:10 10:map[8:map[1:true 2:map[2:map[]]]]]",
+		"map[1:1 3:0 4:ch0 6:16 10:map[10:map[1:16 2:true]]]",
+		"map[1:1 3:0 4:raw]",
+	}
+	schema := metadata[2].([]interface{})
+	if len(schema) != len(wantSchema) {
+		t.Fatalf("schema has %d elements, want %d", len(schema), len(wantSchema))
+	}
+	for i, element := range schema {
+		if got := fmt.Sprint(element); got != wantSchema[i] {
+			t.Errorf("schema element %d = %s, want %s", i, got, wantSchema[i])
+		}
+	}
+
+	keyValues := metadata[5].([]interface{})
+	if len(keyValues) != 1 || fmt.Sprint(keyValues[0]) != "map[1:device 2:dev_1]" {
+		t.Errorf("key_value_metadata = %v", keyValues)
+	}
+
+	rowGroups := metadata[4].([]interface{})
+	if len(rowGroups) != len(groups) {
+		t.Fatalf("%d row groups, want %d", len(rowGroups), len(groups))
+	}
+	for g, rowGroup := range rowGroups {
+		rowGroup := rowGroup.(fields)
+		rows := int64(len(groups[g][0].([]int64)))
+		if rowGroup[3] != rows {
+			t.Errorf("row group %d has num_rows %v, want %d", g, rowGroup[3], rows)
+		}
+
+		var size int64
+		for c, chunk := range rowGroup[1].([]interface{}) {
+			chunk := chunk.(fields)
+			meta := chunk[3].(fields)
+			if meta[1] != int64(columns[c].Type) || fmt.Sprint(meta[3]) != "["+columns[c].Name+"]" || meta[4] != int64(codecSnappy) {
+				t.Errorf("row group %d column %d metadata %v", g, c, meta)
+			}
+			size += meta[6].(int64)
+
+			var want bytes.Buffer
+			binary.Write(&want, binary.LittleEndian, groups[g][c])
+			if page := readColumnChunk(t, file, chunk); !bytes.Equal(page, want.Bytes()) {
+				t.Errorf("row group %d column %d holds % X, want % X", g, c, page, want.Bytes())
+			}
+		}
+		if rowGroup[2] != size {
+			t.Errorf("row group %d total_byte_size %v, want %d", g, rowGroup[2], size)
+		}
+	}
+}
+
+func TestWriterEmptyFile(t *testing.T) {
+	var out bytes.Buffer
+	w := NewWriter(&out, []Column{{Name: "v", Type: Int32}}, nil)
+	if err := w.WriteRowGroup([]int32{}); err != nil {
+		t.Fatalf("WriteRowGroup: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	metadata := footerOf(t, out.Bytes())
+	if metadata[3] != int64(0) || len(metadata[4].([]interface{})) != 0 {
+		t.Errorf("empty file has num_rows %v and row groups %v", metadata[3], metadata[4])
+	}
+	if _, ok := metadata[5]; ok {
+		t.Error("empty key_value_metadata was written")
+	}
+}
+
+func TestWriterSchemaMismatch(t *testing.T) {
+	columns := []Column{{Name: "a", Type: Int64}, {Name: "b", Type: Int32}}
+
+	tests := []struct {
+		name   string
+		values []interface{}
+	}{
+		{"missing column", []interface{}{[]int64{1}}},
+		{"wrong type", []interface{}{[]int64{1}, []int64{1}}},
+		{"different lengths", []interface{}{[]int64{1, 2}, []int32{1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := NewWriter(&out, columns, nil).WriteRowGroup(tt.values...)
+			if !errors.Is(err, ErrSchemaMismatch) {
+				t.Errorf("got %v, want ErrSchemaMismatch", err)
+			}
+			if out.Len() != 0 {
+				t.Errorf("%d bytes written for a rejected row group", out.Len())
+			}
+		})
+	}
+}
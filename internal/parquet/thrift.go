@@ -0,0 +1,107 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Thrift compact protocol field types
+const (
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftByte   = 3
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes the Parquet metadata structures with the Thrift
+// compact protocol. Fields must be written in increasing id order within a
+// struct.
+type thriftWriter struct {
+	buf bytes.Buffer
+	// Last field id of each open struct, innermost last
+	fields []int16
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	t.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func (t *thriftWriter) zigzag(v int64) {
+	t.varint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (t *thriftWriter) fieldHeader(id int16, typ byte) {
+	last := &t.fields[len(t.fields)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.zigzag(int64(id))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.fieldHeader(id, thriftI32)
+	t.zigzag(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.fieldHeader(id, thriftI64)
+	t.zigzag(v)
+}
+
+func (t *thriftWriter) byteField(id int16, v int8) {
+	t.fieldHeader(id, thriftByte)
+	t.buf.WriteByte(byte(v))
+}
+
+func (t *thriftWriter) boolField(id int16, v bool) {
+	if v {
+		t.fieldHeader(id, thriftTrue)
+	} else {
+		t.fieldHeader(id, thriftFalse)
+	}
+}
+
+func (t *thriftWriter) binary(id int16, v string) {
+	t.fieldHeader(id, thriftBinary)
+	t.rawBinary(v)
+}
+
+func (t *thriftWriter) rawBinary(v string) {
+	t.varint(uint64(len(v)))
+	t.buf.WriteString(v)
+}
+
+// list writes a list field header; the n elements follow
+func (t *thriftWriter) list(id int16, elemType byte, n int) {
+	t.fieldHeader(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elemType)
+	} else {
+		t.buf.WriteByte(0xF0 | elemType)
+		t.varint(uint64(n))
+	}
+}
+
+// structField opens a struct-valued field, closed with end
+func (t *thriftWriter) structField(id int16) {
+	t.fieldHeader(id, thriftStruct)
+	t.begin()
+}
+
+// begin opens a struct written as a list element or top-level value
+func (t *thriftWriter) begin() {
+	t.fields = append(t.fields, 0)
+}
+
+// end closes the innermost struct
+func (t *thriftWriter) end() {
+	t.buf.WriteByte(0)
+	t.fields = t.fields[:len(t.fields)-1]
+}
@@ -0,0 +1,216 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// fields is a decoded Thrift struct: field id to value. Integers decode as
+// int64, binaries as string, lists as []interface{} and structs as fields.
+type fields map[int16]interface{}
+
+// thriftReader decodes the Thrift compact protocol, independently of
+// thriftWriter, so the tests can check what a Parquet reader would see
+type thriftReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *thriftReader) fail(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf("offset %d: %s", r.pos, fmt.Sprintf(format, args...))
+	}
+}
+
+func (r *thriftReader) byte() byte {
+	if r.err != nil || r.pos >= len(r.b) {
+		r.fail("unexpected end of data")
+		return 0
+	}
+	r.pos++
+	return r.b[r.pos-1]
+}
+
+func (r *thriftReader) varint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.b[r.pos:])
+	if n <= 0 {
+		r.fail("bad varint")
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) structValue() fields {
+	s := make(fields)
+	var last int16
+	for r.err == nil {
+		header := r.byte()
+		if header == 0 {
+			return s
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.zigzag())
+		}
+		typ := header & 0x0F
+		switch typ {
+		case thriftTrue:
+			s[id] = true
+		case thriftFalse:
+			s[id] = false
+		default:
+			s[id] = r.value(typ)
+		}
+		last = id
+	}
+	return s
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case thriftByte:
+		return int64(int8(r.byte()))
+	case thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.varint())
+		if r.err != nil || r.pos+n > len(r.b) {
+			r.fail("binary of %d bytes overruns the data", n)
+			return ""
+		}
+		r.pos += n
+		return string(r.b[r.pos-n : r.pos])
+	case thriftList:
+		header := r.byte()
+		n := int(header >> 4)
+		if n == 15 {
+			n = int(r.varint())
+		}
+		list := []interface{}{}
+		for i := 0; i < n && r.err == nil; i++ {
+			list = append(list, r.value(header&0x0F))
+		}
+		return list
+	case thriftStruct:
+		return r.structValue()
+	}
+	r.fail("unknown type %d", typ)
+	return nil
+}
+
+// decodeStruct decodes one struct from the start of b and returns it with its
+// encoded length
+func decodeStruct(t *testing.T, b []byte) (fields, int) {
+	t.Helper()
+
+	r := &thriftReader{b: b}
+	s := r.structValue()
+	if r.err != nil {
+		t.Fatalf("decoding Thrift struct: %v", r.err)
+	}
+	return s, r.pos
+}
+
+func TestThriftEncoding(t *testing.T) {
+	// Expected bytes follow the compact protocol specification
+	tests := []struct {
+		name  string
+		write func(w *thriftWriter)
+		want  []byte
+	}{
+		{"empty struct", func(w *thriftWriter) {}, []byte{0x00}},
+		{"i32 with short header", func(w *thriftWriter) { w.i32(1, 1) }, []byte{0x15, 0x02, 0x00}},
+		{"negative i32", func(w *thriftWriter) { w.i32(1, -1) }, []byte{0x15, 0x01, 0x00}},
+		{"i64 multi-byte varint", func(w *thriftWriter) { w.i64(2, 300) }, []byte{0x26, 0xD8, 0x04, 0x00}},
+		{"delta over 15 uses the long header", func(w *thriftWriter) {
+			w.i32(1, 0)
+			w.i32(17, 0)
+		}, []byte{0x15, 0x00, 0x05, 0x22, 0x00, 0x00}},
+		{"bools carry the value in the type", func(w *thriftWriter) {
+			w.boolField(1, true)
+			w.boolField(2, false)
+		}, []byte{0x11, 0x12, 0x00}},
+		{"byte", func(w *thriftWriter) { w.byteField(1, -2) }, []byte{0x13, 0xFE, 0x00}},
+		{"binary", func(w *thriftWriter) { w.binary(4, "ab") }, []byte{0x48, 0x02, 'a', 'b', 0x00}},
+		{"short list", func(w *thriftWriter) {
+			w.list(1, thriftI32, 2)
+			w.zigzag(1)
+			w.zigzag(-1)
+		}, []byte{0x19, 0x25, 0x02, 0x01, 0x00}},
+		{"long list", func(w *thriftWriter) {
+			w.list(1, thriftI32, 20)
+			for i := 0; i < 20; i++ {
+				w.zigzag(0)
+			}
+		}, append([]byte{0x19, 0xF5, 0x14}, append(make([]byte, 20), 0x00)...)},
+		{"nested struct keeps its own field ids", func(w *thriftWriter) {
+			w.i32(1, 0)
+			w.structField(5)
+			w.i32(1, 0)
+			w.end()
+			w.i32(6, 0)
+		}, []byte{0x15, 0x00, 0x4C, 0x15, 0x00, 0x00, 0x15, 0x00, 0x00}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w thriftWriter
+			w.begin()
+			tt.write(&w)
+			w.end()
+
+			if got := w.buf.Bytes(); !bytes.Equal(got, tt.want) {
+				t.Errorf("encoded % X, want % X", got, tt.want)
+			}
+			if len(w.fields) != 0 {
+				t.Errorf("%d structs left open", len(w.fields))
+			}
+		})
+	}
+}
+
+func TestThriftRoundTrip(t *testing.T) {
+	var w thriftWriter
+	w.begin()
+	w.i32(1, -123456)
+	w.i64(2, 1<<40)
+	w.binary(3, strings.Repeat("x", 200))
+	w.list(4, thriftStruct, 2)
+	for i := 0; i < 2; i++ {
+		w.begin()
+		w.byteField(1, int8(i))
+		w.end()
+	}
+	w.structField(30)
+	w.boolField(1, true)
+	w.end()
+	w.end()
+
+	s, n := decodeStruct(t, w.buf.Bytes())
+	if n != w.buf.Len() {
+		t.Errorf("decoded %d of %d bytes", n, w.buf.Len())
+	}
+
+	want := fields{
+		1:  int64(-123456),
+		2:  int64(1 << 40),
+		3:  strings.Repeat("x", 200),
+		4:  []interface{}{fields{1: int64(0)}, fields{1: int64(1)}},
+		30: fields{1: true},
+	}
+	if fmt.Sprint(s) != fmt.Sprint(want) {
+		t.Errorf("decoded %v, want %v", s, want)
+	}
+}
@@ -0,0 +1,173 @@
+// Package protocol implements the binary chunk framing used on the
+// /api/webusb/stream WebSocket.
+//
+// Every binary WebSocket message carries exactly one frame: a fixed 32-byte
+// header followed by the raw (not base64) chunk payload. All integers are
+// big-endian.
+//
+//	offset  size  field
+//	0       4     magic          "ACQF"
+//	4       1     version        FrameVersion (1)
+//	5       1     flags          reserved, must be 0
+//	6       2     channel        source channel / endpoint id
+//	8       8     chunk index    per-acquisition sequence number shared by all channels
+//	16      8     timestamp      capture time, Unix nanoseconds; 0 if unknown
+//	24      4     payload length number of payload bytes following the header
+//	28      4     crc            CRC-32C (Castagnoli) of header bytes 0-27 followed by the payload
+//	32      n     payload
+//
+// The capture time is stored with the chunk. If the acquisition negotiated a
+// compression codec the payload is compressed
+// with it; the CRC covers the payload as sent.
+//
+// The server acknowledges each frame with an "ack" JSON text message echoing
+// the chunk index and channel of the frame.
+//
+// The HTTP batch upload endpoint accepts the same frames concatenated back to
+// back in an application/octet-stream body.
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+)
+
+const (
+	// FrameMagic identifies a binary chunk frame
+	FrameMagic = "ACQF"
+
+	// FrameVersion is the only header version the server accepts
+	FrameVersion byte = 1
+
+	// FrameHeaderSize is the size of the fixed frame header in bytes
+	FrameHeaderSize = 32
+
+	// crcOffset is where the CRC field starts; everything before it is covered
+	crcOffset = 28
+)
+
+var (
+	ErrShortFrame         = errors.New("frame shorter than header")
+	ErrBadMagic           = errors.New("frame magic mismatch")
+	ErrUnsupportedVersion = errors.New("unsupported frame version")
+	ErrReservedFlags      = errors.New("reserved frame flags set")
+	ErrLengthMismatch     = errors.New("frame payload length mismatch")
+	ErrChecksumMismatch   = errors.New("frame crc mismatch")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Frame is a decoded binary chunk frame
+type Frame struct {
+	Version    byte
+	Flags      byte
+	Channel    uint16
+	ChunkIndex int64
+	// Timestamp is the capture time; zero if the sender did not know it
+	Timestamp time.Time
+	Payload   []byte
+}
+
+// DecodeFrame parses and validates a binary frame. The returned payload
+// aliases data.
+func DecodeFrame(data []byte) (*Frame, error) {
+	if len(data) < FrameHeaderSize {
+		return nil, ErrShortFrame
+	}
+
+	if string(data[0:4]) != FrameMagic {
+		return nil, ErrBadMagic
+	}
+
+	if data[4] != FrameVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, data[4])
+	}
+
+	if data[5] != 0 {
+		return nil, fmt.Errorf("%w: %#02x", ErrReservedFlags, data[5])
+	}
+
+	length := binary.BigEndian.Uint32(data[24:28])
+	payload := data[FrameHeaderSize:]
+	if uint64(len(payload)) != uint64(length) {
+		return nil, fmt.Errorf("%w: header says %d bytes, got %d", ErrLengthMismatch, length, len(payload))
+	}
+
+	if binary.BigEndian.Uint32(data[crcOffset:FrameHeaderSize]) != frameCRC(data[:crcOffset], payload) {
+		return nil, ErrChecksumMismatch
+	}
+
+	chunkIndex := binary.BigEndian.Uint64(data[8:16])
+	if chunkIndex > 1<<63-1 {
+		return nil, fmt.Errorf("chunk index %d out of range", chunkIndex)
+	}
+
+	var timestamp time.Time
+	if nanos := int64(binary.BigEndian.Uint64(data[16:24])); nanos != 0 {
+		timestamp = time.Unix(0, nanos)
+	}
+
+	return &Frame{
+		Version:    data[4],
+		Flags:      data[5],
+		Channel:    binary.BigEndian.Uint16(data[6:8]),
+		ChunkIndex: int64(chunkIndex),
+		Timestamp:  timestamp,
+		Payload:    payload,
+	}, nil
+}
+
+// DecodeFrames parses a sequence of back-to-back frames, as sent in the body
+// of a batch upload. Decoding stops at the first invalid frame; the frames
+// before it are returned together with the error.
+func DecodeFrames(data []byte) ([]*Frame, error) {
+	var frames []*Frame
+	for offset := 0; offset < len(data); {
+		rest := data[offset:]
+		if len(rest) < FrameHeaderSize {
+			return frames, fmt.Errorf("frame at offset %d: %w", offset, ErrShortFrame)
+		}
+
+		size := uint64(FrameHeaderSize) + uint64(binary.BigEndian.Uint32(rest[24:28]))
+		if size > uint64(len(rest)) {
+			return frames, fmt.Errorf("frame at offset %d: %w: header says %d bytes, got %d",
+				offset, ErrLengthMismatch, size-FrameHeaderSize, len(rest)-FrameHeaderSize)
+		}
+
+		frame, err := DecodeFrame(rest[:size])
+		if err != nil {
+			return frames, fmt.Errorf("frame at offset %d: %w", offset, err)
+		}
+		frames = append(frames, frame)
+		offset += int(size)
+	}
+
+	return frames, nil
+}
+
+// EncodeFrame serializes a frame, filling in magic, version, length and CRC
+func EncodeFrame(frame Frame) []byte {
+	data := make([]byte, FrameHeaderSize+len(frame.Payload))
+
+	copy(data[0:4], FrameMagic)
+	data[4] = FrameVersion
+	data[5] = frame.Flags
+	binary.BigEndian.PutUint16(data[6:8], frame.Channel)
+	binary.BigEndian.PutUint64(data[8:16], uint64(frame.ChunkIndex))
+	if !frame.Timestamp.IsZero() {
+		binary.BigEndian.PutUint64(data[16:24], uint64(frame.Timestamp.UnixNano()))
+	}
+	binary.BigEndian.PutUint32(data[24:28], uint32(len(frame.Payload)))
+	copy(data[FrameHeaderSize:], frame.Payload)
+	binary.BigEndian.PutUint32(data[crcOffset:FrameHeaderSize], frameCRC(data[:crcOffset], frame.Payload))
+
+	return data
+}
+
+func frameCRC(header, payload []byte) uint32 {
+	crc := crc32.Update(0, crcTable, header)
+	return crc32.Update(crc, crcTable, payload)
+}
@@ -0,0 +1,112 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame Frame
+	}{
+		{"payload", Frame{Channel: 3, ChunkIndex: 42, Timestamp: time.Unix(1700000000, 123456789), Payload: []byte("samples")}},
+		{"empty payload", Frame{ChunkIndex: 0, Timestamp: time.Unix(0, 1)}},
+		{"no timestamp", Frame{Channel: 0xFFFF, ChunkIndex: 1<<63 - 1, Payload: bytes.Repeat([]byte{0xAB}, 1000)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := EncodeFrame(tt.frame)
+			if len(data) != FrameHeaderSize+len(tt.frame.Payload) {
+				t.Fatalf("encoded %d bytes, want %d", len(data), FrameHeaderSize+len(tt.frame.Payload))
+			}
+			if string(data[:4]) != FrameMagic || data[4] != FrameVersion {
+				t.Errorf("header starts % x, want magic and version", data[:5])
+			}
+
+			frame, err := DecodeFrame(data)
+			if err != nil {
+				t.Fatalf("DecodeFrame: %v", err)
+			}
+			if frame.Version != FrameVersion || frame.Channel != tt.frame.Channel || frame.ChunkIndex != tt.frame.ChunkIndex ||
+				!frame.Timestamp.Equal(tt.frame.Timestamp) || !bytes.Equal(frame.Payload, tt.frame.Payload) {
+				t.Errorf("DecodeFrame() = %+v, want %+v", frame, tt.frame)
+			}
+		})
+	}
+}
+
+func TestDecodeFrameErrors(t *testing.T) {
+	valid := EncodeFrame(Frame{Channel: 1, ChunkIndex: 7, Timestamp: time.Unix(1700000000, 0), Payload: []byte("payload")})
+	modified := func(change func(data []byte) []byte) []byte {
+		return change(append([]byte(nil), valid...))
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"short", valid[:FrameHeaderSize-1], ErrShortFrame},
+		{"bad magic", modified(func(d []byte) []byte { d[0] = 'X'; return d }), ErrBadMagic},
+		{"bad version", modified(func(d []byte) []byte { d[4] = 2; return d }), ErrUnsupportedVersion},
+		{"reserved flags", modified(func(d []byte) []byte { d[5] = 1; return d }), ErrReservedFlags},
+		{"payload longer than header says", append(modified(func(d []byte) []byte { return d }), 0), ErrLengthMismatch},
+		{"payload shorter than header says", valid[:len(valid)-1], ErrLengthMismatch},
+		{"corrupt payload", modified(func(d []byte) []byte { d[FrameHeaderSize] ^= 1; return d }), ErrChecksumMismatch},
+		{"corrupt header", modified(func(d []byte) []byte { d[8] ^= 1; return d }), ErrChecksumMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame, err := DecodeFrame(tt.data)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("DecodeFrame() = %+v, %v; want %v", frame, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeFrames(t *testing.T) {
+	var batch []byte
+	for index := int64(0); index < 3; index++ {
+		batch = append(batch, EncodeFrame(Frame{ChunkIndex: index, Payload: bytes.Repeat([]byte{byte(index)}, int(index)*10)})...)
+	}
+
+	frames, err := DecodeFrames(batch)
+	if err != nil {
+		t.Fatalf("DecodeFrames: %v", err)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("decoded %d frames, want 3", len(frames))
+	}
+	for i, frame := range frames {
+		if frame.ChunkIndex != int64(i) || len(frame.Payload) != i*10 {
+			t.Errorf("frame %d: chunk %d with %d bytes, want chunk %d with %d", i, frame.ChunkIndex, len(frame.Payload), i, i*10)
+		}
+	}
+
+	// The last frame is cut off in the middle of its payload
+	frames, err = DecodeFrames(batch[:len(batch)-5])
+	if !errors.Is(err, ErrLengthMismatch) || len(frames) != 2 {
+		t.Errorf("truncated batch: %d frames, %v; want the 2 intact frames and ErrLengthMismatch", len(frames), err)
+	}
+
+	// The last frame is cut off in the middle of its header
+	secondEnd := 2*FrameHeaderSize + 10
+	frames, err = DecodeFrames(batch[:secondEnd+FrameHeaderSize/2])
+	if !errors.Is(err, ErrShortFrame) || len(frames) != 2 {
+		t.Errorf("batch cut in a header: %d frames, %v; want the 2 intact frames and ErrShortFrame", len(frames), err)
+	}
+
+	// A corrupt frame in the middle stops decoding there
+	corrupt := append([]byte(nil), batch...)
+	corrupt[FrameHeaderSize+FrameHeaderSize] ^= 1
+	frames, err = DecodeFrames(corrupt)
+	if !errors.Is(err, ErrChecksumMismatch) || len(frames) != 1 {
+		t.Errorf("batch with a corrupt second frame: %d frames, %v; want 1 frame and ErrChecksumMismatch", len(frames), err)
+	}
+}
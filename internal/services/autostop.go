@@ -0,0 +1,77 @@
+package services
+
+import (
+	"log/slog"
+	"time"
+
+	"acquire-app/internal/models"
+)
+
+// StopReasonDurationReached is the stop reason of acquisitions that ran for
+// their requested duration
+const StopReasonDurationReached = "duration_reached"
+
+// OnAutoStop registers the function called after an acquisition was stopped
+// because its requested duration elapsed. It is called without the mutex
+// held, from the timer's goroutine, with a snapshot of the acquisition.
+func (sm *SessionManager) OnAutoStop(handler func(acquisition *models.Acquisition)) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	sm.autoStopHandler = handler
+}
+
+// scheduleAutoStop arms the timer that stops an acquisition at its StopAt
+// time, replacing any timer set before. Must be called with the mutex held.
+func (sm *SessionManager) scheduleAutoStop(acquisition *models.Acquisition) {
+	sm.cancelAutoStop(acquisition.ID)
+	if acquisition.StopAt == nil {
+		return
+	}
+
+	acquisitionID := acquisition.ID
+	sm.timers[acquisitionID] = time.AfterFunc(time.Until(*acquisition.StopAt), func() {
+		sm.autoStop(acquisitionID)
+	})
+}
+
+// cancelAutoStop disarms the timer of an acquisition, if it has one. Must be
+// called with the mutex held.
+func (sm *SessionManager) cancelAutoStop(acquisitionID string) {
+	if timer, exists := sm.timers[acquisitionID]; exists {
+		timer.Stop()
+		delete(sm.timers, acquisitionID)
+	}
+}
+
+// autoStop runs when an acquisition's timer fires. A timer that was
+// cancelled or replaced while it was firing finds the acquisition no longer
+// active, or its StopAt moved, and does nothing.
+func (sm *SessionManager) autoStop(acquisitionID string) {
+	sm.mutex.Lock()
+	acquisition, exists := sm.acquisitions[acquisitionID]
+	if !exists || acquisition.Status != models.AcquisitionActive ||
+		acquisition.StopAt == nil || time.Now().Before(*acquisition.StopAt) {
+		sm.mutex.Unlock()
+		return
+	}
+
+	if err := sm.stopAcquisition(acquisition, StopReasonDurationReached, time.Now()); err != nil {
+		sm.mutex.Unlock()
+		slog.Error("Failed to stop acquisition at the end of its duration", "acquisitionId", acquisitionID, "error", err)
+		return
+	}
+	sm.requestFlush()
+	handler := sm.autoStopHandler
+	snapshot := *acquisition
+	sm.mutex.Unlock()
+
+	slog.Info("Acquisition reached its requested duration",
+		"acquisitionId", acquisitionID,
+		"duration", snapshot.Parameters.Duration,
+		"totalBytes", snapshot.Statistics.TotalBytes)
+
+	if handler != nil {
+		handler(&snapshot)
+	}
+}
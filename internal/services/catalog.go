@@ -0,0 +1,122 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"acquire-app/internal/models"
+)
+
+var ErrInvalidCursor = errors.New("invalid catalog cursor")
+
+// Page sizes of catalog queries
+const (
+	DefaultCatalogLimit = 50
+	MaxCatalogLimit     = 500
+)
+
+// AcquisitionSort is the order of catalog query results
+type AcquisitionSort string
+
+const (
+	SortByStartTime AcquisitionSort = "startTime"
+	SortBySize      AcquisitionSort = "size"
+)
+
+// AcquisitionQuery selects acquisitions from the catalog. Empty filters match
+// everything.
+type AcquisitionQuery struct {
+	PatientID     string
+	Operator      string
+	ProcedureType string
+	DeviceID      string
+	Status        models.AcquisitionState
+	// From and To bound the start time, From inclusive and To exclusive;
+	// zero times leave that end open
+	From    time.Time
+	To      time.Time
+	MinSize int64
+
+	SortBy     AcquisitionSort
+	Descending bool
+	Limit      int
+	// Cursor continues after the last acquisition of a previous page
+	Cursor string
+}
+
+// AcquisitionPage is one page of a catalog query. NextCursor is empty on the
+// last page.
+type AcquisitionPage struct {
+	Acquisitions []*models.Acquisition
+	NextCursor   string
+}
+
+// Matches reports whether an acquisition passes every filter of the query
+func (q *AcquisitionQuery) Matches(acquisition *models.Acquisition) bool {
+	switch {
+	case q.PatientID != "" && acquisition.Metadata.PatientID != q.PatientID,
+		q.Operator != "" && acquisition.Metadata.Operator != q.Operator,
+		q.ProcedureType != "" && acquisition.Metadata.ProcedureType != q.ProcedureType,
+		q.DeviceID != "" && acquisition.DeviceID != q.DeviceID,
+		q.Status != "" && acquisition.Status != q.Status,
+		!q.From.IsZero() && acquisition.StartTime.Before(q.From),
+		!q.To.IsZero() && !acquisition.StartTime.Before(q.To),
+		acquisition.Statistics.TotalBytes < q.MinSize:
+		return false
+	}
+	return true
+}
+
+// SortKey is the key the query orders an acquisition by
+func (q *AcquisitionQuery) SortKey(acquisition *models.Acquisition) []byte {
+	if q.SortBy == SortBySize {
+		return SizeKey(acquisition.Statistics.TotalBytes, acquisition.ID)
+	}
+	return StartTimeKey(acquisition.StartTime, acquisition.ID)
+}
+
+// CursorKey decodes the query's cursor into the sort key it continues after,
+// or nil if there is none
+func (q *AcquisitionQuery) CursorKey() ([]byte, error) {
+	if q.Cursor == "" {
+		return nil, nil
+	}
+	key, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil || len(key) < 8 {
+		return nil, ErrInvalidCursor
+	}
+	return key, nil
+}
+
+// EncodeCursor returns the cursor continuing after the given sort key
+func EncodeCursor(key []byte) string {
+	return base64.RawURLEncoding.EncodeToString(key)
+}
+
+// StartTimeKey orders acquisitions by start time, then ID. Keys compare
+// bytewise in the same order as the times.
+func StartTimeKey(start time.Time, acquisitionID string) []byte {
+	key := binary.BigEndian.AppendUint64(nil, uint64(start.UnixNano())^(1<<63))
+	return append(key, acquisitionID...)
+}
+
+// SizeKey orders acquisitions by stored size, then ID
+func SizeKey(size int64, acquisitionID string) []byte {
+	key := binary.BigEndian.AppendUint64(nil, uint64(size))
+	return append(key, acquisitionID...)
+}
+
+// QueryAcquisitions searches the acquisitions persisted in the repository.
+// Results reflect the last flush, so statistics of running acquisitions may
+// lag by up to persistInterval.
+func (sm *SessionManager) QueryAcquisitions(query AcquisitionQuery) (*AcquisitionPage, error) {
+	if query.Limit <= 0 {
+		query.Limit = DefaultCatalogLimit
+	}
+	if query.Limit > MaxCatalogLimit {
+		query.Limit = MaxCatalogLimit
+	}
+	return sm.repository.QueryAcquisitions(query)
+}
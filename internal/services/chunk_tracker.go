@@ -0,0 +1,111 @@
+package services
+
+import (
+	"sort"
+
+	"acquire-app/internal/models"
+)
+
+// ChunkTracker records which chunk indices of an acquisition have been
+// received, as a sorted list of merged inclusive ranges
+type ChunkTracker struct {
+	received []models.ChunkRange
+	count    int64
+	expected int64
+}
+
+func NewChunkTracker() *ChunkTracker {
+	return &ChunkTracker{}
+}
+
+// Add marks chunk index as received. It returns false if the chunk had
+// already been received.
+func (t *ChunkTracker) Add(index int64) bool {
+	// First range that ends at or after index-1, i.e. the only candidates for
+	// containing index or being extended by it
+	i := sort.Search(len(t.received), func(i int) bool { return t.received[i].End >= index-1 })
+
+	if i < len(t.received) && t.received[i].Start <= index && index <= t.received[i].End {
+		return false
+	}
+
+	t.count++
+
+	switch {
+	case i < len(t.received) && t.received[i].End == index-1:
+		// Extend the range on the left of index, merging with the next one
+		t.received[i].End = index
+		if i+1 < len(t.received) && t.received[i+1].Start == index+1 {
+			t.received[i].End = t.received[i+1].End
+			t.received = append(t.received[:i+1], t.received[i+2:]...)
+		}
+	case i < len(t.received) && t.received[i].Start == index+1:
+		t.received[i].Start = index
+	default:
+		t.received = append(t.received, models.ChunkRange{})
+		copy(t.received[i+1:], t.received[i:])
+		t.received[i] = models.ChunkRange{Start: index, End: index}
+	}
+
+	return true
+}
+
+// Contains reports whether chunk index has been received
+func (t *ChunkTracker) Contains(index int64) bool {
+	i := sort.Search(len(t.received), func(i int) bool { return t.received[i].End >= index })
+	return i < len(t.received) && t.received[i].Start <= index
+}
+
+// SetExpected records the total number of chunks announced by the sender, so
+// that chunks missing at the end of the stream are reported as well
+func (t *ChunkTracker) SetExpected(total int64) {
+	if total > t.expected {
+		t.expected = total
+	}
+}
+
+// Count returns the number of distinct chunks received
+func (t *ChunkTracker) Count() int64 {
+	return t.count
+}
+
+// Highest returns the highest chunk index received, or -1
+func (t *ChunkTracker) Highest() int64 {
+	if len(t.received) == 0 {
+		return -1
+	}
+	return t.received[len(t.received)-1].End
+}
+
+// Gaps returns the ranges of chunks not received below the highest received
+// chunk index
+func (t *ChunkTracker) Gaps() []models.ChunkRange {
+	var gaps []models.ChunkRange
+
+	next := int64(0)
+	for _, r := range t.received {
+		if r.Start > next {
+			gaps = append(gaps, models.ChunkRange{Start: next, End: r.Start - 1})
+		}
+		next = r.End + 1
+	}
+
+	return gaps
+}
+
+// Missing returns the gaps plus any chunks announced by the sender beyond the
+// highest received index
+func (t *ChunkTracker) Missing() []models.ChunkRange {
+	missing := t.Gaps()
+
+	if next := t.Highest() + 1; t.expected > next {
+		missing = append(missing, models.ChunkRange{Start: next, End: t.expected - 1})
+	}
+
+	return missing
+}
+
+// Received returns the ranges of chunks received so far
+func (t *ChunkTracker) Received() []models.ChunkRange {
+	return append([]models.ChunkRange(nil), t.received...)
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"acquire-app/internal/models"
+)
+
+// ranges builds chunk ranges from pairs of start and end indices
+func ranges(bounds ...int64) []models.ChunkRange {
+	var result []models.ChunkRange
+	for i := 0; i+1 < len(bounds); i += 2 {
+		result = append(result, models.ChunkRange{Start: bounds[i], End: bounds[i+1]})
+	}
+	return result
+}
+
+func TestChunkTracker(t *testing.T) {
+	tests := []struct {
+		name     string
+		add      []int64
+		expected int64
+
+		duplicates []int64
+		received   []models.ChunkRange
+		highest    int64
+		gaps       []models.ChunkRange
+		missing    []models.ChunkRange
+	}{
+		{
+			name:    "nothing received",
+			highest: -1,
+		},
+		{
+			name:     "nothing received, some announced",
+			expected: 3,
+			highest:  -1,
+			missing:  ranges(0, 2),
+		},
+		{
+			name:     "in order",
+			add:      []int64{0, 1, 2, 3},
+			received: ranges(0, 3),
+			highest:  3,
+		},
+		{
+			name:     "out of order",
+			add:      []int64{2, 0, 3, 1},
+			received: ranges(0, 3),
+			highest:  3,
+		},
+		{
+			name:       "duplicates",
+			add:        []int64{0, 1, 1, 0, 5, 5},
+			duplicates: []int64{1, 0, 5},
+			received:   ranges(0, 1, 5, 5),
+			highest:    5,
+			gaps:       ranges(2, 4),
+			missing:    ranges(2, 4),
+		},
+		{
+			name:     "adjacent ranges merge",
+			add:      []int64{0, 1, 4, 5, 3, 2},
+			received: ranges(0, 5),
+			highest:  5,
+		},
+		{
+			name:     "extends the next range downwards",
+			add:      []int64{5, 4, 3},
+			received: ranges(3, 5),
+			highest:  5,
+			gaps:     ranges(0, 2),
+			missing:  ranges(0, 2),
+		},
+		{
+			name:     "fills a single gap between ranges",
+			add:      []int64{0, 2, 4, 1},
+			received: ranges(0, 2, 4, 4),
+			highest:  4,
+			gaps:     ranges(3, 3),
+			missing:  ranges(3, 3),
+		},
+		{
+			name:     "inserts between ranges",
+			add:      []int64{0, 10, 5},
+			received: ranges(0, 0, 5, 5, 10, 10),
+			highest:  10,
+			gaps:     ranges(1, 4, 6, 9),
+			missing:  ranges(1, 4, 6, 9),
+		},
+		{
+			name:     "large gap",
+			add:      []int64{0, 1 << 40},
+			received: ranges(0, 0, 1<<40, 1<<40),
+			highest:  1 << 40,
+			gaps:     ranges(1, 1<<40-1),
+			missing:  ranges(1, 1<<40-1),
+		},
+		{
+			name:     "announced chunks beyond the highest",
+			add:      []int64{0, 2},
+			expected: 6,
+			received: ranges(0, 0, 2, 2),
+			highest:  2,
+			gaps:     ranges(1, 1),
+			missing:  ranges(1, 1, 3, 5),
+		},
+		{
+			name:     "announced chunks all received",
+			add:      []int64{0, 1, 2},
+			expected: 3,
+			received: ranges(0, 2),
+			highest:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewChunkTracker()
+			tracker.SetExpected(tt.expected)
+
+			var duplicates []int64
+			for _, index := range tt.add {
+				if !tracker.Add(index) {
+					duplicates = append(duplicates, index)
+				}
+			}
+
+			if !reflect.DeepEqual(duplicates, tt.duplicates) {
+				t.Errorf("duplicates %v, want %v", duplicates, tt.duplicates)
+			}
+			if got := tracker.Received(); !reflect.DeepEqual(got, tt.received) {
+				t.Errorf("Received() = %v, want %v", got, tt.received)
+			}
+			if got, want := tracker.Count(), int64(len(tt.add)-len(tt.duplicates)); got != want {
+				t.Errorf("Count() = %d, want %d", got, want)
+			}
+			if got := tracker.Highest(); got != tt.highest {
+				t.Errorf("Highest() = %d, want %d", got, tt.highest)
+			}
+			if got := tracker.Gaps(); !reflect.DeepEqual(got, tt.gaps) {
+				t.Errorf("Gaps() = %v, want %v", got, tt.gaps)
+			}
+			if got := tracker.Missing(); !reflect.DeepEqual(got, tt.missing) {
+				t.Errorf("Missing() = %v, want %v", got, tt.missing)
+			}
+			for _, index := range tt.add {
+				if !tracker.Contains(index) {
+					t.Errorf("Contains(%d) = false for a received chunk", index)
+				}
+			}
+			for _, gap := range tt.gaps {
+				if tracker.Contains(gap.Start) || tracker.Contains(gap.End) {
+					t.Errorf("Contains() = true for a chunk in the gap %v", gap)
+				}
+			}
+		})
+	}
+}
+
+func TestChunkTrackerSetExpected(t *testing.T) {
+	tracker := NewChunkTracker()
+	tracker.Add(0)
+	tracker.SetExpected(5)
+	// A lower count announced later does not shrink the stream
+	tracker.SetExpected(2)
+
+	want := []models.ChunkRange{{Start: 1, End: 4}}
+	if got := tracker.Missing(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Missing() = %v, want %v", got, want)
+	}
+}
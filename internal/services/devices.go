@@ -0,0 +1,223 @@
+package services
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"acquire-app/internal/models"
+)
+
+// deviceKey identifies a physical device across sessions
+type deviceKey struct {
+	vendorID  uint16
+	productID uint16
+	serial    string
+}
+
+func deviceKeyOf(info models.DeviceInfo) deviceKey {
+	return deviceKey{vendorID: info.VendorID, productID: info.ProductID, serial: info.SerialNumber}
+}
+
+// registerDevice returns the registry record of the device described by
+// info, creating it on first sight, and records that it was seen at the
+// given time. A device without a serial number cannot be told apart from
+// others of its model, so it gets a new anonymous record every time. Must be
+// called with the mutex held.
+func (sm *SessionManager) registerDevice(info models.DeviceInfo, seen time.Time) *models.Device {
+	key := deviceKeyOf(info)
+	device, exists := sm.devices[sm.deviceIDs[key]]
+	if key.serial == "" || !exists {
+		device = &models.Device{ID: sm.newDeviceID(key), FirstSeen: seen, Anonymous: key.serial == ""}
+		sm.devices[device.ID] = device
+		if !device.Anonymous {
+			sm.deviceIDs[key] = device.ID
+		}
+		slog.Info("New device registered", "deviceId", device.ID, "productName", info.ProductName, "anonymous", device.Anonymous)
+	}
+
+	device.DeviceInfo = info
+	if seen.After(device.LastSeen) {
+		device.LastSeen = seen
+	}
+	sm.markDeviceDirty(device.ID)
+	return device
+}
+
+// updateCapabilities records the capabilities a device registered with,
+// adding its firmware version to the history when it changed. Must be called
+// with the mutex held.
+func (sm *SessionManager) updateCapabilities(device *models.Device, capabilities models.DeviceCapabilities, seen time.Time) {
+	device.Capabilities = capabilities
+
+	version := capabilities.FirmwareVersion
+	history := device.FirmwareHistory
+	if version != "" && (len(history) == 0 || history[len(history)-1].Version != version) {
+		device.FirmwareHistory = append(history, models.FirmwareRecord{Version: version, FirstSeen: seen})
+	}
+	sm.markDeviceDirty(device.ID)
+}
+
+// newDeviceID derives a readable ID from the identity of a device, with
+// anything but letters, digits, dots and dashes in the serial number
+// replaced, "anonymous" standing in for a missing one, and a counter added
+// should two devices end up with the same ID
+func (sm *SessionManager) newDeviceID(key deviceKey) string {
+	serial := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, key.serial)
+	if serial == "" {
+		serial = "anonymous"
+	}
+
+	base := fmt.Sprintf("dev_%04x_%04x_%s", key.vendorID, key.productID, serial)
+	id := base
+	for n := 2; ; n++ {
+		if _, taken := sm.devices[id]; !taken {
+			return id
+		}
+		id = fmt.Sprintf("%s_%d", base, n)
+	}
+}
+
+// touchDevice records that a device was active. Must be called with the
+// mutex held.
+func (sm *SessionManager) touchDevice(deviceID string, seen time.Time) {
+	if device, exists := sm.devices[deviceID]; exists && seen.After(device.LastSeen) {
+		device.LastSeen = seen
+		sm.markDeviceDirty(deviceID)
+	}
+}
+
+// addDeviceRecording adds the statistics of a finished acquisition to the
+// totals of its device. Must be called with the mutex held.
+func (sm *SessionManager) addDeviceRecording(deviceID string, stats models.FinalStats) {
+	device, exists := sm.devices[deviceID]
+	if !exists {
+		return
+	}
+	device.Statistics.TotalChunks += stats.TotalChunks
+	device.Statistics.TotalBytes += stats.TotalBytes
+	device.Statistics.RecordingSeconds += int64(stats.Duration)
+	sm.markDeviceDirty(deviceID)
+}
+
+// registerLegacyDevices enters the devices of sessions and acquisitions
+// recorded before the registry existed, and moves those records to the
+// registry's device IDs. Must be called with the mutex held, before active
+// acquisitions are interrupted.
+func (sm *SessionManager) registerLegacyDevices() int {
+	var sessions []*models.Session
+	for _, session := range sm.sessions {
+		if _, known := sm.devices[session.DeviceID]; !known {
+			sessions = append(sessions, session)
+		}
+	}
+	// Oldest first, so the firmware history comes out in order
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].StartTime.Before(sessions[j].StartTime) })
+
+	renamed := make(map[string]string)
+	for _, session := range sessions {
+		device := sm.registerDevice(session.DeviceInfo, session.StartTime)
+		sm.updateCapabilities(device, session.Capabilities, session.StartTime)
+		sm.touchDevice(device.ID, session.LastActivity)
+		device.Statistics.Sessions++
+		device.LastSessionID = session.ID
+
+		renamed[session.DeviceID] = device.ID
+		session.DeviceID = device.ID
+		sm.markSessionDirty(session.ID)
+	}
+
+	for _, acquisition := range sm.acquisitions {
+		if _, known := sm.devices[acquisition.DeviceID]; known {
+			continue
+		}
+
+		deviceID, ok := renamed[acquisition.DeviceID]
+		switch {
+		case ok:
+		case acquisition.DeviceID == "":
+			// Recorded before acquisitions kept their device
+			session, exists := sm.sessions[acquisition.SessionID]
+			if !exists {
+				continue
+			}
+			deviceID = session.DeviceID
+		case acquisition.DeviceInfo.SerialNumber != "":
+			// The session is gone, but the acquisition describes the device
+			deviceID = sm.registerDevice(acquisition.DeviceInfo, acquisition.StartTime).ID
+		default:
+			continue
+		}
+
+		acquisition.DeviceID = deviceID
+		sm.devices[deviceID].Statistics.Acquisitions++
+		if !acquisition.Status.Ongoing() {
+			sm.addDeviceRecording(deviceID, acquisition.Statistics)
+		}
+		sm.markAcquisitionDirty(acquisition.ID)
+	}
+
+	return len(sessions)
+}
+
+// GetDevice returns a snapshot of a device's registry record
+func (sm *SessionManager) GetDevice(deviceID string) (*models.Device, error) {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	device, exists := sm.devices[deviceID]
+	if !exists {
+		return nil, fmt.Errorf("device %s not found", deviceID)
+	}
+
+	snapshot := *device
+	return &snapshot, nil
+}
+
+// ListDevices returns snapshots of every registered device, most recently
+// seen first
+func (sm *SessionManager) ListDevices() []models.Device {
+	sm.mutex.RLock()
+	devices := make([]models.Device, 0, len(sm.devices))
+	for _, device := range sm.devices {
+		devices = append(devices, *device)
+	}
+	sm.mutex.RUnlock()
+
+	sort.Slice(devices, func(i, j int) bool {
+		if !devices[i].LastSeen.Equal(devices[j].LastSeen) {
+			return devices[i].LastSeen.After(devices[j].LastSeen)
+		}
+		return devices[i].ID < devices[j].ID
+	})
+	return devices
+}
+
+// AddDeviceNote adds an operator's note to a device
+func (sm *SessionManager) AddDeviceNote(deviceID, operator, text string) (*models.Device, error) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	device, exists := sm.devices[deviceID]
+	if !exists {
+		return nil, fmt.Errorf("device %s not found", deviceID)
+	}
+
+	device.Notes = append(device.Notes, models.DeviceNote{
+		Time:     time.Now(),
+		Operator: operator,
+		Text:     text,
+	})
+	sm.markDeviceDirty(deviceID)
+	sm.requestFlush()
+
+	snapshot := *device
+	return &snapshot, nil
+}
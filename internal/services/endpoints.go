@@ -0,0 +1,120 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"acquire-app/internal/models"
+)
+
+var (
+	ErrUnknownEndpoint   = errors.New("device has no such IN endpoint")
+	ErrAmbiguousEndpoint = errors.New("endpoint number is used on several interfaces")
+	ErrEndpointBusy      = errors.New("endpoint is already recording")
+)
+
+// bindEndpoint picks the interface and endpoint a new acquisition of the
+// session records from: the first IN endpoint the device registered that
+// matches the requested interface and endpoint number, where either may be
+// left out. An endpoint number found on several interfaces must come with
+// its interface. Acquisitions of devices that registered no IN endpoints
+// are not bound to one.
+func bindEndpoint(session *models.Session, requestedInterface *int, requestedEndpoint int) (*models.EndpointBinding, error) {
+	var endpoints []models.EndpointBinding
+	for _, endpoint := range session.ConnectionDetails.Endpoints {
+		if strings.EqualFold(endpoint.Direction, "in") {
+			endpoints = append(endpoints, endpointBinding(session.ConnectionDetails, endpoint))
+		}
+	}
+	if requestedInterface == nil && requestedEndpoint == 0 && len(endpoints) == 0 {
+		return nil, nil
+	}
+
+	matches := slices.DeleteFunc(endpoints, func(endpoint models.EndpointBinding) bool {
+		return (requestedInterface != nil && endpoint.InterfaceNumber != *requestedInterface) ||
+			(requestedEndpoint != 0 && endpoint.EndpointNumber != requestedEndpoint)
+	})
+	switch {
+	case len(matches) == 0:
+		return nil, fmt.Errorf("%s: %w", describeEndpoint(requestedInterface, requestedEndpoint), ErrUnknownEndpoint)
+	case len(matches) > 1 && requestedInterface == nil && requestedEndpoint != 0:
+		return nil, fmt.Errorf("%s: %w", describeEndpoint(requestedInterface, requestedEndpoint), ErrAmbiguousEndpoint)
+	}
+
+	return &matches[0], nil
+}
+
+// endpointBinding is the interface and number of a registered endpoint.
+// Endpoints registered without an interface belong to the interface of the
+// connection.
+func endpointBinding(details models.ConnectionDetails, endpoint models.EndpointInfo) models.EndpointBinding {
+	binding := models.EndpointBinding{
+		InterfaceNumber: details.InterfaceNumber,
+		EndpointNumber:  endpoint.Number,
+	}
+	if endpoint.InterfaceNumber != nil {
+		binding.InterfaceNumber = *endpoint.InterfaceNumber
+	}
+	return binding
+}
+
+// describeEndpoint names a requested endpoint in error messages
+func describeEndpoint(requestedInterface *int, requestedEndpoint int) string {
+	switch {
+	case requestedInterface == nil:
+		return fmt.Sprintf("endpoint %d", requestedEndpoint)
+	case requestedEndpoint == 0:
+		return fmt.Sprintf("interface %d", *requestedInterface)
+	default:
+		return fmt.Sprintf("interface %d endpoint %d", *requestedInterface, requestedEndpoint)
+	}
+}
+
+// sameEndpoint reports whether two acquisitions record from the same
+// endpoint; unbound acquisitions share one
+func sameEndpoint(a, b *models.EndpointBinding) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// removeActiveAcquisition takes an acquisition that has ended off its
+// session's list of ongoing acquisitions. The list is replaced rather than
+// edited in place, as snapshots being persisted may still share it. Must be
+// called with the mutex held.
+func (sm *SessionManager) removeActiveAcquisition(acquisition *models.Acquisition) {
+	session, exists := sm.sessions[acquisition.SessionID]
+	if !exists {
+		return
+	}
+	var active []string
+	for _, id := range session.ActiveAcquisitions {
+		if id != acquisition.ID {
+			active = append(active, id)
+		}
+	}
+	session.ActiveAcquisitions = active
+	sm.markSessionDirty(session.ID)
+}
+
+// SessionAcquisitions returns the ongoing acquisitions of a session, oldest
+// first
+func (sm *SessionManager) SessionAcquisitions(sessionID string) []*models.Acquisition {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	var acquisitions []*models.Acquisition
+	for _, acquisition := range sm.acquisitions {
+		if acquisition.SessionID == sessionID && acquisition.Status.Ongoing() {
+			acquisitions = append(acquisitions, acquisition)
+		}
+	}
+	sort.Slice(acquisitions, func(i, j int) bool {
+		return acquisitions[i].StartTime.Before(acquisitions[j].StartTime)
+	})
+	return acquisitions
+}
@@ -0,0 +1,45 @@
+package services
+
+import "sync/atomic"
+
+// FlowController tracks the chunks that have been received on any stream
+// connection but not yet processed, and derives from it how much credit the
+// server can currently grant to clients
+type FlowController struct {
+	queued   atomic.Int64
+	capacity int64
+}
+
+// NewFlowController creates a controller that considers the server fully
+// loaded once capacity chunks are waiting to be processed
+func NewFlowController(capacity int64) *FlowController {
+	return &FlowController{capacity: capacity}
+}
+
+// Enqueued records a chunk waiting to be processed
+func (fc *FlowController) Enqueued() {
+	fc.queued.Add(1)
+}
+
+// Dequeued records that a queued chunk has been processed
+func (fc *FlowController) Dequeued() {
+	fc.queued.Add(-1)
+}
+
+// QueueDepth returns the number of chunks waiting to be processed
+func (fc *FlowController) QueueDepth() int64 {
+	return fc.queued.Load()
+}
+
+// Load returns the processing queue utilization between 0 and 1
+func (fc *FlowController) Load() float64 {
+	if fc.capacity <= 0 {
+		return 0
+	}
+
+	load := float64(fc.queued.Load()) / float64(fc.capacity)
+	if load > 1 {
+		return 1
+	}
+	return load
+}
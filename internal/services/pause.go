@@ -0,0 +1,114 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"acquire-app/internal/models"
+)
+
+// PauseAcquisition halts an active acquisition until it is resumed. The
+// pause begins after the highest chunk received so far; the stream continues
+// from the next index on resume. The timer of a requested duration is held
+// for as long as the pause lasts.
+func (sm *SessionManager) PauseAcquisition(acquisitionID, reason string) (*models.Acquisition, error) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	acquisition, exists := sm.acquisitions[acquisitionID]
+	if !exists {
+		return nil, fmt.Errorf("acquisition %s not found", acquisitionID)
+	}
+
+	if err := sm.transitionAcquisition(acquisition, models.AcquisitionPaused, reason); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	pause := models.PauseInterval{Start: now}
+	if tracker, exists := sm.chunkTrackers[acquisitionID]; exists {
+		pause.ResumeChunk = tracker.Highest() + 1
+	}
+	acquisition.Pauses = append(acquisition.Pauses, pause)
+	sm.cancelAutoStop(acquisitionID)
+	sm.markAcquisitionDirty(acquisitionID)
+
+	if session, exists := sm.sessions[acquisition.SessionID]; exists {
+		session.LastActivity = now
+		sm.markSessionDirty(session.ID)
+	}
+
+	sm.requestFlush()
+	return acquisition, nil
+}
+
+// ResumeAcquisition continues a paused acquisition. The pause is closed, and
+// the end of a requested duration moves back by the length of the pause.
+func (sm *SessionManager) ResumeAcquisition(acquisitionID, reason string) (*models.Acquisition, error) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	acquisition, exists := sm.acquisitions[acquisitionID]
+	if !exists {
+		return nil, fmt.Errorf("acquisition %s not found", acquisitionID)
+	}
+
+	if acquisition.Status != models.AcquisitionPaused {
+		return nil, &StateError{Entity: "acquisition", ID: acquisitionID, State: string(acquisition.Status), Action: "be resumed"}
+	}
+	if err := sm.transitionAcquisition(acquisition, models.AcquisitionActive, reason); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if n := len(acquisition.Pauses); n > 0 {
+		pause := &acquisition.Pauses[n-1]
+		pause.End = &now
+		if acquisition.StopAt != nil {
+			stopAt := acquisition.StopAt.Add(now.Sub(pause.Start))
+			acquisition.StopAt = &stopAt
+		}
+	}
+	sm.scheduleAutoStop(acquisition)
+	sm.markAcquisitionDirty(acquisitionID)
+
+	if session, exists := sm.sessions[acquisition.SessionID]; exists {
+		session.LastActivity = now
+		sm.markSessionDirty(session.ID)
+	}
+
+	sm.requestFlush()
+	return acquisition, nil
+}
+
+// IsPaused reports whether an acquisition is paused
+func (sm *SessionManager) IsPaused(acquisitionID string) bool {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	acquisition, exists := sm.acquisitions[acquisitionID]
+	return exists && acquisition.Status == models.AcquisitionPaused
+}
+
+// pausedTime returns how long an acquisition has been paused in total, up to
+// now for a pause that has not ended
+func pausedTime(acquisition *models.Acquisition) time.Duration {
+	var paused time.Duration
+	for _, pause := range acquisition.Pauses {
+		end := time.Now()
+		if pause.End != nil {
+			end = *pause.End
+		}
+		paused += end.Sub(pause.Start)
+	}
+	return paused
+}
+
+// averageDataRate is the data rate of an acquisition over the time it was
+// recording, leaving out its pauses
+func averageDataRate(stats models.FinalStats) int64 {
+	recording := stats.Duration - stats.PausedDuration
+	if recording <= 0 {
+		return 0
+	}
+	return stats.TotalBytes / int64(recording)
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"acquire-app/internal/models"
+)
+
+// Repository persists sessions, acquisitions and the device registry so they
+// survive a restart. The SessionManager keeps its working set in memory and
+// writes changes through to the repository; implementations only need to
+// store and return whole records.
+type Repository interface {
+	LoadSessions() ([]*models.Session, error)
+	LoadAcquisitions() ([]*models.Acquisition, error)
+	LoadDevices() ([]*models.Device, error)
+	SaveSession(session *models.Session) error
+	SaveAcquisition(acquisition *models.Acquisition) error
+	SaveDevice(device *models.Device) error
+	DeleteSession(sessionID string) error
+	DeleteAcquisition(acquisitionID string) error
+	// QueryAcquisitions searches the stored acquisitions. Limit is at least 1.
+	QueryAcquisitions(query AcquisitionQuery) (*AcquisitionPage, error)
+	Close() error
+}
+
+// MemoryRepository is a Repository that keeps records in memory only. State
+// is lost on restart, as before sessions were persisted.
+type MemoryRepository struct {
+	sessions     map[string]models.Session
+	acquisitions map[string]models.Acquisition
+	devices      map[string]models.Device
+	mutex        sync.Mutex
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		sessions:     make(map[string]models.Session),
+		acquisitions: make(map[string]models.Acquisition),
+		devices:      make(map[string]models.Device),
+	}
+}
+
+func (r *MemoryRepository) LoadSessions() ([]*models.Session, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	sessions := make([]*models.Session, 0, len(r.sessions))
+	for _, session := range r.sessions {
+		session := session
+		sessions = append(sessions, &session)
+	}
+	return sessions, nil
+}
+
+func (r *MemoryRepository) LoadAcquisitions() ([]*models.Acquisition, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	acquisitions := make([]*models.Acquisition, 0, len(r.acquisitions))
+	for _, acquisition := range r.acquisitions {
+		acquisition := acquisition
+		acquisitions = append(acquisitions, &acquisition)
+	}
+	return acquisitions, nil
+}
+
+func (r *MemoryRepository) LoadDevices() ([]*models.Device, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	devices := make([]*models.Device, 0, len(r.devices))
+	for _, device := range r.devices {
+		device := device
+		devices = append(devices, &device)
+	}
+	return devices, nil
+}
+
+func (r *MemoryRepository) SaveSession(session *models.Session) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.sessions[session.ID] = *session
+	return nil
+}
+
+func (r *MemoryRepository) SaveAcquisition(acquisition *models.Acquisition) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.acquisitions[acquisition.ID] = *acquisition
+	return nil
+}
+
+func (r *MemoryRepository) SaveDevice(device *models.Device) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.devices[device.ID] = *device
+	return nil
+}
+
+func (r *MemoryRepository) DeleteSession(sessionID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.sessions, sessionID)
+	return nil
+}
+
+func (r *MemoryRepository) DeleteAcquisition(acquisitionID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.acquisitions, acquisitionID)
+	return nil
+}
+
+// QueryAcquisitions filters, sorts and pages the stored acquisitions
+func (r *MemoryRepository) QueryAcquisitions(query AcquisitionQuery) (*AcquisitionPage, error) {
+	after, err := query.CursorKey()
+	if err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	var matches []*models.Acquisition
+	for _, acquisition := range r.acquisitions {
+		if query.Matches(&acquisition) {
+			acquisition := acquisition
+			matches = append(matches, &acquisition)
+		}
+	}
+	r.mutex.Unlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		order := bytes.Compare(query.SortKey(matches[i]), query.SortKey(matches[j]))
+		if query.Descending {
+			return order > 0
+		}
+		return order < 0
+	})
+
+	page := &AcquisitionPage{}
+	for _, acquisition := range matches {
+		key := query.SortKey(acquisition)
+		if after != nil {
+			order := bytes.Compare(key, after)
+			if order == 0 || (order < 0) != query.Descending {
+				continue
+			}
+		}
+		if len(page.Acquisitions) == query.Limit {
+			page.NextCursor = EncodeCursor(query.SortKey(page.Acquisitions[query.Limit-1]))
+			break
+		}
+		page.Acquisitions = append(page.Acquisitions, acquisition)
+	}
+	return page, nil
+}
+
+func (r *MemoryRepository) Close() error {
+	return nil
+}
@@ -1,39 +1,232 @@
 package services
 
 import (
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"acquire-app/internal/dicom"
 	"acquire-app/internal/models"
 )
 
+var (
+	ErrAcquisitionNotActive = errors.New("acquisition is not active")
+	ErrAcquisitionPaused    = errors.New("acquisition is paused")
+	ErrInvalidResumeToken   = errors.New("invalid resume token")
+)
+
+// DefaultAcquisitionSettings is the sample format handed out to devices at
+// registration: 16-bit mono PCM at 44.1kHz
+var DefaultAcquisitionSettings = models.AcquisitionSettings{
+	SampleRate: 44100,
+	BitDepth:   16,
+	Channels:   1,
+}
+
+// persistInterval is how often changed statistics are written to the
+// repository; lifecycle changes are written right away
+const persistInterval = 2 * time.Second
+
 type SessionManager struct {
-	sessions     map[string]*models.Session
-	acquisitions map[string]*models.Acquisition
-	mutex        sync.RWMutex
+	sessions      map[string]*models.Session
+	acquisitions  map[string]*models.Acquisition
+	chunkTrackers map[string]*ChunkTracker
+	// devices is the device registry, keyed by device ID; deviceIDs finds
+	// the record of a physical device
+	devices   map[string]*models.Device
+	deviceIDs map[deviceKey]string
+	// timers stop acquisitions when their requested duration elapses
+	timers          map[string]*time.Timer
+	autoStopHandler func(acquisition *models.Acquisition)
+	mutex           sync.RWMutex
+
+	repository Repository
+
+	// Sessions, acquisitions and devices changed since the last flush; an ID
+	// that is no longer in the maps was deleted
+	dirtySessions     map[string]struct{}
+	dirtyAcquisitions map[string]struct{}
+	dirtyDevices      map[string]struct{}
+	flushMutex        sync.Mutex
+	flushRequests     chan struct{}
+	done              chan struct{}
+	flusherDone       chan struct{}
+}
+
+// NewSessionManager restores the sessions and acquisitions stored in the
+// repository. Acquisitions recording for a requested duration carry on: the
+// timer of an active one is armed again, and once the caller has reopened
+// its storage and called RestoreStream the client can reconnect with its
+// resume token. If the duration elapsed while the server was down, the
+// acquisition is stopped as its timer would have. Open-ended acquisitions
+// lost their stream and are marked "interrupted", because nothing but their
+// client would ever end them.
+func NewSessionManager(repository Repository) (*SessionManager, error) {
+	sm := &SessionManager{
+		sessions:          make(map[string]*models.Session),
+		acquisitions:      make(map[string]*models.Acquisition),
+		chunkTrackers:     make(map[string]*ChunkTracker),
+		devices:           make(map[string]*models.Device),
+		deviceIDs:         make(map[deviceKey]string),
+		timers:            make(map[string]*time.Timer),
+		repository:        repository,
+		dirtySessions:     make(map[string]struct{}),
+		dirtyAcquisitions: make(map[string]struct{}),
+		dirtyDevices:      make(map[string]struct{}),
+		flushRequests:     make(chan struct{}, 1),
+		done:              make(chan struct{}),
+		flusherDone:       make(chan struct{}),
+	}
+
+	devices, err := repository.LoadDevices()
+	if err != nil {
+		return nil, fmt.Errorf("load devices: %w", err)
+	}
+	for _, device := range devices {
+		sm.devices[device.ID] = device
+		if !device.Anonymous {
+			sm.deviceIDs[deviceKeyOf(device.DeviceInfo)] = device.ID
+		}
+	}
+
+	sessions, err := repository.LoadSessions()
+	if err != nil {
+		return nil, fmt.Errorf("load sessions: %w", err)
+	}
+	for _, session := range sessions {
+		sm.sessions[session.ID] = session
+	}
+
+	acquisitions, err := repository.LoadAcquisitions()
+	if err != nil {
+		return nil, fmt.Errorf("load acquisitions: %w", err)
+	}
+	for _, acquisition := range acquisitions {
+		sm.acquisitions[acquisition.ID] = acquisition
+		// Acquisitions stored before DICOM export existed get their UIDs now
+		if acquisition.DICOMUIDs == nil {
+			acquisition.DICOMUIDs = newDICOMUIDs()
+			sm.markAcquisitionDirty(acquisition.ID)
+		}
+	}
+
+	legacy := sm.registerLegacyDevices()
+
+	interrupted, completed, continued := 0, 0, 0
+	now := time.Now()
+	for _, acquisition := range acquisitions {
+		if !acquisition.Status.Ongoing() {
+			continue
+		}
+		switch {
+		case acquisition.StopAt == nil:
+			sm.interruptAcquisition(acquisition)
+			interrupted++
+		case acquisition.Status == models.AcquisitionActive && !acquisition.StopAt.After(now):
+			sm.completeAcquisition(acquisition)
+			completed++
+		default:
+			// A paused acquisition's timer is armed when it resumes
+			if acquisition.Status == models.AcquisitionActive {
+				sm.scheduleAutoStop(acquisition)
+			}
+			continued++
+		}
+	}
+
+	if err := sm.Flush(); err != nil {
+		return nil, err
+	}
+
+	if len(sessions) > 0 || len(acquisitions) > 0 {
+		slog.Info("Restored sessions from repository",
+			"sessions", len(sessions),
+			"acquisitions", len(acquisitions),
+			"devices", len(sm.devices),
+			"legacyDevices", legacy,
+			"interrupted", interrupted,
+			"durationReached", completed,
+			"continued", continued)
+	}
+
+	go sm.runFlusher()
+	return sm, nil
 }
 
-func NewSessionManager() *SessionManager {
-	return &SessionManager{
-		sessions:     make(map[string]*models.Session),
-		acquisitions: make(map[string]*models.Acquisition),
+// newDICOMUIDs generates the DICOM identifiers of a new acquisition
+func newDICOMUIDs() *models.DICOMUIDs {
+	return &models.DICOMUIDs{
+		StudyInstanceUID:  dicom.NewUID(),
+		SeriesInstanceUID: dicom.NewUID(),
+		SOPInstanceUID:    dicom.NewUID(),
+	}
+}
+
+// interruptAcquisition finalizes an acquisition whose stream was lost with
+// the previous server process. Its chunk bookkeeping is gone, so it can never
+// be reported complete. Must be called with the mutex held.
+func (sm *SessionManager) interruptAcquisition(acquisition *models.Acquisition) {
+	sm.transitionAcquisition(acquisition, models.AcquisitionInterrupted, "stream lost with the previous server process")
+
+	// The last recorded activity is the best estimate of when data stopped
+	end := acquisition.StartTime
+	if session, exists := sm.sessions[acquisition.SessionID]; exists {
+		if session.LastActivity.After(end) {
+			end = session.LastActivity
+		}
+		session.DeviceConnected = false
+		sm.markSessionDirty(session.ID)
+	}
+
+	sm.finalizeAcquisition(acquisition, end)
+	acquisition.Statistics.Complete = false
+	sm.markAcquisitionDirty(acquisition.ID)
+}
+
+// completeAcquisition stops an acquisition whose requested duration elapsed
+// while the server was down. It ends at its StopAt time, or at the session's
+// last activity if data stopped coming before that. As with an interrupted
+// acquisition, its chunk bookkeeping is gone. Must be called with the mutex
+// held.
+func (sm *SessionManager) completeAcquisition(acquisition *models.Acquisition) {
+	end := *acquisition.StopAt
+	if session, exists := sm.sessions[acquisition.SessionID]; exists && session.LastActivity.Before(end) {
+		end = session.LastActivity
+	}
+	if end.Before(acquisition.StartTime) {
+		end = acquisition.StartTime
+	}
+
+	sm.stopAcquisition(acquisition, StopReasonDurationReached, end)
+	acquisition.Statistics.Complete = false
+	if session, exists := sm.sessions[acquisition.SessionID]; exists {
+		session.DeviceConnected = false
+		sm.markSessionDirty(session.ID)
 	}
 }
 
 // Session management methods
-func (sm *SessionManager) CreateSession(deviceInfo models.DeviceInfo, capabilities models.DeviceCapabilities) (*models.Session, error) {
+func (sm *SessionManager) CreateSession(deviceInfo models.DeviceInfo, capabilities models.DeviceCapabilities, connection models.ConnectionDetails) (*models.Session, error) {
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
 
 	sessionID := fmt.Sprintf("sess_%s", uuid.New().String()[:12])
-	deviceID := fmt.Sprintf("dev_%s_%s", deviceInfo.ProductName, deviceInfo.SerialNumber)
+
+	// A returning device gets its existing registry record
+	now := time.Now()
+	device := sm.registerDevice(deviceInfo, now)
+	sm.updateCapabilities(device, capabilities, now)
+	device.Statistics.Sessions++
+	device.LastSessionID = sessionID
 
 	session := &models.Session{
 		ID:              sessionID,
-		DeviceID:        deviceID,
-		Status:          "created",
+		DeviceID:        device.ID,
 		DeviceConnected: false,
 		StartTime:       time.Now(),
 		LastActivity:    time.Now(),
@@ -48,11 +241,17 @@ func (sm *SessionManager) CreateSession(deviceInfo models.DeviceInfo, capabiliti
 			BatteryLevel:    0,
 			LastHealthCheck: time.Now(),
 		},
-		DeviceInfo:   deviceInfo,
-		Capabilities: capabilities,
+		DeviceInfo:          deviceInfo,
+		Capabilities:        capabilities,
+		AcquisitionSettings: DefaultAcquisitionSettings,
+		ConnectionDetails:   connection,
 	}
 
+	// The initial state is always allowed
+	sm.transitionSession(session, models.SessionCreated, "device registered")
+
 	sm.sessions[sessionID] = session
+	sm.requestFlush()
 	return session, nil
 }
 
@@ -79,10 +278,14 @@ func (sm *SessionManager) UpdateSession(sessionID string, updates func(*models.S
 
 	updates(session)
 	session.LastActivity = time.Now()
+	sm.markSessionDirty(sessionID)
+	sm.requestFlush()
 	return nil
 }
 
-func (sm *SessionManager) CloseSession(sessionID string) error {
+// ActivateSession records that the device of a session connected. A session
+// that is already active stays so, as when the device reconnects.
+func (sm *SessionManager) ActivateSession(sessionID string) error {
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
 
@@ -90,20 +293,46 @@ func (sm *SessionManager) CloseSession(sessionID string) error {
 	if !exists {
 		return fmt.Errorf("session %s not found", sessionID)
 	}
+	if session.Status == models.SessionActive {
+		return nil
+	}
+
+	if err := sm.transitionSession(session, models.SessionActive, "device connected"); err != nil {
+		return err
+	}
+	sm.requestFlush()
+	return nil
+}
 
-	session.Status = "closed"
+// CloseSession ends a session for the given reason, stopping its active
+// acquisition
+func (sm *SessionManager) CloseSession(sessionID, reason string) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	session, exists := sm.sessions[sessionID]
+	if !exists {
+		return fmt.Errorf("session %s not found", sessionID)
+	}
+
+	if err := sm.transitionSession(session, models.SessionClosed, reason); err != nil {
+		return err
+	}
 	session.DeviceConnected = false
 	session.LastActivity = time.Now()
+	sm.markSessionDirty(sessionID)
+	sm.touchDevice(session.DeviceID, session.LastActivity)
 
 	// Clean up any active acquisitions for this session
 	for _, acq := range sm.acquisitions {
-		if acq.SessionID == sessionID && acq.Status == "active" {
-			now := time.Now()
-			acq.Status = "stopped"
-			acq.EndTime = &now
+		if acq.SessionID == sessionID && acq.Status.Ongoing() {
+			sm.transitionAcquisition(acq, models.AcquisitionStopped, "session closed")
+			sm.finalizeAcquisition(acq, time.Now())
+			sm.markAcquisitionDirty(acq.ID)
 		}
 	}
 
+	sm.requestFlush()
 	return nil
 }
 
@@ -116,19 +345,24 @@ func (sm *SessionManager) DeleteSession(sessionID string) error {
 	}
 
 	delete(sm.sessions, sessionID)
+	sm.markSessionDirty(sessionID)
 
 	// Clean up acquisitions for this session
 	for acqID, acq := range sm.acquisitions {
 		if acq.SessionID == sessionID {
 			delete(sm.acquisitions, acqID)
+			delete(sm.chunkTrackers, acqID)
+			sm.cancelAutoStop(acqID)
+			sm.markAcquisitionDirty(acqID)
 		}
 	}
 
+	sm.requestFlush()
 	return nil
 }
 
 // Acquisition management methods
-func (sm *SessionManager) CreateAcquisition(sessionID string, params models.AcquisitionParams, metadata models.AcquisitionMetadata) (*models.Acquisition, error) {
+func (sm *SessionManager) CreateAcquisition(sessionID string, params models.AcquisitionParams, metadata models.AcquisitionMetadata, compression string) (*models.Acquisition, error) {
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
 
@@ -138,10 +372,23 @@ func (sm *SessionManager) CreateAcquisition(sessionID string, params models.Acqu
 		return nil, fmt.Errorf("session %s not found", sessionID)
 	}
 
-	// Check if there's already an active acquisition for this session
+	// Data can only be acquired from a connected device
+	if session.Status != models.SessionActive {
+		return nil, &StateError{Entity: "session", ID: sessionID, State: string(session.Status), Action: "start an acquisition"}
+	}
+
+	// Each endpoint records one acquisition at a time
+	endpoint, err := bindEndpoint(session, params.Interface, params.Endpoint)
+	if err != nil {
+		return nil, err
+	}
 	for _, acq := range sm.acquisitions {
-		if acq.SessionID == sessionID && acq.Status == "active" {
-			return nil, fmt.Errorf("session %s already has an active acquisition", sessionID)
+		if acq.SessionID == sessionID && acq.Status.Ongoing() && sameEndpoint(acq.Endpoint, endpoint) {
+			if endpoint != nil {
+				return nil, fmt.Errorf("acquisition %s of session %s on interface %d endpoint %d: %w",
+					acq.ID, sessionID, endpoint.InterfaceNumber, endpoint.EndpointNumber, ErrEndpointBusy)
+			}
+			return nil, fmt.Errorf("acquisition %s of session %s: %w", acq.ID, sessionID, ErrEndpointBusy)
 		}
 	}
 
@@ -150,7 +397,6 @@ func (sm *SessionManager) CreateAcquisition(sessionID string, params models.Acqu
 	acquisition := &models.Acquisition{
 		ID:         acquisitionID,
 		SessionID:  sessionID,
-		Status:     "active",
 		StartTime:  time.Now(),
 		Parameters: params,
 		Metadata:   metadata,
@@ -160,15 +406,38 @@ func (sm *SessionManager) CreateAcquisition(sessionID string, params models.Acqu
 			Duration:        0,
 			AverageDataRate: 0,
 		},
-		DataPath: fmt.Sprintf("./data/acquisitions/%s", acquisitionID),
+		DataPath:    fmt.Sprintf("./data/acquisitions/%s", acquisitionID),
+		Compression: compression,
+		Endpoint:    endpoint,
+		DeviceID:    session.DeviceID,
+		DeviceInfo:  session.DeviceInfo,
+		DICOMUIDs:   newDICOMUIDs(),
+		Settings:    session.AcquisitionSettings,
+		ResumeToken: uuid.New().String(),
 	}
+	if params.Duration > 0 {
+		stopAt := acquisition.StartTime.Add(time.Duration(params.Duration) * time.Second)
+		acquisition.StopAt = &stopAt
+	}
+
+	sm.transitionAcquisition(acquisition, models.AcquisitionActive, fmt.Sprintf("%d Hz, %d bit, %d channels",
+		acquisition.Settings.SampleRate, acquisition.Settings.BitDepth, acquisition.Settings.Channels))
 
 	sm.acquisitions[acquisitionID] = acquisition
-	
-	// Update session with current acquisition
-	session.CurrentAcquisition = acquisitionID
+	sm.chunkTrackers[acquisitionID] = NewChunkTracker()
+	sm.scheduleAutoStop(acquisition)
+	if device, exists := sm.devices[session.DeviceID]; exists {
+		device.Statistics.Acquisitions++
+		sm.markDeviceDirty(device.ID)
+	}
+
+	// Add the acquisition to the session's ongoing ones
+	session.ActiveAcquisitions = append(session.ActiveAcquisitions, acquisitionID)
 	session.LastActivity = time.Now()
 
+	sm.markAcquisitionDirty(acquisitionID)
+	sm.markSessionDirty(sessionID)
+	sm.requestFlush()
 	return acquisition, nil
 }
 
@@ -193,52 +462,283 @@ func (sm *SessionManager) StopAcquisition(acquisitionID string, reason string) (
 		return nil, fmt.Errorf("acquisition %s not found", acquisitionID)
 	}
 
-	if acquisition.Status != "active" {
-		return nil, fmt.Errorf("acquisition %s is not active", acquisitionID)
+	if err := sm.stopAcquisition(acquisition, reason, time.Now()); err != nil {
+		return nil, err
 	}
 
-	now := time.Now()
-	acquisition.Status = "stopped"
-	acquisition.EndTime = &now
+	sm.requestFlush()
+	return acquisition, nil
+}
 
-	// Calculate final statistics
-	duration := int(now.Sub(acquisition.StartTime).Seconds())
-	acquisition.Statistics.Duration = duration
+// stopAcquisition ends an active acquisition at the given time. Must be
+// called with the mutex held.
+func (sm *SessionManager) stopAcquisition(acquisition *models.Acquisition, reason string, end time.Time) error {
+	if err := sm.transitionAcquisition(acquisition, models.AcquisitionStopped, reason); err != nil {
+		return err
+	}
+	sm.finalizeAcquisition(acquisition, end)
+	sm.markAcquisitionDirty(acquisition.ID)
+
+	if session, exists := sm.sessions[acquisition.SessionID]; exists {
+		if end.After(session.LastActivity) {
+			session.LastActivity = end
+		}
+		sm.markSessionDirty(session.ID)
+	}
+	return nil
+}
+
+// AttachStream registers a new stream connection for an acquisition. The first
+// connection needs no token; any later one is a reconnection and must present
+// the acquisition's resume token. It reports whether the connection resumes
+// an earlier stream.
+func (sm *SessionManager) AttachStream(acquisitionID, resumeToken string) (bool, error) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	acquisition, exists := sm.acquisitions[acquisitionID]
+	if !exists {
+		return false, fmt.Errorf("acquisition %s not found", acquisitionID)
+	}
+
+	if !acquisition.Status.Ongoing() {
+		return false, fmt.Errorf("acquisition %s: %w", acquisitionID, ErrAcquisitionNotActive)
+	}
 
-	if duration > 0 {
-		acquisition.Statistics.AverageDataRate = acquisition.Statistics.TotalBytes / int64(duration)
+	resumed := acquisition.StreamConnections > 0
+	if resumed && subtle.ConstantTimeCompare([]byte(resumeToken), []byte(acquisition.ResumeToken)) != 1 {
+		return false, fmt.Errorf("acquisition %s: %w", acquisitionID, ErrInvalidResumeToken)
 	}
 
-	// Update session to clear current acquisition
+	acquisition.StreamConnections++
+	sm.markAcquisitionDirty(acquisitionID)
 	if session, exists := sm.sessions[acquisition.SessionID]; exists {
-		session.CurrentAcquisition = ""
+		if resumed {
+			session.Statistics.ReconnectionCount++
+		}
 		session.LastActivity = time.Now()
+		sm.markSessionDirty(session.ID)
 	}
 
-	return acquisition, nil
+	sm.requestFlush()
+	return resumed, nil
 }
 
-func (sm *SessionManager) UpdateAcquisitionStats(acquisitionID string, totalChunks, totalBytes int64) error {
+// ChunkGaps returns the chunk ranges missing below the highest chunk received
+// for an active acquisition
+func (sm *SessionManager) ChunkGaps(acquisitionID string) []models.ChunkRange {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	if tracker, exists := sm.chunkTrackers[acquisitionID]; exists {
+		return tracker.Gaps()
+	}
+	return nil
+}
+
+// ChunkReceipt describes the effect of recording a chunk
+type ChunkReceipt struct {
+	// New is false if the chunk had already been received
+	New bool
+	// Gap is the range of chunks skipped by this chunk, if it opened one
+	Gap *models.ChunkRange
+	// Gaps lists every chunk range still outstanding below the highest index
+	Gaps []models.ChunkRange
+}
+
+// RecordChunk registers a stored chunk and updates acquisition and session
+// statistics. Duplicates are only counted. expectedTotal is the sender's
+// announced chunk count, or 0 if unknown.
+func (sm *SessionManager) RecordChunk(acquisitionID string, chunkIndex, size, expectedTotal int64) (*ChunkReceipt, error) {
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
 
 	acquisition, exists := sm.acquisitions[acquisitionID]
 	if !exists {
-		return fmt.Errorf("acquisition %s not found", acquisitionID)
+		return nil, fmt.Errorf("acquisition %s not found", acquisitionID)
 	}
 
-	acquisition.Statistics.TotalChunks = totalChunks
-	acquisition.Statistics.TotalBytes = totalBytes
+	tracker := sm.chunkTrackers[acquisitionID]
+	if tracker == nil {
+		return nil, fmt.Errorf("acquisition %s is not accepting chunks", acquisitionID)
+	}
+
+	tracker.SetExpected(expectedTotal)
+	highest := tracker.Highest()
+
+	receipt := &ChunkReceipt{New: tracker.Add(chunkIndex)}
+	if !receipt.New {
+		acquisition.Statistics.DuplicateChunks++
+		sm.markAcquisitionDirty(acquisitionID)
+		receipt.Gaps = tracker.Gaps()
+		return receipt, nil
+	}
+
+	if chunkIndex > highest+1 {
+		receipt.Gap = &models.ChunkRange{Start: highest + 1, End: chunkIndex - 1}
+	}
+	receipt.Gaps = tracker.Gaps()
+
+	acquisition.Statistics.TotalChunks = tracker.Count()
+	acquisition.Statistics.TotalBytes += size
+	sm.markAcquisitionDirty(acquisitionID)
 
-	// Update session statistics as well
 	if session, exists := sm.sessions[acquisition.SessionID]; exists {
-		session.Statistics.TotalDataTransferred += totalBytes
+		session.Statistics.TotalDataTransferred += size
 		session.LastActivity = time.Now()
+		sm.markSessionDirty(session.ID)
 	}
 
+	return receipt, nil
+}
+
+// RecordRecovery replaces the chunk statistics of an acquisition recovered
+// from its journal after a restart with what actually survived: chunks lists
+// the indices of the intact chunks and totalBytes their combined size.
+func (sm *SessionManager) RecordRecovery(acquisitionID string, chunks []int64, totalBytes int64) (*models.Acquisition, error) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	acquisition, exists := sm.acquisitions[acquisitionID]
+	if !exists {
+		return nil, fmt.Errorf("acquisition %s not found", acquisitionID)
+	}
+
+	tracker := NewChunkTracker()
+	for _, index := range chunks {
+		tracker.Add(index)
+	}
+	// Chunks already known to be missing at the end of the stream still are
+	for _, missing := range acquisition.Statistics.MissingChunks {
+		tracker.SetExpected(missing.End + 1)
+	}
+
+	stats := &acquisition.Statistics
+	sm.addDeviceRecording(acquisition.DeviceID, models.FinalStats{
+		TotalChunks: tracker.Count() - stats.TotalChunks,
+		TotalBytes:  totalBytes - stats.TotalBytes,
+	})
+	stats.TotalChunks = tracker.Count()
+	stats.TotalBytes = totalBytes
+	stats.IntactChunks = tracker.Received()
+	stats.MissingChunks = tracker.Missing()
+	stats.Complete = stats.Complete && len(stats.MissingChunks) == 0
+	stats.AverageDataRate = averageDataRate(*stats)
+	sm.recordEvent(acquisition, "recovered", fmt.Sprintf("%d chunks, %d bytes intact", stats.TotalChunks, totalBytes))
+
+	sm.markAcquisitionDirty(acquisitionID)
+	sm.requestFlush()
+	return acquisition, nil
+}
+
+// RestoreStream rebuilds the chunk bookkeeping of an acquisition that
+// carried on across a restart from what its reopened storage holds: chunks
+// lists the indices of the stored chunks and totalBytes their combined size.
+// The acquisition accepts chunks again afterwards.
+func (sm *SessionManager) RestoreStream(acquisitionID string, chunks []int64, totalBytes int64) (*models.Acquisition, error) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	acquisition, exists := sm.acquisitions[acquisitionID]
+	if !exists {
+		return nil, fmt.Errorf("acquisition %s not found", acquisitionID)
+	}
+	if !acquisition.Status.Ongoing() {
+		return nil, fmt.Errorf("acquisition %s: %w", acquisitionID, ErrAcquisitionNotActive)
+	}
+
+	tracker := NewChunkTracker()
+	for _, index := range chunks {
+		tracker.Add(index)
+	}
+	sm.chunkTrackers[acquisitionID] = tracker
+
+	acquisition.Statistics.TotalChunks = tracker.Count()
+	acquisition.Statistics.TotalBytes = totalBytes
+	sm.recordEvent(acquisition, "restored", fmt.Sprintf("%d chunks, %d bytes stored", tracker.Count(), totalBytes))
+
+	sm.markAcquisitionDirty(acquisitionID)
+	sm.requestFlush()
+	return acquisition, nil
+}
+
+// InterruptAcquisition marks an acquisition that carried on across a restart
+// as interrupted, for when its stream cannot be restored
+func (sm *SessionManager) InterruptAcquisition(acquisitionID string) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	acquisition, exists := sm.acquisitions[acquisitionID]
+	if !exists {
+		return fmt.Errorf("acquisition %s not found", acquisitionID)
+	}
+	if !acquisition.Status.Ongoing() {
+		return fmt.Errorf("acquisition %s: %w", acquisitionID, ErrAcquisitionNotActive)
+	}
+
+	sm.interruptAcquisition(acquisition)
+	sm.requestFlush()
 	return nil
 }
 
+// RecordExport adds an export of the acquisition's data to its history
+func (sm *SessionManager) RecordExport(acquisitionID, format string) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	acquisition, exists := sm.acquisitions[acquisitionID]
+	if !exists {
+		return fmt.Errorf("acquisition %s not found", acquisitionID)
+	}
+
+	sm.recordEvent(acquisition, "exported", format)
+	sm.markAcquisitionDirty(acquisitionID)
+	sm.requestFlush()
+	return nil
+}
+
+// recordEvent appends an event to the history of an acquisition. Must be
+// called with the mutex held.
+func (sm *SessionManager) recordEvent(acquisition *models.Acquisition, event, details string) {
+	acquisition.History = append(acquisition.History, models.AcquisitionEvent{
+		Time:    time.Now(),
+		Event:   event,
+		Details: details,
+	})
+}
+
+// finalizeAcquisition sets the end time and final statistics of an
+// acquisition that has just left the active state. Must be called with the
+// mutex held.
+func (sm *SessionManager) finalizeAcquisition(acquisition *models.Acquisition, now time.Time) {
+	sm.cancelAutoStop(acquisition.ID)
+	sm.removeActiveAcquisition(acquisition)
+	acquisition.EndTime = &now
+
+	// A pause still open ends with the acquisition
+	if n := len(acquisition.Pauses); n > 0 && acquisition.Pauses[n-1].End == nil {
+		acquisition.Pauses[n-1].End = &now
+	}
+
+	// Calculate final statistics
+	duration := int(now.Sub(acquisition.StartTime).Seconds())
+	acquisition.Statistics.Duration = duration
+	acquisition.Statistics.PausedDuration = int(pausedTime(acquisition).Seconds())
+	acquisition.Statistics.AverageDataRate = averageDataRate(acquisition.Statistics)
+
+	// Report chunks that never arrived so an incomplete recording cannot pass
+	// for a complete one
+	if tracker, exists := sm.chunkTrackers[acquisition.ID]; exists {
+		acquisition.Statistics.TotalChunks = tracker.Count()
+		acquisition.Statistics.MissingChunks = tracker.Missing()
+		delete(sm.chunkTrackers, acquisition.ID)
+	}
+	acquisition.Statistics.Complete = len(acquisition.Statistics.MissingChunks) == 0
+
+	sm.addDeviceRecording(acquisition.DeviceID, acquisition.Statistics)
+	sm.touchDevice(acquisition.DeviceID, now)
+}
+
 // Heartbeat and health management
 func (sm *SessionManager) ProcessHeartbeat(sessionID string, clientState models.ClientState) error {
 	sm.mutex.Lock()
@@ -253,6 +753,8 @@ func (sm *SessionManager) ProcessHeartbeat(sessionID string, clientState models.
 	session.DeviceConnected = clientState.DeviceConnected
 	session.LastActivity = time.Now()
 	session.DeviceHealth.LastHealthCheck = time.Now()
+	sm.markSessionDirty(sessionID)
+	sm.touchDevice(session.DeviceID, session.LastActivity)
 
 	// Update statistics if needed
 	// This could be expanded to track more detailed metrics
@@ -267,20 +769,31 @@ func (sm *SessionManager) GetActiveSessions() map[string]*models.Session {
 
 	active := make(map[string]*models.Session)
 	for id, session := range sm.sessions {
-		if session.Status == "active" {
+		if session.Status == models.SessionActive {
 			active[id] = session
 		}
 	}
 	return active
 }
 
+func (sm *SessionManager) GetAcquisitions() map[string]*models.Acquisition {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	acquisitions := make(map[string]*models.Acquisition, len(sm.acquisitions))
+	for id, acquisition := range sm.acquisitions {
+		acquisitions[id] = acquisition
+	}
+	return acquisitions
+}
+
 func (sm *SessionManager) GetActiveAcquisitions() map[string]*models.Acquisition {
 	sm.mutex.RLock()
 	defer sm.mutex.RUnlock()
 
 	active := make(map[string]*models.Acquisition)
 	for id, acquisition := range sm.acquisitions {
-		if acquisition.Status == "active" {
+		if acquisition.Status == models.AcquisitionActive {
 			active[id] = acquisition
 		}
 	}
@@ -295,21 +808,209 @@ func (sm *SessionManager) CleanupExpiredSessions(timeout time.Duration) int {
 	cleaned := 0
 
 	for sessionID, session := range sm.sessions {
-		if session.LastActivity.Before(cleanupTime) && session.Status != "closed" {
-			session.Status = "expired"
+		// Closed and already expired sessions stay as they are
+		if session.LastActivity.Before(cleanupTime) && sm.transitionSession(session, models.SessionExpired, "no activity") == nil {
 			session.DeviceConnected = false
+			sm.markSessionDirty(sessionID)
 			cleaned++
 
 			// Stop any active acquisitions
 			for _, acq := range sm.acquisitions {
-				if acq.SessionID == sessionID && acq.Status == "active" {
-					now := time.Now()
-					acq.Status = "expired"
-					acq.EndTime = &now
+				if acq.SessionID == sessionID && acq.Status.Ongoing() {
+					sm.transitionAcquisition(acq, models.AcquisitionExpired, "session expired")
+					sm.finalizeAcquisition(acq, time.Now())
+					sm.markAcquisitionDirty(acq.ID)
 				}
 			}
 		}
 	}
 
+	if cleaned > 0 {
+		sm.requestFlush()
+	}
 	return cleaned
 }
+
+// Persistence
+
+// markSessionDirty schedules a session to be written on the next flush. Must
+// be called with the mutex held.
+func (sm *SessionManager) markSessionDirty(sessionID string) {
+	sm.dirtySessions[sessionID] = struct{}{}
+}
+
+// markAcquisitionDirty schedules an acquisition to be written on the next
+// flush. Must be called with the mutex held.
+func (sm *SessionManager) markAcquisitionDirty(acquisitionID string) {
+	sm.dirtyAcquisitions[acquisitionID] = struct{}{}
+}
+
+// markDeviceDirty schedules a device to be written on the next flush. Must be
+// called with the mutex held.
+func (sm *SessionManager) markDeviceDirty(deviceID string) {
+	sm.dirtyDevices[deviceID] = struct{}{}
+}
+
+// requestFlush asks the flusher to write pending changes without waiting for
+// the next tick
+func (sm *SessionManager) requestFlush() {
+	select {
+	case sm.flushRequests <- struct{}{}:
+	default:
+	}
+}
+
+func (sm *SessionManager) runFlusher() {
+	defer close(sm.flusherDone)
+
+	ticker := time.NewTicker(persistInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sm.done:
+			return
+		case <-ticker.C:
+		case <-sm.flushRequests:
+		}
+
+		if err := sm.Flush(); err != nil {
+			slog.Error("Failed to persist sessions", "error", err)
+		}
+	}
+}
+
+// Flush writes every session, acquisition and device changed since the last flush to
+// the repository. Records that fail to save stay pending for the next flush.
+func (sm *SessionManager) Flush() error {
+	sm.flushMutex.Lock()
+	defer sm.flushMutex.Unlock()
+
+	// Snapshot under the lock, write without it so ingest is not held up by
+	// disk syncs. A nil snapshot means the record was deleted.
+	sm.mutex.Lock()
+	sessions := make(map[string]*models.Session, len(sm.dirtySessions))
+	for id := range sm.dirtySessions {
+		if session, exists := sm.sessions[id]; exists {
+			sessions[id] = snapshotSession(session)
+		} else {
+			sessions[id] = nil
+		}
+	}
+	acquisitions := make(map[string]*models.Acquisition, len(sm.dirtyAcquisitions))
+	for id := range sm.dirtyAcquisitions {
+		if acquisition, exists := sm.acquisitions[id]; exists {
+			acquisitions[id] = snapshotAcquisition(acquisition)
+		} else {
+			acquisitions[id] = nil
+		}
+	}
+	devices := make([]*models.Device, 0, len(sm.dirtyDevices))
+	for id := range sm.dirtyDevices {
+		if device, exists := sm.devices[id]; exists {
+			snapshot := *device
+			devices = append(devices, &snapshot)
+		}
+	}
+	sm.dirtySessions = make(map[string]struct{})
+	sm.dirtyAcquisitions = make(map[string]struct{})
+	sm.dirtyDevices = make(map[string]struct{})
+	sm.mutex.Unlock()
+
+	var firstErr error
+	var failedSessions, failedAcquisitions, failedDevices []string
+
+	for _, device := range devices {
+		if err := sm.repository.SaveDevice(device); err != nil {
+			failedDevices = append(failedDevices, device.ID)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("persist device %s: %w", device.ID, err)
+			}
+		}
+	}
+
+	for id, session := range sessions {
+		var err error
+		if session == nil {
+			err = sm.repository.DeleteSession(id)
+		} else {
+			err = sm.repository.SaveSession(session)
+		}
+		if err != nil {
+			failedSessions = append(failedSessions, id)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("persist session %s: %w", id, err)
+			}
+		}
+	}
+
+	for id, acquisition := range acquisitions {
+		var err error
+		if acquisition == nil {
+			err = sm.repository.DeleteAcquisition(id)
+		} else {
+			err = sm.repository.SaveAcquisition(acquisition)
+		}
+		if err != nil {
+			failedAcquisitions = append(failedAcquisitions, id)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("persist acquisition %s: %w", id, err)
+			}
+		}
+	}
+
+	if firstErr != nil {
+		sm.mutex.Lock()
+		for _, id := range failedSessions {
+			sm.markSessionDirty(id)
+		}
+		for _, id := range failedAcquisitions {
+			sm.markAcquisitionDirty(id)
+		}
+		for _, id := range failedDevices {
+			sm.markDeviceDirty(id)
+		}
+		sm.mutex.Unlock()
+	}
+
+	return firstErr
+}
+
+// snapshotSession copies a session, slices included, for persisting outside
+// the mutex. Must be called with the mutex held.
+func snapshotSession(session *models.Session) *models.Session {
+	snapshot := *session
+	snapshot.ActiveAcquisitions = slices.Clone(session.ActiveAcquisitions)
+	snapshot.Transitions = slices.Clone(session.Transitions)
+	return &snapshot
+}
+
+// snapshotAcquisition copies an acquisition, slices included, for persisting
+// outside the mutex. Must be called with the mutex held.
+func snapshotAcquisition(acquisition *models.Acquisition) *models.Acquisition {
+	snapshot := *acquisition
+	snapshot.Pauses = slices.Clone(acquisition.Pauses)
+	snapshot.History = slices.Clone(acquisition.History)
+	snapshot.Statistics.MissingChunks = slices.Clone(acquisition.Statistics.MissingChunks)
+	snapshot.Statistics.IntactChunks = slices.Clone(acquisition.Statistics.IntactChunks)
+	return &snapshot
+}
+
+// Close stops background persistence, writes pending changes and closes the
+// repository
+func (sm *SessionManager) Close() error {
+	sm.mutex.Lock()
+	for acquisitionID := range sm.timers {
+		sm.cancelAutoStop(acquisitionID)
+	}
+	sm.mutex.Unlock()
+
+	close(sm.done)
+	<-sm.flusherDone
+
+	err := sm.Flush()
+	if closeErr := sm.repository.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"acquire-app/internal/models"
+)
+
+// ErrInvalidTransition is wrapped by every StateError
+var ErrInvalidTransition = errors.New("invalid state transition")
+
+// StateError reports a state change, or an operation, that the current
+// state of a session or acquisition does not allow
+type StateError struct {
+	// Entity is "session" or "acquisition"
+	Entity string
+	ID     string
+	State  string
+	// Action is what was refused, such as "become closed"
+	Action string
+}
+
+func (e *StateError) Error() string {
+	return fmt.Sprintf("%s %s is %s and cannot %s", e.Entity, e.ID, e.State, e.Action)
+}
+
+func (e *StateError) Unwrap() error {
+	return ErrInvalidTransition
+}
+
+// sessionTransitions lists the states each session state may change to.
+// Closed and expired sessions are final.
+var sessionTransitions = map[models.SessionState][]models.SessionState{
+	models.SessionCreated: {models.SessionActive, models.SessionClosed, models.SessionExpired},
+	models.SessionActive:  {models.SessionClosed, models.SessionExpired},
+}
+
+// acquisitionTransitions lists the states each acquisition state may change
+// to. Only active and paused acquisitions can change state.
+var acquisitionTransitions = map[models.AcquisitionState][]models.AcquisitionState{
+	models.AcquisitionActive: {models.AcquisitionPaused, models.AcquisitionStopped, models.AcquisitionExpired, models.AcquisitionInterrupted},
+	models.AcquisitionPaused: {models.AcquisitionActive, models.AcquisitionStopped, models.AcquisitionExpired, models.AcquisitionInterrupted},
+}
+
+// transitionSession moves a session to a new state and records the
+// transition, or returns a StateError if the transition table does not allow
+// it. Must be called with the mutex held.
+func (sm *SessionManager) transitionSession(session *models.Session, to models.SessionState, reason string) error {
+	if session.Status != "" && !slices.Contains(sessionTransitions[session.Status], to) {
+		return &StateError{Entity: "session", ID: session.ID, State: string(session.Status), Action: "become " + string(to)}
+	}
+
+	session.Transitions = append(session.Transitions, models.StateTransition{
+		From:   string(session.Status),
+		To:     string(to),
+		Time:   time.Now(),
+		Reason: reason,
+	})
+	session.Status = to
+	sm.markSessionDirty(session.ID)
+	return nil
+}
+
+// transitionAcquisition moves an acquisition to a new state and records the
+// transition in its history, or returns a StateError if the transition table
+// does not allow it. Must be called with the mutex held.
+func (sm *SessionManager) transitionAcquisition(acquisition *models.Acquisition, to models.AcquisitionState, details string) error {
+	if acquisition.Status != "" && !slices.Contains(acquisitionTransitions[acquisition.Status], to) {
+		return &StateError{Entity: "acquisition", ID: acquisition.ID, State: string(acquisition.Status), Action: "become " + string(to)}
+	}
+
+	acquisition.History = append(acquisition.History, models.AcquisitionEvent{
+		Time:    time.Now(),
+		Event:   transitionEvent(acquisition.Status, to),
+		Details: details,
+		From:    acquisition.Status,
+		To:      to,
+	})
+	acquisition.Status = to
+	sm.markAcquisitionDirty(acquisition.ID)
+	return nil
+}
+
+// transitionEvent names the history event of an acquisition state change:
+// "started" and "resumed" for becoming active, the new state otherwise
+func transitionEvent(from, to models.AcquisitionState) string {
+	switch {
+	case from == "":
+		return "started"
+	case to == models.AcquisitionActive:
+		return "resumed"
+	}
+	return string(to)
+}
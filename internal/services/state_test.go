@@ -0,0 +1,161 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"acquire-app/internal/models"
+)
+
+func newTestSessionManager(t *testing.T) *SessionManager {
+	t.Helper()
+	sm, err := NewSessionManager(NewMemoryRepository())
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+	t.Cleanup(func() { sm.Close() })
+	return sm
+}
+
+func TestTransitionSession(t *testing.T) {
+	states := []models.SessionState{"", models.SessionCreated, models.SessionActive, models.SessionClosed, models.SessionExpired}
+	allowed := map[[2]models.SessionState]bool{
+		{"", models.SessionCreated}:                    true,
+		{"", models.SessionActive}:                     true,
+		{"", models.SessionClosed}:                     true,
+		{"", models.SessionExpired}:                    true,
+		{models.SessionCreated, models.SessionActive}:  true,
+		{models.SessionCreated, models.SessionClosed}:  true,
+		{models.SessionCreated, models.SessionExpired}: true,
+		{models.SessionActive, models.SessionClosed}:   true,
+		{models.SessionActive, models.SessionExpired}:  true,
+	}
+
+	for _, from := range states {
+		for _, to := range states[1:] {
+			want := allowed[[2]models.SessionState{from, to}]
+			t.Run(string(from)+"->"+string(to), func(t *testing.T) {
+				sm := newTestSessionManager(t)
+				session := &models.Session{ID: "session_1", Status: from}
+
+				sm.mutex.Lock()
+				err := sm.transitionSession(session, to, "test")
+				_, dirty := sm.dirtySessions[session.ID]
+				sm.mutex.Unlock()
+
+				if !want {
+					var stateErr *StateError
+					if !errors.As(err, &stateErr) || !errors.Is(err, ErrInvalidTransition) {
+						t.Fatalf("transitionSession() = %v, want a StateError", err)
+					}
+					if msg := "session session_1 is " + string(from) + " and cannot become " + string(to); err.Error() != msg {
+						t.Errorf("Error() = %q, want %q", err.Error(), msg)
+					}
+					if session.Status != from || len(session.Transitions) != 0 || dirty {
+						t.Errorf("refused transition changed the session: status %s, %d transitions, dirty %v", session.Status, len(session.Transitions), dirty)
+					}
+					return
+				}
+
+				if err != nil {
+					t.Fatalf("transitionSession() = %v, want nil", err)
+				}
+				if session.Status != to || !dirty {
+					t.Errorf("session is %s (dirty %v), want %s and dirty", session.Status, dirty, to)
+				}
+				if len(session.Transitions) != 1 {
+					t.Fatalf("%d transitions recorded, want 1", len(session.Transitions))
+				}
+				transition := session.Transitions[0]
+				if transition.From != string(from) || transition.To != string(to) || transition.Reason != "test" || transition.Time.IsZero() {
+					t.Errorf("recorded %+v, want %s to %s for test", transition, from, to)
+				}
+			})
+		}
+	}
+}
+
+func TestTransitionAcquisition(t *testing.T) {
+	states := []models.AcquisitionState{"", models.AcquisitionActive, models.AcquisitionPaused, models.AcquisitionStopped, models.AcquisitionExpired, models.AcquisitionInterrupted}
+	allowed := map[[2]models.AcquisitionState]bool{
+		{"", models.AcquisitionActive}:                            true,
+		{"", models.AcquisitionPaused}:                            true,
+		{"", models.AcquisitionStopped}:                           true,
+		{"", models.AcquisitionExpired}:                           true,
+		{"", models.AcquisitionInterrupted}:                       true,
+		{models.AcquisitionActive, models.AcquisitionPaused}:      true,
+		{models.AcquisitionActive, models.AcquisitionStopped}:     true,
+		{models.AcquisitionActive, models.AcquisitionExpired}:     true,
+		{models.AcquisitionActive, models.AcquisitionInterrupted}: true,
+		{models.AcquisitionPaused, models.AcquisitionActive}:      true,
+		{models.AcquisitionPaused, models.AcquisitionStopped}:     true,
+		{models.AcquisitionPaused, models.AcquisitionExpired}:     true,
+		{models.AcquisitionPaused, models.AcquisitionInterrupted}: true,
+	}
+
+	for _, from := range states {
+		for _, to := range states[1:] {
+			want := allowed[[2]models.AcquisitionState{from, to}]
+			t.Run(string(from)+"->"+string(to), func(t *testing.T) {
+				sm := newTestSessionManager(t)
+				acquisition := &models.Acquisition{ID: "acq_1", Status: from}
+
+				sm.mutex.Lock()
+				err := sm.transitionAcquisition(acquisition, to, "test")
+				_, dirty := sm.dirtyAcquisitions[acquisition.ID]
+				sm.mutex.Unlock()
+
+				if !want {
+					var stateErr *StateError
+					if !errors.As(err, &stateErr) || !errors.Is(err, ErrInvalidTransition) {
+						t.Fatalf("transitionAcquisition() = %v, want a StateError", err)
+					}
+					if stateErr.Entity != "acquisition" || stateErr.ID != "acq_1" || stateErr.State != string(from) {
+						t.Errorf("StateError = %+v, want acquisition acq_1 in state %s", stateErr, from)
+					}
+					if msg := "acquisition acq_1 is " + string(from) + " and cannot become " + string(to); err.Error() != msg {
+						t.Errorf("Error() = %q, want %q", err.Error(), msg)
+					}
+					if acquisition.Status != from || len(acquisition.History) != 0 || dirty {
+						t.Errorf("refused transition changed the acquisition: status %s, %d events, dirty %v", acquisition.Status, len(acquisition.History), dirty)
+					}
+					return
+				}
+
+				if err != nil {
+					t.Fatalf("transitionAcquisition() = %v, want nil", err)
+				}
+				if acquisition.Status != to || !dirty {
+					t.Errorf("acquisition is %s (dirty %v), want %s and dirty", acquisition.Status, dirty, to)
+				}
+				if len(acquisition.History) != 1 {
+					t.Fatalf("%d events recorded, want 1", len(acquisition.History))
+				}
+				event := acquisition.History[0]
+				if event.From != from || event.To != to || event.Details != "test" || event.Event != transitionEvent(from, to) || event.Time.IsZero() {
+					t.Errorf("recorded %+v, want %s to %s for test", event, from, to)
+				}
+			})
+		}
+	}
+}
+
+func TestTransitionEvent(t *testing.T) {
+	tests := []struct {
+		from, to models.AcquisitionState
+		want     string
+	}{
+		{"", models.AcquisitionActive, "started"},
+		{models.AcquisitionPaused, models.AcquisitionActive, "resumed"},
+		{models.AcquisitionActive, models.AcquisitionPaused, "paused"},
+		{models.AcquisitionActive, models.AcquisitionStopped, "stopped"},
+		{models.AcquisitionPaused, models.AcquisitionExpired, "expired"},
+		{models.AcquisitionActive, models.AcquisitionInterrupted, "interrupted"},
+	}
+
+	for _, tt := range tests {
+		if got := transitionEvent(tt.from, tt.to); got != tt.want {
+			t.Errorf("transitionEvent(%q, %q) = %q, want %q", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
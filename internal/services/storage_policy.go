@@ -0,0 +1,173 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"acquire-app/internal/models"
+)
+
+var ErrStorageQuotaExceeded = errors.New("storage quota exceeded")
+
+// StorageQuota limits the acquisition data kept in primary storage, overall
+// and per device. A zero limit is unlimited.
+type StorageQuota struct {
+	Global    int64
+	PerDevice int64
+}
+
+// Check returns an error wrapping ErrStorageQuotaExceeded if storing size
+// more bytes on top of the given usage would exceed either limit, or fill
+// the storage itself
+func (q StorageQuota) Check(usage StorageUsage, size int64) error {
+	if usage.Capacity > 0 && size > usage.Free {
+		return fmt.Errorf("%w: %d bytes free in storage, %d more expected",
+			ErrStorageQuotaExceeded, usage.Free, size)
+	}
+	if q.Global > 0 && usage.Total+size > q.Global {
+		return fmt.Errorf("%w: %d of %d bytes in use, %d more expected",
+			ErrStorageQuotaExceeded, usage.Total, q.Global, size)
+	}
+	if q.PerDevice > 0 && usage.Device+size > q.PerDevice {
+		return fmt.Errorf("%w: device %s uses %d of %d bytes, %d more expected",
+			ErrStorageQuotaExceeded, usage.DeviceID, usage.Device, q.PerDevice, size)
+	}
+	return nil
+}
+
+// Utilization returns the used fraction of whichever limit is closest to
+// being reached: the quotas and the capacity of the storage. It is 0 if
+// storage is unlimited and its capacity unknown.
+func (q StorageQuota) Utilization(usage StorageUsage) float64 {
+	utilization := 0.0
+	if usage.Capacity > 0 {
+		utilization = 1 - float64(usage.Free)/float64(usage.Capacity)
+	}
+	if q.Global > 0 {
+		if global := float64(usage.Total) / float64(q.Global); global > utilization {
+			utilization = global
+		}
+	}
+	if q.PerDevice > 0 {
+		if device := float64(usage.Device) / float64(q.PerDevice); device > utilization {
+			utilization = device
+		}
+	}
+	return utilization
+}
+
+// StorageUsage is the acquisition data held in primary storage, as measured
+// in the storage backend
+type StorageUsage struct {
+	Total    int64
+	DeviceID string
+	Device   int64
+	// Capacity is the size of the storage, 0 if unknown, and Free the space
+	// left on it
+	Capacity int64
+	Free     int64
+}
+
+// RetentionPolicy decides when finished acquisitions leave primary storage
+type RetentionPolicy struct {
+	// MaxAge is how long after it ended an acquisition is kept; 0 keeps
+	// acquisitions forever
+	MaxAge time.Duration
+}
+
+// Expired reports whether an acquisition is due for deletion or archiving.
+// Ongoing, flagged and already archived acquisitions never are.
+func (p RetentionPolicy) Expired(acquisition *models.Acquisition, now time.Time) bool {
+	if p.MaxAge <= 0 || acquisition.Status.Ongoing() || acquisition.Flagged || acquisition.ArchivedAt != nil {
+		return false
+	}
+	return acquisition.EndTime != nil && now.Sub(*acquisition.EndTime) > p.MaxAge
+}
+
+// DeviceStorage sums the bytes held in primary storage for the acquisitions
+// recorded from deviceID. stored maps acquisition IDs to their measured size.
+func (sm *SessionManager) DeviceStorage(deviceID string, stored map[string]int64) int64 {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	total := int64(0)
+	for acquisitionID, size := range stored {
+		if acquisition, exists := sm.acquisitions[acquisitionID]; exists && sm.acquisitionDevice(acquisition) == deviceID {
+			total += size
+		}
+	}
+	return total
+}
+
+// acquisitionDevice returns the device an acquisition was recorded from.
+// Must be called with the mutex held.
+func (sm *SessionManager) acquisitionDevice(acquisition *models.Acquisition) string {
+	if acquisition.DeviceID != "" {
+		return acquisition.DeviceID
+	}
+	// Recorded before acquisitions kept their device
+	if session, exists := sm.sessions[acquisition.SessionID]; exists {
+		return session.DeviceID
+	}
+	return ""
+}
+
+// SetAcquisitionFlag flags an acquisition to be kept regardless of retention,
+// or clears the flag
+func (sm *SessionManager) SetAcquisitionFlag(acquisitionID string, flagged bool) (*models.Acquisition, error) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	acquisition, exists := sm.acquisitions[acquisitionID]
+	if !exists {
+		return nil, fmt.Errorf("acquisition %s not found", acquisitionID)
+	}
+
+	acquisition.Flagged = flagged
+	if flagged {
+		sm.recordEvent(acquisition, "flagged", "")
+	} else {
+		sm.recordEvent(acquisition, "unflagged", "")
+	}
+	sm.markAcquisitionDirty(acquisitionID)
+	sm.requestFlush()
+	return acquisition, nil
+}
+
+// MarkArchived records that an acquisition's data was moved to the archive
+func (sm *SessionManager) MarkArchived(acquisitionID string) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	acquisition, exists := sm.acquisitions[acquisitionID]
+	if !exists {
+		return fmt.Errorf("acquisition %s not found", acquisitionID)
+	}
+
+	now := time.Now()
+	acquisition.ArchivedAt = &now
+	sm.recordEvent(acquisition, "archived", "")
+	sm.markAcquisitionDirty(acquisitionID)
+	sm.requestFlush()
+	return nil
+}
+
+// RemoveAcquisition forgets a finished acquisition whose data was deleted
+func (sm *SessionManager) RemoveAcquisition(acquisitionID string) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	acquisition, exists := sm.acquisitions[acquisitionID]
+	if !exists {
+		return fmt.Errorf("acquisition %s not found", acquisitionID)
+	}
+	if acquisition.Status.Ongoing() {
+		return fmt.Errorf("acquisition %s is still active", acquisitionID)
+	}
+
+	delete(sm.acquisitions, acquisitionID)
+	sm.markAcquisitionDirty(acquisitionID)
+	sm.requestFlush()
+	return nil
+}
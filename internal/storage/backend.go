@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Backend keeps the finished data of acquisitions. Writers stage segments and
+// the index in the acquisition's local directory and hand each file to the
+// backend once it is sealed; readers fetch everything back through the
+// backend, so downloads work the same whichever backend is configured.
+type Backend interface {
+	// Store takes ownership of the staged file at path and keeps it as name
+	// for the acquisition. The staged file may be moved or removed.
+	Store(acquisitionID, name, path string) error
+
+	// Open opens a stored file for random access. A missing file is reported
+	// with an error wrapping os.ErrNotExist.
+	Open(acquisitionID, name string) (Object, error)
+
+	// Delete removes everything stored for an acquisition
+	Delete(acquisitionID string) error
+
+	// Usage measures what is stored and, if the backend knows it, how much
+	// space is left
+	Usage() (Usage, error)
+}
+
+// Usage is the space taken up in a backend
+type Usage struct {
+	// Acquisitions maps the ID of every acquisition with stored files to
+	// their combined size in bytes
+	Acquisitions map[string]int64
+	// Total is the size of all stored files
+	Total int64
+	// Capacity is the space the backend can hold, 0 if unknown, and Free
+	// what is left of it
+	Capacity int64
+	Free     int64
+}
+
+// Object is a stored file opened for reading
+type Object interface {
+	io.ReaderAt
+	io.Closer
+	Size() int64
+}
+
+// LocalBackend keeps acquisition data on the local filesystem under
+// root/<acquisitionID>. When root is the parent of the acquisitions' staging
+// directories, storing a file is a no-op.
+type LocalBackend struct {
+	root string
+}
+
+func NewLocalBackend(root string) *LocalBackend {
+	return &LocalBackend{root: root}
+}
+
+func (b *LocalBackend) Store(acquisitionID, name, path string) error {
+	target := b.path(acquisitionID, name)
+	if filepath.Clean(path) == target {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("create acquisition directory: %w", err)
+	}
+	if err := os.Rename(path, target); err != nil {
+		return fmt.Errorf("move %s: %w", name, err)
+	}
+	return nil
+}
+
+func (b *LocalBackend) Open(acquisitionID, name string) (Object, error) {
+	return openLocalObject(b.path(acquisitionID, name))
+}
+
+func (b *LocalBackend) Delete(acquisitionID string) error {
+	return os.RemoveAll(filepath.Join(b.root, acquisitionID))
+}
+
+// Usage sums the files under each acquisition directory, staged ones
+// included, and reports the space of the filesystem root is on
+func (b *LocalBackend) Usage() (Usage, error) {
+	usage := Usage{Acquisitions: make(map[string]int64)}
+
+	entries, err := os.ReadDir(b.root)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Usage{}, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		size := int64(0)
+		err := filepath.WalkDir(filepath.Join(b.root, entry.Name()), func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+			return nil
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return Usage{}, err
+		}
+		usage.Acquisitions[entry.Name()] = size
+		usage.Total += size
+	}
+
+	// The root may not exist yet; its filesystem is the one it is created on
+	dir := b.root
+	for {
+		capacity, free, err := diskSpace(dir)
+		if err == nil {
+			usage.Capacity, usage.Free = capacity, free
+			break
+		}
+		parent := filepath.Dir(dir)
+		if !errors.Is(err, os.ErrNotExist) || parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return usage, nil
+}
+
+func (b *LocalBackend) path(acquisitionID, name string) string {
+	return filepath.Join(b.root, acquisitionID, name)
+}
+
+type localObject struct {
+	*os.File
+	size int64
+}
+
+func openLocalObject(path string) (Object, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &localObject{File: file, size: info.Size()}, nil
+}
+
+func (o *localObject) Size() int64 {
+	return o.size
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd
+
+package storage
+
+// diskSpace is not implemented on this platform; filesystem capacity is
+// reported as unknown
+func diskSpace(path string) (int64, int64, error) {
+	return 0, 0, nil
+}
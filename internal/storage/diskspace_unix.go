@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd
+
+package storage
+
+import "syscall"
+
+// diskSpace returns the size of the filesystem holding path and the space
+// available on it to unprivileged users
+func diskSpace(path string) (int64, int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+	return int64(stat.Blocks) * int64(stat.Bsize), int64(stat.Bavail) * int64(stat.Bsize), nil
+}
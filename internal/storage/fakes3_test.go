@@ -0,0 +1,416 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	fakeS3Bucket    = "acquisitions"
+	fakeS3AccessKey = "test-access-key"
+	fakeS3SecretKey = "test-secret-key"
+	fakeS3Region    = "us-east-1"
+)
+
+// fakeS3 is a MinIO-style stand-in for an S3 bucket, serving the subset of
+// the API the S3 backend uses: PUT/HEAD/GET (with Range)/DELETE of objects,
+// multipart uploads and ListObjectsV2. Every request must carry a valid
+// Signature Version 4, which is checked against the request as received.
+type fakeS3 struct {
+	*httptest.Server
+
+	// pageSize limits the keys returned per ListObjectsV2 page, so listing
+	// has to follow continuation tokens
+	pageSize int
+
+	mutex    sync.Mutex
+	objects  map[string][]byte
+	uploads  map[string]map[int][]byte
+	nextID   int
+	requests []fakeS3Request
+}
+
+// fakeS3Request is a request the stand-in served
+type fakeS3Request struct {
+	Method string
+	Key    string
+	Query  url.Values
+	Range  string
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	t.Helper()
+
+	fake := &fakeS3{
+		pageSize: 1000,
+		objects:  make(map[string][]byte),
+		uploads:  make(map[string]map[int][]byte),
+	}
+	fake.Server = httptest.NewServer(http.HandlerFunc(fake.serve))
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+// backend returns an S3 backend pointed at the stand-in
+func (f *fakeS3) backend(t *testing.T, prefix string, partSize int64) *S3Backend {
+	t.Helper()
+
+	backend, err := NewS3Backend(S3Config{
+		Endpoint:        f.URL,
+		Region:          fakeS3Region,
+		Bucket:          fakeS3Bucket,
+		AccessKeyID:     fakeS3AccessKey,
+		SecretAccessKey: fakeS3SecretKey,
+		Prefix:          prefix,
+		PathStyle:       true,
+		PartSize:        partSize,
+	})
+	if err != nil {
+		t.Fatalf("NewS3Backend: %v", err)
+	}
+	return backend
+}
+
+// object returns the stored content of key
+func (f *fakeS3) object(key string) ([]byte, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	data, exists := f.objects[key]
+	return data, exists
+}
+
+// keys returns the stored keys in order
+func (f *fakeS3) keys() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// served returns the requests served so far matching method
+func (f *fakeS3) served(method string) []fakeS3Request {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var matching []fakeS3Request
+	for _, request := range f.requests {
+		if request.Method == method {
+			matching = append(matching, request)
+		}
+	}
+	return matching
+}
+
+func (f *fakeS3) serve(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		fakeS3Error(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	if code, message := verifySignature(r, body); code != "" {
+		fakeS3Error(w, http.StatusForbidden, code, message)
+		return
+	}
+
+	bucketPrefix := "/" + fakeS3Bucket
+	if r.URL.Path != bucketPrefix && !strings.HasPrefix(r.URL.Path, bucketPrefix+"/") {
+		fakeS3Error(w, http.StatusNotFound, "NoSuchBucket", r.URL.Path)
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, bucketPrefix), "/")
+	query := r.URL.Query()
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.requests = append(f.requests, fakeS3Request{Method: r.Method, Key: key, Query: query, Range: r.Header.Get("Range")})
+
+	switch {
+	case key == "" && r.Method == http.MethodGet && query.Get("list-type") == "2":
+		f.list(w, query)
+	case key == "":
+		fakeS3Error(w, http.StatusNotImplemented, "NotImplemented", r.Method+" on bucket")
+
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.nextID++
+		uploadID := fmt.Sprintf("upload-%d", f.nextID)
+		f.uploads[uploadID] = make(map[int][]byte)
+		fakeS3XML(w, http.StatusOK, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string   `xml:"Bucket"`
+			Key      string   `xml:"Key"`
+			UploadID string   `xml:"UploadId"`
+		}{Bucket: fakeS3Bucket, Key: key, UploadID: uploadID})
+
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, exists := f.uploads[query.Get("uploadId")]
+		if !exists {
+			fakeS3Error(w, http.StatusNotFound, "NoSuchUpload", query.Get("uploadId"))
+			return
+		}
+		number, err := strconv.Atoi(query.Get("partNumber"))
+		if err != nil || number < 1 {
+			fakeS3Error(w, http.StatusBadRequest, "InvalidArgument", "partNumber")
+			return
+		}
+		parts[number] = body
+		w.Header().Set("ETag", fakeS3ETag(body))
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		f.complete(w, key, query.Get("uploadId"), body)
+
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+		w.Header().Set("ETag", fakeS3ETag(body))
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodHead, r.Method == http.MethodGet:
+		data, exists := f.objects[key]
+		if !exists {
+			fakeS3Error(w, http.StatusNotFound, "NoSuchKey", key)
+			return
+		}
+		f.get(w, r, data)
+
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		fakeS3Error(w, http.StatusNotImplemented, "NotImplemented", r.Method)
+	}
+}
+
+// get serves an object, or the single byte range requested of it
+func (f *fakeS3) get(w http.ResponseWriter, r *http.Request, data []byte) {
+	status := http.StatusOK
+	if spec := r.Header.Get("Range"); spec != "" {
+		var start, end int
+		if _, err := fmt.Sscanf(spec, "bytes=%d-%d", &start, &end); err != nil || start > end || start >= len(data) {
+			fakeS3Error(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", spec)
+			return
+		}
+		end = min(end, len(data)-1)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		data = data[start : end+1]
+		status = http.StatusPartialContent
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+// complete assembles a multipart upload from the parts listed in body
+func (f *fakeS3) complete(w http.ResponseWriter, key, uploadID string, body []byte) {
+	parts, exists := f.uploads[uploadID]
+	if !exists {
+		fakeS3Error(w, http.StatusNotFound, "NoSuchUpload", uploadID)
+		return
+	}
+
+	var request struct {
+		Parts []struct {
+			PartNumber int    `xml:"PartNumber"`
+			ETag       string `xml:"ETag"`
+		} `xml:"Part"`
+	}
+	if err := xml.Unmarshal(body, &request); err != nil || len(request.Parts) == 0 {
+		fakeS3Error(w, http.StatusBadRequest, "MalformedXML", "no parts listed")
+		return
+	}
+
+	var object []byte
+	for i, part := range request.Parts {
+		data, uploaded := parts[part.PartNumber]
+		if !uploaded || part.ETag != fakeS3ETag(data) {
+			fakeS3Error(w, http.StatusBadRequest, "InvalidPart", strconv.Itoa(part.PartNumber))
+			return
+		}
+		if part.PartNumber != i+1 {
+			fakeS3Error(w, http.StatusBadRequest, "InvalidPartOrder", strconv.Itoa(part.PartNumber))
+			return
+		}
+		if i < len(request.Parts)-1 && int64(len(data)) < minS3PartSize {
+			fakeS3Error(w, http.StatusBadRequest, "EntityTooSmall", strconv.Itoa(part.PartNumber))
+			return
+		}
+		object = append(object, data...)
+	}
+
+	f.objects[key] = object
+	delete(f.uploads, uploadID)
+	fakeS3XML(w, http.StatusOK, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Key     string   `xml:"Key"`
+		ETag    string   `xml:"ETag"`
+	}{Key: key, ETag: fakeS3ETag(object)})
+}
+
+// list answers a ListObjectsV2 request, pageSize keys at a time. The
+// continuation token is the last key of the previous page.
+func (f *fakeS3) list(w http.ResponseWriter, query url.Values) {
+	prefix := query.Get("prefix")
+	after := query.Get("continuation-token")
+
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	type content struct {
+		Key  string `xml:"Key"`
+		Size int    `xml:"Size"`
+	}
+	result := struct {
+		XMLName               xml.Name  `xml:"ListBucketResult"`
+		Contents              []content `xml:"Contents"`
+		IsTruncated           bool      `xml:"IsTruncated"`
+		NextContinuationToken string    `xml:"NextContinuationToken,omitempty"`
+	}{}
+	for _, key := range keys {
+		if len(result.Contents) == f.pageSize {
+			result.IsTruncated = true
+			result.NextContinuationToken = result.Contents[len(result.Contents)-1].Key
+			break
+		}
+		result.Contents = append(result.Contents, content{Key: key, Size: len(f.objects[key])})
+	}
+	fakeS3XML(w, http.StatusOK, result)
+}
+
+// verifySignature checks the Signature Version 4 of a request the way an S3
+// server does, from the request as it arrived. It returns an S3 error code
+// and message if the signature is missing or wrong.
+func verifySignature(r *http.Request, body []byte) (string, string) {
+	sum := sha256.Sum256(body)
+	if payloadHash := hex.EncodeToString(sum[:]); r.Header.Get("X-Amz-Content-Sha256") != payloadHash {
+		return "XAmzContentSHA256Mismatch", "payload hash does not match the body"
+	}
+
+	var credential, signedHeaders, signature string
+	authorization, found := strings.CutPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ")
+	if !found {
+		return "AccessDenied", "missing Signature Version 4 authorization"
+	}
+	for _, field := range strings.Split(authorization, ", ") {
+		name, value, _ := strings.Cut(field, "=")
+		switch name {
+		case "Credential":
+			credential = value
+		case "SignedHeaders":
+			signedHeaders = value
+		case "Signature":
+			signature = value
+		}
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	if len(amzDate) != len("20060102T150405Z") {
+		return "AccessDenied", "missing X-Amz-Date"
+	}
+	scope := amzDate[:8] + "/" + fakeS3Region + "/s3/aws4_request"
+	if credential != fakeS3AccessKey+"/"+scope {
+		return "InvalidAccessKeyId", credential
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, name := range strings.Split(signedHeaders, ";") {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	query := r.URL.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var pairs []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			pairs = append(pairs, awsQueryEscape(name)+"="+awsQueryEscape(value))
+		}
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		strings.Join(pairs, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		r.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + fakeS3SecretKey)
+	for _, part := range []string{amzDate[:8], fakeS3Region, "s3", "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	if !hmac.Equal([]byte(hex.EncodeToString(key)), []byte(signature)) {
+		return "SignatureDoesNotMatch", canonicalRequest
+	}
+	return "", ""
+}
+
+// awsQueryEscape encodes a query component the way Signature Version 4
+// canonicalizes it: spaces as %20 and '~' left alone
+func awsQueryEscape(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(url.QueryEscape(s), "+", "%20"), "%7E", "~")
+}
+
+func fakeS3ETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+func fakeS3XML(w http.ResponseWriter, status int, v interface{}) {
+	var body bytes.Buffer
+	body.WriteString(xml.Header)
+	xml.NewEncoder(&body).Encode(v)
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write(body.Bytes())
+}
+
+func fakeS3Error(w http.ResponseWriter, status int, code, message string) {
+	fakeS3XML(w, status, struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{Code: code, Message: message})
+}
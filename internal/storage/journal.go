@@ -0,0 +1,313 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// The journal makes every chunk durable the moment WriteChunk returns, long
+// before index.json is next rewritten. It lives in the staging directory:
+//
+//	journal.log  one ChunkRecord per line, appended after the chunk's payload was written
+//	pending.dat  payloads of chunks received ahead of a gap, journaled with Segment -1
+//
+// Both are emptied whenever index.json is rewritten while no chunk is held
+// back, and removed once the closed acquisition has been handed to the
+// backend. A journal left behind therefore marks a writer that was not closed
+// cleanly; opening a writer on its directory replays it.
+//
+// A chunk's payload and then its journal record are synced to disk before
+// WriteChunk returns, so an acknowledged chunk survives both the server
+// process dying and a power loss. Replay still keeps only the chunks whose
+// data can be read back with a matching checksum, which drops the torn
+// record of a chunk that was being written when the server stopped.
+const (
+	journalFileName = "journal.log"
+	spillFileName   = "pending.dat"
+
+	// spillSegment is the Segment of journal records that point into the
+	// spill file
+	spillSegment = -1
+)
+
+// openJournal opens the journal for appending, creating it if needed
+func (w *Writer) openJournal() error {
+	file, err := os.OpenFile(filepath.Join(w.dir, journalFileName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open journal: %w", err)
+	}
+	w.journal = file
+	return nil
+}
+
+// journalRecord syncs the file holding a chunk's payload, then appends the
+// chunk's record to the journal in a single write and syncs that too
+func (w *Writer) journalRecord(data *os.File, record ChunkRecord) error {
+	if err := data.Sync(); err != nil {
+		return fmt.Errorf("sync chunk data: %w", err)
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := w.journal.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write journal: %w", err)
+	}
+	if err := w.journal.Sync(); err != nil {
+		return fmt.Errorf("sync journal: %w", err)
+	}
+	return nil
+}
+
+// spillChunk persists a chunk received ahead of a gap to the spill file and
+// journals it
+func (w *Writer) spillChunk(index int64, chunk pendingChunk) error {
+	if w.spill == nil {
+		file, err := os.OpenFile(filepath.Join(w.dir, spillFileName), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("open spill file: %w", err)
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("stat spill file: %w", err)
+		}
+		w.spill = file
+		w.spillSize = info.Size()
+	}
+
+	if _, err := w.spill.Write(chunk.data); err != nil {
+		return fmt.Errorf("write spill file: %w", err)
+	}
+
+	sum := sha256.Sum256(chunk.data)
+	record := ChunkRecord{
+		Index:      index,
+		Channel:    chunk.channel,
+		Segment:    spillSegment,
+		Offset:     w.spillSize,
+		Length:     int64(len(chunk.data)),
+		Checksum:   hex.EncodeToString(sum[:]),
+		CapturedAt: chunk.capturedAt,
+	}
+	w.spillSize += int64(len(chunk.data))
+	return w.journalRecord(w.spill, record)
+}
+
+// resetJournal empties the journal and the spill file once the index covers
+// every journaled chunk
+func (w *Writer) resetJournal() error {
+	if err := w.journal.Truncate(0); err != nil {
+		return fmt.Errorf("truncate journal: %w", err)
+	}
+
+	if w.spill != nil {
+		if err := w.spill.Truncate(0); err != nil {
+			return fmt.Errorf("truncate spill file: %w", err)
+		}
+		w.spillSize = 0
+		return nil
+	}
+	if err := os.Remove(filepath.Join(w.dir, spillFileName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove spill file: %w", err)
+	}
+	return nil
+}
+
+// closeJournal closes the journal and spill file handles, leaving the files
+// in place until the data has been handed to the backend
+func (w *Writer) closeJournal() error {
+	var firstErr error
+	for _, file := range []*os.File{w.journal, w.spill} {
+		if file == nil {
+			continue
+		}
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	w.journal, w.spill = nil, nil
+	return firstErr
+}
+
+// replay applies the journal of a writer that was not closed cleanly on top
+// of the loaded index. Records whose data cannot be read back intact are
+// skipped, chunks that were held back behind a gap are restored to the
+// pending set, and the current segment is cut back to its last intact chunk.
+// It reports whether the journal held anything not yet in the index.
+func (w *Writer) replay() (bool, error) {
+	data, err := os.ReadFile(filepath.Join(w.dir, journalFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read journal: %w", err)
+	}
+
+	stored := make(map[int64]bool, len(w.index.Chunks))
+	for _, chunk := range w.index.Chunks {
+		stored[chunk.Index] = true
+	}
+
+	objects := make(map[int]Object)
+	defer func() {
+		for _, object := range objects {
+			object.Close()
+		}
+	}()
+	open := func(segment int) (Object, error) {
+		if object, ok := objects[segment]; ok {
+			return object, nil
+		}
+		var object Object
+		var err error
+		if segment == spillSegment {
+			object, err = openLocalObject(filepath.Join(w.dir, spillFileName))
+		} else {
+			object, err = w.openSegment(segment)
+		}
+		if err != nil {
+			return nil, err
+		}
+		objects[segment] = object
+		return object, nil
+	}
+
+	replayed := false
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		var record ChunkRecord
+		if len(line) == 0 || json.Unmarshal(line, &record) != nil {
+			// Torn write of the last record
+			continue
+		}
+		if stored[record.Index] {
+			continue
+		}
+
+		object, err := open(record.Segment)
+		if err != nil {
+			continue
+		}
+		payload, ok := readChunk(object, record)
+		if !ok {
+			continue
+		}
+		replayed = true
+
+		if record.Segment == spillSegment {
+			w.pending[record.Index] = pendingChunk{channel: record.Channel, capturedAt: record.CapturedAt, data: payload}
+			continue
+		}
+
+		stored[record.Index] = true
+		delete(w.pending, record.Index)
+		w.index.Chunks = append(w.index.Chunks, record)
+		w.index.TotalBytes += record.Length
+		if record.Segment >= w.index.Segments {
+			w.index.Segments = record.Segment + 1
+		}
+	}
+
+	// Chunks held back behind a gap that was filled before the crash are
+	// already in a segment
+	for index := range w.pending {
+		if stored[index] {
+			delete(w.pending, index)
+		}
+	}
+
+	return replayed, w.truncateSegments()
+}
+
+// truncateSegments cuts the current segment back to the end of its last
+// indexed chunk and removes any later segment that holds no indexed chunk
+func (w *Writer) truncateSegments() error {
+	if w.index.Segments > 0 {
+		current := w.index.Segments - 1
+		end := int64(0)
+		for _, chunk := range w.index.Chunks {
+			if chunk.Segment == current && chunk.Offset+chunk.Length > end {
+				end = chunk.Offset + chunk.Length
+			}
+		}
+
+		info, err := os.Stat(w.segmentPath(current))
+		switch {
+		case err == nil && info.Size() > end:
+			if err := os.Truncate(w.segmentPath(current), end); err != nil {
+				return fmt.Errorf("truncate segment: %w", err)
+			}
+		case err != nil && !errors.Is(err, os.ErrNotExist):
+			return fmt.Errorf("stat segment: %w", err)
+		}
+	}
+
+	for segment := w.index.Segments; ; segment++ {
+		err := os.Remove(w.segmentPath(segment))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("remove partial segment: %w", err)
+		}
+	}
+}
+
+// readChunk reads the payload a journal record points at, reporting whether
+// it matches the record's checksum
+func readChunk(object Object, record ChunkRecord) ([]byte, bool) {
+	if record.Offset < 0 || record.Length < 0 || record.Offset+record.Length > object.Size() {
+		return nil, false
+	}
+
+	data := make([]byte, record.Length)
+	if n, _ := object.ReadAt(data, record.Offset); int64(n) != record.Length {
+		return nil, false
+	}
+
+	sum := sha256.Sum256(data)
+	return data, hex.EncodeToString(sum[:]) == record.Checksum
+}
+
+// storeStaged hands every file of a finalized acquisition that is still in
+// the staging directory to the backend, the index last so that a stored index
+// always refers to stored segments
+func storeStaged(backend Backend, dir string, index *Index) error {
+	for segment := 0; segment < index.Segments; segment++ {
+		name := SegmentName(segment)
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			// Stored when it was sealed
+			continue
+		}
+		if err := backend.Store(index.AcquisitionID, name, path); err != nil {
+			return fmt.Errorf("store %s: %w", name, err)
+		}
+	}
+
+	if err := backend.Store(index.AcquisitionID, IndexFileName, filepath.Join(dir, IndexFileName)); err != nil {
+		return fmt.Errorf("store index: %w", err)
+	}
+	return nil
+}
+
+// removeJournal deletes the journal and spill file of a directory whose data
+// is safely in the backend, then the directory itself if it is now empty
+func removeJournal(dir string) error {
+	for _, name := range []string{journalFileName, spillFileName} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove %s: %w", name, err)
+		}
+	}
+
+	// Only removed if the backend took every file out of the staging area
+	os.Remove(dir)
+	return nil
+}
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// crash abandons a writer as if the server process had died: its files are
+// closed without syncing the index or emptying the journal
+func crash(t *testing.T, w *Writer) {
+	t.Helper()
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.segment != nil {
+		w.segment.Close()
+		w.segment = nil
+	}
+	if err := w.closeJournal(); err != nil {
+		t.Fatalf("close journal: %v", err)
+	}
+	w.closed = true
+}
+
+// appendFile appends data to a file, as a write cut short by the crash
+func appendFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		t.Fatalf("append to %s: %v", path, err)
+	}
+}
+
+func chunkIndices(index Index) []int64 {
+	var indices []int64
+	for _, chunk := range index.Chunks {
+		indices = append(indices, chunk.Index)
+	}
+	return indices
+}
+
+func TestWriterReplay(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "acq_1")
+	chunks := [][]byte{randomBytes(1000), randomBytes(2000), randomBytes(3000), nil, randomBytes(4000)}
+	capturedAt := time.Unix(1700000000, 0).UTC()
+
+	writer, err := OpenWriter("acq_1", dir, NewLocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("OpenWriter: %v", err)
+	}
+	// Chunk 4 is held back behind the missing chunk 3
+	for _, index := range []int64{0, 1, 2, 4} {
+		if err := writer.WriteChunkAt(index, 0, capturedAt.Add(time.Duration(index)*time.Second), chunks[index]); err != nil {
+			t.Fatalf("WriteChunkAt %d: %v", index, err)
+		}
+	}
+	crash(t, writer)
+
+	// The crash tore the write of chunk 3 and its journal record
+	segment := filepath.Join(dir, SegmentName(0))
+	appendFile(t, segment, randomBytes(500))
+	appendFile(t, filepath.Join(dir, journalFileName), []byte(`{"index":3,"channel":0,"segm`))
+	if _, err := os.Stat(filepath.Join(dir, IndexFileName)); err == nil {
+		t.Fatalf("index written before the crash; the test no longer exercises replay")
+	}
+
+	writer, err = OpenWriter("acq_1", dir, NewLocalBackend(t.TempDir()))
+	if err != nil {
+		t.Fatalf("OpenWriter after crash: %v", err)
+	}
+	defer writer.Close()
+
+	if writer.NextIndex() != 3 || writer.Pending() != 1 {
+		t.Errorf("replayed writer continues at %d with %d pending, want 3 with 1", writer.NextIndex(), writer.Pending())
+	}
+	if got := chunkIndices(writer.Index()); len(got) != 3 || got[0] != 0 || got[1] != 1 || got[2] != 2 {
+		t.Errorf("replayed chunks %v, want [0 1 2]", got)
+	}
+
+	stored, err := os.ReadFile(segment)
+	if err != nil {
+		t.Fatalf("read segment: %v", err)
+	}
+	if !bytes.Equal(stored, bytes.Join(chunks[:3], nil)) {
+		t.Errorf("segment is %d bytes after replay, want the %d bytes of chunks 0-2", len(stored), 6000)
+	}
+
+	// Writing carries on where the crash left off
+	if err := writer.WriteChunk(3, 0, randomBytes(100)); err != nil {
+		t.Fatalf("WriteChunk 3 after replay: %v", err)
+	}
+	if writer.NextIndex() != 5 || writer.Pending() != 0 {
+		t.Errorf("after filling the gap the writer continues at %d with %d pending, want 5 with 0", writer.NextIndex(), writer.Pending())
+	}
+	// Capture times survive the journal, also of chunks held back
+	for _, chunk := range writer.Index().Chunks {
+		want := capturedAt.Add(time.Duration(chunk.Index) * time.Second)
+		if chunk.Index == 3 {
+			want = time.Time{}
+		}
+		if !chunk.CapturedAt.Equal(want) {
+			t.Errorf("chunk %d captured at %v, want %v", chunk.Index, chunk.CapturedAt, want)
+		}
+	}
+}
+
+func TestManagerRecover(t *testing.T) {
+	root := t.TempDir()
+	dataPath := filepath.Join(root, "staging", "acq_1")
+	chunks := [][]byte{randomBytes(1000), randomBytes(2000), randomBytes(3000), nil, randomBytes(4000)}
+
+	manager := NewManager(NewLocalBackend(root))
+	writer, err := manager.Open("acq_1", dataPath)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for _, index := range []int64{0, 1, 2, 4} {
+		if err := writer.WriteChunk(index, 0, chunks[index]); err != nil {
+			t.Fatalf("WriteChunk %d: %v", index, err)
+		}
+	}
+	crash(t, writer)
+
+	// Chunk 1 no longer reads back as it was acknowledged
+	segment := filepath.Join(dataPath, SegmentName(0))
+	data, err := os.ReadFile(segment)
+	if err != nil {
+		t.Fatalf("read segment: %v", err)
+	}
+	data[1500] ^= 0xFF
+	if err := os.WriteFile(segment, data, 0o644); err != nil {
+		t.Fatalf("write segment: %v", err)
+	}
+
+	// As after a restart
+	manager = NewManager(NewLocalBackend(root))
+	index, err := manager.Recover("acq_1", dataPath)
+	if err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	if index == nil || !index.Finalized {
+		t.Fatalf("Recover() = %+v, want a finalized index", index)
+	}
+	// The intact chunks, the held back chunk 4 included
+	if got := chunkIndices(*index); len(got) != 3 || got[0] != 0 || got[1] != 2 || got[2] != 4 {
+		t.Errorf("recovered chunks %v, want [0 2 4]", got)
+	}
+
+	reader, stored, err := manager.OpenReader("acq_1")
+	if err != nil {
+		t.Fatalf("OpenReader: %v", err)
+	}
+	defer reader.Close()
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	want := bytes.Join([][]byte{chunks[0], chunks[2], chunks[4]}, nil)
+	if stored.TotalBytes != int64(len(want)) || !bytes.Equal(got, want) {
+		t.Errorf("recovered %d bytes (index says %d), want the %d bytes of chunks 0, 2 and 4", len(got), stored.TotalBytes, len(want))
+	}
+
+	if _, err := os.Stat(filepath.Join(dataPath, journalFileName)); !os.IsNotExist(err) {
+		t.Errorf("journal left behind after recovery: %v", err)
+	}
+	// Nothing left to recover
+	if index, err := manager.Recover("acq_1", dataPath); err != nil || index != nil {
+		t.Errorf("second Recover() = %v, %v; want nil, nil", index, err)
+	}
+}
@@ -0,0 +1,331 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// usageMaxAge is how long a measurement of the backend's usage is reused;
+// measuring walks the whole backend
+const usageMaxAge = 30 * time.Second
+
+// Manager keeps one open Writer per active acquisition and reads finished
+// acquisitions back from the backend
+type Manager struct {
+	backend Backend
+	writers map[string]*Writer
+	mutex   sync.Mutex
+
+	// usage is the last measurement of the backend, nil before the first,
+	// and measured is when the last measurement was started
+	usage      *Usage
+	measured   time.Time
+	usageMutex sync.Mutex
+}
+
+func NewManager(backend Backend) *Manager {
+	return &Manager{
+		backend: backend,
+		writers: make(map[string]*Writer),
+	}
+}
+
+// Open returns the writer for an acquisition, opening it if necessary
+func (m *Manager) Open(acquisitionID, dataPath string) (*Writer, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if writer, exists := m.writers[acquisitionID]; exists {
+		return writer, nil
+	}
+
+	writer, err := OpenWriter(acquisitionID, dataPath, m.backend)
+	if err != nil {
+		return nil, err
+	}
+
+	m.writers[acquisitionID] = writer
+	return writer, nil
+}
+
+// Get returns the open writer for an acquisition
+func (m *Manager) Get(acquisitionID string) (*Writer, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	writer, exists := m.writers[acquisitionID]
+	if !exists {
+		return nil, fmt.Errorf("no open storage writer for acquisition %s", acquisitionID)
+	}
+	return writer, nil
+}
+
+// Close fsyncs and closes the writer for an acquisition. Closing an
+// acquisition without an open writer is a no-op.
+func (m *Manager) Close(acquisitionID string) error {
+	m.mutex.Lock()
+	writer, exists := m.writers[acquisitionID]
+	delete(m.writers, acquisitionID)
+	m.mutex.Unlock()
+
+	if !exists {
+		return nil
+	}
+	return writer.Close()
+}
+
+// Suspend closes the writer for an acquisition without finalizing it, so
+// that Open continues it later. Suspending an acquisition without an open
+// writer is a no-op.
+func (m *Manager) Suspend(acquisitionID string) error {
+	m.mutex.Lock()
+	writer, exists := m.writers[acquisitionID]
+	delete(m.writers, acquisitionID)
+	m.mutex.Unlock()
+
+	if !exists {
+		return nil
+	}
+	return writer.Suspend()
+}
+
+// Recover finishes the staged data of an acquisition whose writer was not
+// closed cleanly, typically because the server stopped while it was being
+// recorded. The journal is replayed, chunks held back behind a gap are written
+// and the result is finalized and handed to the backend. It returns the
+// recovered index, or nil if the acquisition left no journal behind.
+func (m *Manager) Recover(acquisitionID, dataPath string) (*Index, error) {
+	if _, err := os.Stat(filepath.Join(dataPath, journalFileName)); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	// Closed, but stopped before the backend had everything
+	if index, err := ReadIndex(dataPath); err == nil && index.Finalized {
+		if err := storeStaged(m.backend, dataPath, index); err != nil {
+			return nil, err
+		}
+		return index, removeJournal(dataPath)
+	}
+
+	writer, err := OpenWriter(acquisitionID, dataPath, m.backend)
+	if err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	index := writer.Index()
+	return &index, nil
+}
+
+// OpenAcquisitions returns the IDs of all acquisitions with an open writer
+func (m *Manager) OpenAcquisitions() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	ids := make([]string, 0, len(m.writers))
+	for id := range m.writers {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// CloseAll closes every open writer, returning the first error encountered
+func (m *Manager) CloseAll() error {
+	var firstErr error
+	for _, id := range m.OpenAcquisitions() {
+		if err := m.Close(id); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Usage returns the space taken up in the backend. The backend is measured
+// at most every usageMaxAge, also after a failed measurement, and without
+// holding up other calls, which keep to the previous measurement meanwhile.
+// Acquisitions being written count with what their writer holds if that is
+// more, so usage keeps up with ongoing recordings between measurements.
+func (m *Manager) Usage() (Usage, error) {
+	m.usageMutex.Lock()
+	measure := m.usage == nil || time.Since(m.measured) > usageMaxAge
+	if measure {
+		// Claimed before measuring, so that concurrent calls do not walk
+		// the backend as well. A failed measurement is not retried right
+		// away; the previous one stands in until the next attempt.
+		m.measured = time.Now()
+	}
+	claimed := m.measured
+	cached := m.usage
+	m.usageMutex.Unlock()
+
+	var usage Usage
+	if measure {
+		var err error
+		if usage, err = m.backend.Usage(); err != nil {
+			return Usage{}, err
+		}
+		m.usageMutex.Lock()
+		// Unless a later measurement was claimed meanwhile
+		if m.usage == nil || !m.measured.After(claimed) {
+			stored := usage
+			m.usage = &stored
+		}
+		m.usageMutex.Unlock()
+	} else {
+		usage = *cached
+	}
+
+	// Cached measurements are shared and never modified
+	acquisitions := make(map[string]int64, len(usage.Acquisitions))
+	for id, size := range usage.Acquisitions {
+		acquisitions[id] = size
+	}
+	usage.Acquisitions = acquisitions
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for id, writer := range m.writers {
+		grown := writer.Size() - usage.Acquisitions[id]
+		if grown <= 0 {
+			continue
+		}
+		usage.Acquisitions[id] += grown
+		usage.Total += grown
+		if usage.Capacity > 0 {
+			usage.Free = max(usage.Free-grown, 0)
+		}
+	}
+	return usage, nil
+}
+
+// invalidateUsage makes the next Usage call measure the backend again
+func (m *Manager) invalidateUsage() {
+	m.usageMutex.Lock()
+	defer m.usageMutex.Unlock()
+	m.measured = time.Time{}
+}
+
+// OpenReader loads the index of a finished acquisition from the backend and
+// returns a reader over its stored data. Missing data is reported with an
+// error wrapping os.ErrNotExist.
+func (m *Manager) OpenReader(acquisitionID string) (*Reader, *Index, error) {
+	index, err := m.readIndex(acquisitionID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader := NewReader(index, func(segment int) (Object, error) {
+		return m.backend.Open(acquisitionID, SegmentName(segment))
+	})
+	return reader, index, nil
+}
+
+// OpenFile opens one of the stored files of a finished acquisition, as
+// listed by Index.Files
+func (m *Manager) OpenFile(acquisitionID, name string) (Object, error) {
+	return m.backend.Open(acquisitionID, name)
+}
+
+// Delete removes the stored and staged data of a finished acquisition
+func (m *Manager) Delete(acquisitionID, dataPath string) error {
+	defer m.invalidateUsage()
+	if err := m.backend.Delete(acquisitionID); err != nil {
+		return err
+	}
+	return os.RemoveAll(dataPath)
+}
+
+// Archive moves the stored data of a finished acquisition to the archive
+// backend, the index last. Files pass through the acquisition's staging
+// directory, so with the local backend they are simply moved. An archive
+// that was interrupted can be run again.
+func (m *Manager) Archive(acquisitionID, dataPath string, archive Backend) error {
+	index, err := m.readIndex(acquisitionID)
+	if errors.Is(err, os.ErrNotExist) && archived(archive, acquisitionID, IndexFileName) {
+		// Everything was archived before the primary copy was deleted
+		return m.Delete(acquisitionID, dataPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dataPath, 0o755); err != nil {
+		return fmt.Errorf("create acquisition directory: %w", err)
+	}
+
+	for _, name := range index.Files() {
+		path := filepath.Join(dataPath, name)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			err := m.fetch(acquisitionID, name, path)
+			if errors.Is(err, os.ErrNotExist) && archived(archive, acquisitionID, name) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := archive.Store(acquisitionID, name, path); err != nil {
+			return fmt.Errorf("archive %s: %w", name, err)
+		}
+	}
+
+	return m.Delete(acquisitionID, dataPath)
+}
+
+// fetch copies a stored file of an acquisition to path
+func (m *Manager) fetch(acquisitionID, name, path string) error {
+	object, err := m.backend.Open(acquisitionID, name)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", name, err)
+	}
+	if _, err := io.Copy(file, io.NewSectionReader(object, 0, object.Size())); err != nil {
+		file.Close()
+		os.Remove(path)
+		return fmt.Errorf("fetch %s: %w", name, err)
+	}
+	return file.Close()
+}
+
+// archived reports whether a file has already made it to the archive
+func archived(archive Backend, acquisitionID, name string) bool {
+	object, err := archive.Open(acquisitionID, name)
+	if err != nil {
+		return false
+	}
+	object.Close()
+	return true
+}
+
+// readIndex loads the index of an acquisition from the backend
+func (m *Manager) readIndex(acquisitionID string) (*Index, error) {
+	object, err := m.backend.Open(acquisitionID, IndexFileName)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(io.NewSectionReader(object, 0, object.Size()))
+	if err != nil {
+		return nil, fmt.Errorf("read index: %w", err)
+	}
+
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("parse index: %w", err)
+	}
+	return &index, nil
+}
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestManagerUsage(t *testing.T) {
+	root := t.TempDir()
+	manager := NewManager(NewLocalBackend(root))
+
+	writer, err := manager.Open("acq_1", filepath.Join(root, "acq_1"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := writer.WriteChunk(0, 0, randomBytes(1000)); err != nil {
+		t.Fatalf("WriteChunk: %v", err)
+	}
+
+	usage, err := manager.Usage()
+	if err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+	if usage.Capacity <= 0 || usage.Free <= 0 || usage.Free > usage.Capacity {
+		t.Errorf("Usage() capacity %d free %d, want the filesystem's", usage.Capacity, usage.Free)
+	}
+	// The directory holds the journal and index besides the chunk
+	if usage.Acquisitions["acq_1"] < 1000 || usage.Total != usage.Acquisitions["acq_1"] {
+		t.Errorf("Usage() = %+v, want at least the 1000 bytes written to acq_1", usage)
+	}
+
+	// Chunks written after the measurement count right away
+	before := usage.Acquisitions["acq_1"]
+	if err := writer.WriteChunk(1, 0, randomBytes(5000)); err != nil {
+		t.Fatalf("WriteChunk: %v", err)
+	}
+	// Held behind the gap at chunk 2
+	if err := writer.WriteChunk(3, 0, randomBytes(5000)); err != nil {
+		t.Fatalf("WriteChunk: %v", err)
+	}
+	usage, err = manager.Usage()
+	if err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+	if got := usage.Acquisitions["acq_1"]; got < 11000 || got < before {
+		t.Errorf("usage of acq_1 after writing 11000 bytes = %d", got)
+	}
+
+	if err := manager.Close("acq_1"); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := manager.Delete("acq_1", filepath.Join(root, "acq_1")); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	usage, err = manager.Usage()
+	if err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+	if usage.Total != 0 || len(usage.Acquisitions) != 0 {
+		t.Errorf("Usage() after Delete = %+v, want nothing stored", usage)
+	}
+}
+
+// slowUsageBackend holds every measurement until release is closed
+type slowUsageBackend struct {
+	*LocalBackend
+	measuring chan struct{}
+	release   chan struct{}
+	calls     atomic.Int32
+}
+
+func (b *slowUsageBackend) Usage() (Usage, error) {
+	if b.calls.Add(1) > 1 {
+		b.measuring <- struct{}{}
+		<-b.release
+	}
+	return b.LocalBackend.Usage()
+}
+
+func TestManagerUsageMeasuring(t *testing.T) {
+	backend := &slowUsageBackend{
+		LocalBackend: NewLocalBackend(t.TempDir()),
+		measuring:    make(chan struct{}),
+		release:      make(chan struct{}),
+	}
+	manager := NewManager(backend)
+	first, err := manager.Usage()
+	if err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+
+	manager.invalidateUsage()
+	measured := make(chan error)
+	go func() {
+		_, err := manager.Usage()
+		measured <- err
+	}()
+	<-backend.measuring
+
+	// A call during the measurement neither waits for it nor measures again
+	done := make(chan Usage)
+	go func() {
+		usage, _ := manager.Usage()
+		done <- usage
+	}()
+	select {
+	case usage := <-done:
+		if usage.Capacity != first.Capacity {
+			t.Errorf("Usage() during a measurement = %+v, want the previous %+v", usage, first)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Usage() waits for the measurement running in another call")
+	}
+	if calls := backend.calls.Load(); calls != 2 {
+		t.Errorf("backend measured %d times, want 2", calls)
+	}
+
+	close(backend.release)
+	if err := <-measured; err != nil {
+		t.Errorf("Usage: %v", err)
+	}
+}
+
+func TestManagerSuspend(t *testing.T) {
+	root := t.TempDir()
+	dataPath := filepath.Join(root, "staging", "acq_1")
+	chunks := [][]byte{randomBytes(1000), randomBytes(2000), randomBytes(3000)}
+
+	manager := NewManager(NewLocalBackend(root))
+	writer, err := manager.Open("acq_1", dataPath)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	// Chunk 2 is held back behind the missing chunk 1
+	for _, index := range []int64{0, 2} {
+		if err := writer.WriteChunk(index, 0, chunks[index]); err != nil {
+			t.Fatalf("WriteChunk %d: %v", index, err)
+		}
+	}
+	if err := manager.Suspend("acq_1"); err != nil {
+		t.Fatalf("Suspend: %v", err)
+	}
+	if err := writer.WriteChunk(1, 0, chunks[1]); err != ErrWriterClosed {
+		t.Errorf("WriteChunk after Suspend: got %v, want ErrWriterClosed", err)
+	}
+
+	// As after a restart: a new manager continues the acquisition
+	manager = NewManager(NewLocalBackend(root))
+	writer, err = manager.Open("acq_1", dataPath)
+	if err != nil {
+		t.Fatalf("Open after Suspend: %v", err)
+	}
+	if writer.NextIndex() != 1 || writer.Pending() != 1 {
+		t.Fatalf("reopened writer continues at %d with %d pending, want 1 with 1", writer.NextIndex(), writer.Pending())
+	}
+	if err := writer.WriteChunk(1, 0, chunks[1]); err != nil {
+		t.Fatalf("WriteChunk: %v", err)
+	}
+	if err := manager.Close("acq_1"); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reader, index, err := manager.OpenReader("acq_1")
+	if err != nil {
+		t.Fatalf("OpenReader: %v", err)
+	}
+	defer reader.Close()
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if len(index.Chunks) != len(chunks) || !bytes.Equal(got, bytes.Join(chunks, nil)) {
+		t.Errorf("stored %d chunks, %d bytes; want the %d chunks written across the suspension", len(index.Chunks), len(got), len(chunks))
+	}
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// SegmentOpener opens segment number n of an acquisition
+type SegmentOpener func(segment int) (Object, error)
+
+// Reader presents the stored chunks of an acquisition as one contiguous,
+// seekable stream in chunk order
+type Reader struct {
+	open   SegmentOpener
+	chunks []ChunkRecord
+	starts []int64
+	size   int64
+	pos    int64
+	files  map[int]Object
+}
+
+// NewReader creates a reader over the chunks listed in index, fetching
+// segments with open
+func NewReader(index *Index, open SegmentOpener) *Reader {
+	r := &Reader{
+		open:   open,
+		chunks: index.Chunks,
+		starts: make([]int64, len(index.Chunks)),
+		files:  make(map[int]Object),
+	}
+
+	for i, chunk := range index.Chunks {
+		r.starts[i] = r.size
+		r.size += chunk.Length
+	}
+
+	return r
+}
+
+// Size returns the total number of bytes in the stream
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+
+	// Locate the chunk containing the current position
+	i := sort.Search(len(r.starts), func(i int) bool { return r.starts[i] > r.pos }) - 1
+	chunk := r.chunks[i]
+	within := r.pos - r.starts[i]
+
+	if remaining := chunk.Length - within; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	file, err := r.segment(chunk.Segment)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := file.ReadAt(p, chunk.Offset+within)
+	r.pos += int64(n)
+	if errors.Is(err, io.EOF) && n == len(p) {
+		err = nil
+	} else if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("storage: invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("storage: negative position")
+	}
+	r.pos = offset
+	return offset, nil
+}
+
+// Close closes every segment opened by the reader
+func (r *Reader) Close() error {
+	var firstErr error
+	for segment, file := range r.files {
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(r.files, segment)
+	}
+	return firstErr
+}
+
+func (r *Reader) segment(segment int) (Object, error) {
+	if file, ok := r.files[segment]; ok {
+		return file, nil
+	}
+
+	file, err := r.open(segment)
+	if err != nil {
+		return nil, fmt.Errorf("open segment: %w", err)
+	}
+	r.files[segment] = file
+	return file, nil
+}
@@ -0,0 +1,523 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultS3PartSize is the multipart upload part size used when none is
+	// configured; a 64MB segment is uploaded in four parts
+	DefaultS3PartSize int64 = 16 << 20
+
+	// minS3PartSize is the smallest part S3 accepts, except for the last one
+	minS3PartSize int64 = 5 << 20
+
+	// s3ReadAhead is how much an object read fetches at once, so sequential
+	// reads of small chunks do not turn into one request each
+	s3ReadAhead = 4 << 20
+
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// S3Config configures an S3-compatible backend
+type S3Config struct {
+	// Endpoint is the service URL, e.g. https://s3.eu-west-1.amazonaws.com
+	// or http://localhost:9000 for a MinIO-style server
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// Prefix is prepended to every object key
+	Prefix string
+
+	// PathStyle addresses the bucket as endpoint/bucket instead of
+	// bucket.endpoint, as most self-hosted servers expect
+	PathStyle bool
+
+	// PartSize is the multipart upload part size, DefaultS3PartSize if zero
+	PartSize int64
+
+	// Capacity is the space the bucket may fill, used to report storage
+	// utilization; 0 if unknown
+	Capacity int64
+}
+
+// S3Backend stores acquisition data in an S3-compatible object store under
+// <prefix>/<acquisitionID>/<name>. Files larger than one part, i.e. segments,
+// are sent with a multipart upload. Requests are signed with AWS Signature
+// Version 4.
+type S3Backend struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+func NewS3Backend(config S3Config) (*S3Backend, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("s3: bucket is required")
+	}
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, errors.New("s3: access key and secret key are required")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.PartSize == 0 {
+		config.PartSize = DefaultS3PartSize
+	}
+	if config.PartSize < minS3PartSize {
+		return nil, fmt.Errorf("s3: part size must be at least %d bytes", minS3PartSize)
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("s3: invalid endpoint %q", config.Endpoint)
+	}
+
+	return &S3Backend{
+		config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+func (b *S3Backend) Store(acquisitionID, name, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	key := b.key(acquisitionID, name)
+	if info.Size() <= b.config.PartSize {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return err
+		}
+		if err := b.putObject(key, data); err != nil {
+			return err
+		}
+	} else if err := b.multipartUpload(key, file); err != nil {
+		return err
+	}
+
+	file.Close()
+	return os.Remove(filePath)
+}
+
+func (b *S3Backend) Open(acquisitionID, name string) (Object, error) {
+	key := b.key(acquisitionID, name)
+
+	resp, err := b.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	return &s3Object{backend: b, key: key, size: resp.ContentLength}, nil
+}
+
+func (b *S3Backend) Delete(acquisitionID string) error {
+	return b.list(b.key(acquisitionID, "")+"/", func(key string, size int64) error {
+		resp, err := b.do(http.MethodDelete, key, nil, nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	})
+}
+
+// Usage lists every object under the prefix. The space left is only known
+// if a Capacity was configured, since S3 has no notion of a full bucket.
+func (b *S3Backend) Usage() (Usage, error) {
+	usage := Usage{Acquisitions: make(map[string]int64)}
+
+	prefix := ""
+	if b.config.Prefix != "" {
+		prefix = path.Clean(b.config.Prefix) + "/"
+	}
+	err := b.list(prefix, func(key string, size int64) error {
+		acquisitionID, _, found := strings.Cut(strings.TrimPrefix(key, prefix), "/")
+		if found {
+			usage.Acquisitions[acquisitionID] += size
+		}
+		usage.Total += size
+		return nil
+	})
+	if err != nil {
+		return Usage{}, err
+	}
+
+	if b.config.Capacity > 0 {
+		usage.Capacity = b.config.Capacity
+		usage.Free = max(b.config.Capacity-usage.Total, 0)
+	}
+	return usage, nil
+}
+
+// list calls fn for every object whose key starts with prefix, following
+// ListObjectsV2 continuation tokens
+func (b *S3Backend) list(prefix string, fn func(key string, size int64) error) error {
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		resp, err := b.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return err
+		}
+
+		var result struct {
+			Contents []struct {
+				Key  string `xml:"Key"`
+				Size int64  `xml:"Size"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = decodeXML(resp, &result)
+		if err != nil {
+			return err
+		}
+
+		for _, object := range result.Contents {
+			if err := fn(object.Key, object.Size); err != nil {
+				return err
+			}
+		}
+
+		if !result.IsTruncated {
+			return nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+func (b *S3Backend) key(acquisitionID, name string) string {
+	return path.Join(b.config.Prefix, acquisitionID, name)
+}
+
+func (b *S3Backend) putObject(key string, data []byte) error {
+	resp, err := b.do(http.MethodPut, key, nil, data, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// multipartUpload uploads file to key in PartSize parts, aborting the upload
+// if any part fails so no orphaned parts are left behind
+func (b *S3Backend) multipartUpload(key string, file io.Reader) error {
+	resp, err := b.do(http.MethodPost, key, url.Values{"uploads": {""}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := decodeXML(resp, &initiated); err != nil {
+		return err
+	}
+
+	type completedPart struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	var parts []completedPart
+
+	buffer := make([]byte, b.config.PartSize)
+	for number := 1; ; number++ {
+		n, readErr := io.ReadFull(file, buffer)
+		if n == 0 && readErr != nil {
+			if errors.Is(readErr, io.EOF) {
+				break
+			}
+			b.abortUpload(key, initiated.UploadID)
+			return readErr
+		}
+
+		query := url.Values{
+			"partNumber": {strconv.Itoa(number)},
+			"uploadId":   {initiated.UploadID},
+		}
+		resp, err := b.do(http.MethodPut, key, query, buffer[:n], nil)
+		if err != nil {
+			b.abortUpload(key, initiated.UploadID)
+			return err
+		}
+		resp.Body.Close()
+		parts = append(parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+
+		if readErr != nil {
+			break
+		}
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		b.abortUpload(key, initiated.UploadID)
+		return err
+	}
+
+	resp, err = b.do(http.MethodPost, key, url.Values{"uploadId": {initiated.UploadID}}, body, nil)
+	if err != nil {
+		b.abortUpload(key, initiated.UploadID)
+		return err
+	}
+
+	// CompleteMultipartUpload can fail after sending 200 OK
+	var completed struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if err := decodeXML(resp, &completed); err != nil {
+		return err
+	}
+	if completed.XMLName.Local == "Error" {
+		b.abortUpload(key, initiated.UploadID)
+		return fmt.Errorf("s3: complete upload of %s: %s: %s", key, completed.Code, completed.Message)
+	}
+	return nil
+}
+
+func (b *S3Backend) abortUpload(key, uploadID string) {
+	resp, err := b.do(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+	if err == nil {
+		resp.Body.Close()
+	}
+}
+
+// do sends a signed request and returns the response if it succeeded
+func (b *S3Backend) do(method, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	target := *b.endpoint
+	objectPath := "/" + key
+	if b.config.PathStyle {
+		objectPath = "/" + b.config.Bucket + objectPath
+	} else {
+		target.Host = b.config.Bucket + "." + target.Host
+	}
+	target.Path = objectPath
+	target.RawPath = uriEncode(objectPath, false)
+	target.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.ContentLength = int64(len(body))
+
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+	b.sign(req, target.RawPath, payloadHash, time.Now())
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %s %s: %w", method, key, err)
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("s3: %s %s: %w", method, key, os.ErrNotExist)
+		}
+
+		var apiErr struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&apiErr)
+		return nil, fmt.Errorf("s3: %s %s: %s: %s %s", method, key, resp.Status, apiErr.Code, apiErr.Message)
+	}
+
+	return resp, nil
+}
+
+// sign adds AWS Signature Version 4 headers to req
+func (b *S3Backend) sign(req *http.Request, canonicalURI, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + b.config.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+b.config.SecretAccessKey), date)
+	key = hmacSHA256(key, b.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		b.config.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes query parameters sorted by name, as both the request
+// and its signature need them
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var pairs []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			pairs = append(pairs, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything except unreserved characters and,
+// unless encodeSlash is set, '/'
+func uriEncode(s string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			encoded.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			encoded.WriteByte(c)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return encoded.String()
+}
+
+func decodeXML(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	if err := xml.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("s3: decode response: %w", err)
+	}
+	return nil
+}
+
+// s3Object reads a stored object with ranged GETs, keeping the last block
+// fetched so sequential reads are served from memory
+type s3Object struct {
+	backend *S3Backend
+	key     string
+	size    int64
+
+	block      []byte
+	blockStart int64
+	mutex      sync.Mutex
+}
+
+func (o *s3Object) Size() int64 {
+	return o.size
+}
+
+func (o *s3Object) ReadAt(p []byte, off int64) (int, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= o.size {
+			return n, io.EOF
+		}
+
+		if pos < o.blockStart || pos >= o.blockStart+int64(len(o.block)) {
+			if err := o.fetch(pos, int64(len(p)-n)); err != nil {
+				return n, err
+			}
+		}
+		n += copy(p[n:], o.block[pos-o.blockStart:])
+	}
+	return n, nil
+}
+
+func (o *s3Object) fetch(start, length int64) error {
+	if length < s3ReadAhead {
+		length = s3ReadAhead
+	}
+	if start+length > o.size {
+		length = o.size - start
+	}
+
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", start, start+length-1)}}
+	resp, err := o.backend.do(http.MethodGet, o.key, nil, nil, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	block, err := io.ReadAll(io.LimitReader(resp.Body, length))
+	if err != nil {
+		return fmt.Errorf("s3: read %s: %w", o.key, err)
+	}
+	if int64(len(block)) != length {
+		return fmt.Errorf("s3: read %s: %w", o.key, io.ErrUnexpectedEOF)
+	}
+
+	o.block = block
+	o.blockStart = start
+	return nil
+}
+
+func (o *s3Object) Close() error {
+	o.block = nil
+	return nil
+}
@@ -0,0 +1,284 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stage writes data to a staged file the way the writer leaves sealed files
+func stage(t *testing.T, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "staged")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func randomBytes(n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(data)
+	return data
+}
+
+func TestS3BackendStoreSmallFile(t *testing.T) {
+	fake := newFakeS3(t)
+	backend := fake.backend(t, "acquisitions", 0)
+
+	data := []byte("small index")
+	path := stage(t, data)
+	if err := backend.Store("acq_1", IndexFileName, path); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+
+	stored, exists := fake.object("acquisitions/acq_1/index.json")
+	if !exists || !bytes.Equal(stored, data) {
+		t.Fatalf("stored object = %q, %v; want %q", stored, exists, data)
+	}
+	if uploads := fake.served("POST"); len(uploads) != 0 {
+		t.Errorf("small file used a multipart upload: %v", uploads)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("staged file still exists after Store: %v", err)
+	}
+}
+
+func TestS3BackendStoreMultipart(t *testing.T) {
+	fake := newFakeS3(t)
+	backend := fake.backend(t, "acquisitions", minS3PartSize)
+
+	// Two full parts and a short last one
+	data := randomBytes(int(2*minS3PartSize) + 12345)
+	if err := backend.Store("acq_1", SegmentName(0), stage(t, data)); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+
+	stored, exists := fake.object("acquisitions/acq_1/" + SegmentName(0))
+	if !exists || !bytes.Equal(stored, data) {
+		t.Fatalf("stored object has %d bytes, want the %d uploaded", len(stored), len(data))
+	}
+
+	var parts []string
+	for _, request := range fake.served("PUT") {
+		if request.Query.Has("uploadId") {
+			parts = append(parts, request.Query.Get("partNumber"))
+		}
+	}
+	if strings.Join(parts, ",") != "1,2,3" {
+		t.Errorf("uploaded parts %v, want 1,2,3", parts)
+	}
+}
+
+func TestS3BackendRejectedSignature(t *testing.T) {
+	fake := newFakeS3(t)
+	backend := fake.backend(t, "acquisitions", 0)
+	backend.config.SecretAccessKey = "wrong-secret"
+
+	err := backend.Store("acq_1", IndexFileName, stage(t, []byte("{}")))
+	if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Fatalf("Store with a wrong secret: got %v, want SignatureDoesNotMatch", err)
+	}
+}
+
+func TestS3ObjectReadAtUsesRange(t *testing.T) {
+	fake := newFakeS3(t)
+	backend := fake.backend(t, "", 0)
+
+	data := randomBytes(s3ReadAhead + 1000)
+	if err := backend.Store("acq_1", SegmentName(0), stage(t, data)); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+
+	object, err := backend.Open("acq_1", SegmentName(0))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer object.Close()
+
+	if object.Size() != int64(len(data)) {
+		t.Fatalf("Size() = %d, want %d", object.Size(), len(data))
+	}
+
+	tests := []struct {
+		name   string
+		offset int64
+		length int
+		want   string
+	}{
+		{"first block", 0, 100, "bytes=0-4194303"},
+		{"served from the block", 200, 100, ""},
+		{"tail", s3ReadAhead + 500, 400, "bytes=4194804-4195303"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(fake.served("GET"))
+
+			p := make([]byte, tt.length)
+			n, err := object.ReadAt(p, tt.offset)
+			if err != nil || n != tt.length {
+				t.Fatalf("ReadAt = %d, %v", n, err)
+			}
+			if !bytes.Equal(p, data[tt.offset:tt.offset+int64(tt.length)]) {
+				t.Fatal("ReadAt returned the wrong bytes")
+			}
+
+			gets := fake.served("GET")[before:]
+			switch {
+			case tt.want == "" && len(gets) != 0:
+				t.Errorf("read fetched %v, want no request", gets)
+			case tt.want != "" && (len(gets) != 1 || gets[0].Range != tt.want):
+				t.Errorf("read fetched %v, want one GET with Range %s", gets, tt.want)
+			}
+		})
+	}
+
+	p := make([]byte, 10)
+	if n, err := object.ReadAt(p, int64(len(data))-4); n != 4 || err != io.EOF {
+		t.Errorf("ReadAt across the end = %d, %v; want 4, EOF", n, err)
+	}
+}
+
+func TestS3BackendOpenMissing(t *testing.T) {
+	fake := newFakeS3(t)
+	backend := fake.backend(t, "acquisitions", 0)
+
+	if _, err := backend.Open("acq_1", IndexFileName); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Open of a missing object: got %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestS3BackendDelete(t *testing.T) {
+	fake := newFakeS3(t)
+	fake.pageSize = 2
+	backend := fake.backend(t, "acquisitions", 0)
+
+	for _, name := range []string{SegmentName(0), SegmentName(1), SegmentName(2), IndexFileName} {
+		if err := backend.Store("acq_1", name, stage(t, []byte(name))); err != nil {
+			t.Fatalf("Store %s: %v", name, err)
+		}
+	}
+	// Shares the prefix "acq_1" but is another acquisition
+	if err := backend.Store("acq_10", IndexFileName, stage(t, []byte("other"))); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+
+	if err := backend.Delete("acq_1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	if keys := fake.keys(); len(keys) != 1 || keys[0] != "acquisitions/acq_10/index.json" {
+		t.Errorf("objects left after Delete: %v", keys)
+	}
+	if lists := fake.served("GET"); len(lists) < 2 {
+		t.Errorf("Delete listed %d pages, want it to follow the continuation token", len(lists))
+	}
+}
+
+func TestManagerS3RoundTrip(t *testing.T) {
+	fake := newFakeS3(t)
+	manager := NewManager(fake.backend(t, "acquisitions", 0))
+	dataPath := filepath.Join(t.TempDir(), "acq_1")
+
+	writer, err := manager.Open("acq_1", dataPath)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	chunks := [][]byte{
+		randomBytes(1000),
+		randomBytes(2000),
+		randomBytes(3000),
+		randomBytes(4000),
+	}
+	// Out of order: chunk 2 waits for chunk 1
+	for _, index := range []int64{0, 2, 1, 3} {
+		if err := writer.WriteChunk(index, 0, chunks[index]); err != nil {
+			t.Fatalf("WriteChunk %d: %v", index, err)
+		}
+	}
+	if err := manager.Close("acq_1"); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if keys := fake.keys(); strings.Join(keys, ",") != "acquisitions/acq_1/index.json,acquisitions/acq_1/segment-000000.dat" {
+		t.Fatalf("stored objects %v", keys)
+	}
+	if staged, _ := filepath.Glob(filepath.Join(dataPath, "*")); len(staged) != 0 {
+		t.Errorf("staged files left behind: %v", staged)
+	}
+
+	reader, index, err := manager.OpenReader("acq_1")
+	if err != nil {
+		t.Fatalf("OpenReader: %v", err)
+	}
+	defer reader.Close()
+
+	want := bytes.Join(chunks, nil)
+	if !index.Finalized || index.TotalBytes != int64(len(want)) || len(index.Chunks) != len(chunks) {
+		t.Fatalf("index = %+v", index)
+	}
+
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("downloaded data differs from the chunks written")
+	}
+
+	// A ranged download seeks into the middle of a chunk
+	if _, err := reader.Seek(2500, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	part := make([]byte, 1000)
+	if _, err := io.ReadFull(reader, part); err != nil {
+		t.Fatalf("ReadFull: %v", err)
+	}
+	if !bytes.Equal(part, want[2500:3500]) {
+		t.Error("ranged read returned the wrong bytes")
+	}
+
+	if err := manager.Delete("acq_1", dataPath); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, _, err := manager.OpenReader("acq_1"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("OpenReader after Delete: got %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestS3BackendUsage(t *testing.T) {
+	fake := newFakeS3(t)
+	fake.pageSize = 2
+	backend := fake.backend(t, "acquisitions", 0)
+	backend.config.Capacity = 1000
+
+	stored := map[string][]string{
+		"acq_1": {SegmentName(0), IndexFileName},
+		"acq_2": {IndexFileName},
+	}
+	for acquisitionID, names := range stored {
+		for _, name := range names {
+			if err := backend.Store(acquisitionID, name, stage(t, randomBytes(100))); err != nil {
+				t.Fatalf("Store: %v", err)
+			}
+		}
+	}
+
+	usage, err := backend.Usage()
+	if err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+	if usage.Total != 300 || usage.Acquisitions["acq_1"] != 200 || usage.Acquisitions["acq_2"] != 100 {
+		t.Errorf("Usage() = %+v, want 300 bytes: acq_1 200, acq_2 100", usage)
+	}
+	if usage.Capacity != 1000 || usage.Free != 700 {
+		t.Errorf("Usage() capacity %d free %d, want 1000 and 700", usage.Capacity, usage.Free)
+	}
+}
@@ -0,0 +1,570 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Layout of an acquisition directory (Acquisition.DataPath), which is also
+// the layout of an acquisition in every Backend:
+//
+//	segment-000000.dat  decoded chunk payloads appended in chunk order
+//	segment-000001.dat  a new segment is started once the current one reaches SegmentSize
+//	index.json          chunk index -> segment/offset/length/checksum, rewritten atomically on sync
+//
+// The directory is the writer's staging area. Each segment is handed to the
+// backend once it is sealed, and the index once the writer is closed. While
+// the writer is open the directory also holds its journal (see journal.go).
+const (
+	// IndexFileName is the name of the index among an acquisition's files
+	IndexFileName     = "index.json"
+	segmentFileFormat = "segment-%06d.dat"
+
+	// SegmentSize is the size at which a new segment file is started
+	SegmentSize int64 = 64 << 20
+
+	// maxPendingChunks bounds how many out-of-order chunks are held in memory
+	// while waiting for a missing chunk to arrive
+	maxPendingChunks = 1024
+)
+
+var (
+	ErrWriterClosed   = errors.New("storage writer is closed")
+	ErrDuplicateChunk = errors.New("chunk already stored")
+	ErrTooManyPending = errors.New("too many out-of-order chunks pending")
+)
+
+// ChunkRecord locates one stored chunk inside the segment files
+type ChunkRecord struct {
+	Index    int64  `json:"index"`
+	Channel  uint16 `json:"channel,omitempty"`
+	Segment  int    `json:"segment"`
+	Offset   int64  `json:"offset"`
+	Length   int64  `json:"length"`
+	Checksum string `json:"checksum"`
+	// CapturedAt is when the device captured the chunk, as reported by the
+	// client; zero if it was not reported
+	CapturedAt time.Time `json:"capturedAt,omitzero"`
+}
+
+// Gap is an interval of the recording's timeline without data, such as a
+// pause, between the chunks before BeforeChunk and BeforeChunk itself
+type Gap struct {
+	BeforeChunk int64     `json:"beforeChunk"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+}
+
+// Index describes everything stored for an acquisition
+type Index struct {
+	AcquisitionID string        `json:"acquisitionId"`
+	Chunks        []ChunkRecord `json:"chunks"`
+	Segments      int           `json:"segments"`
+	TotalBytes    int64         `json:"totalBytes"`
+	Checksum      string        `json:"checksum,omitempty"`
+	Finalized     bool          `json:"finalized"`
+	UpdatedAt     time.Time     `json:"updatedAt"`
+	// Gaps lists the breaks in the timeline, in chunk order
+	Gaps []Gap `json:"gaps,omitempty"`
+}
+
+// Files lists the names of the stored files of the acquisition, the
+// segments in order and the index last
+func (index *Index) Files() []string {
+	names := make([]string, 0, index.Segments+1)
+	for segment := 0; segment < index.Segments; segment++ {
+		names = append(names, SegmentName(segment))
+	}
+	return append(names, IndexFileName)
+}
+
+// pendingChunk is a chunk received ahead of a gap
+type pendingChunk struct {
+	channel    uint16
+	capturedAt time.Time
+	data       []byte
+}
+
+// Writer appends the decoded chunks of one acquisition to its data directory.
+// Chunks are written in chunk index order; chunks that arrive ahead of a gap
+// are held until the gap is filled or the writer is closed. Every chunk is
+// journaled before WriteChunk returns.
+type Writer struct {
+	dir     string
+	backend Backend
+	index   Index
+	next    int64
+	pending map[int64]pendingChunk
+	segment *os.File
+	hash    hash.Hash
+	closed  bool
+	mutex   sync.Mutex
+
+	journal   *os.File
+	spill     *os.File
+	spillSize int64
+
+	// Sealed segments are stored in the background; any that fail stay in
+	// the staging area and are stored again on Close
+	stores sync.WaitGroup
+}
+
+// OpenWriter opens the writer for an acquisition directory, creating it if
+// needed. An existing index is loaded and the journal replayed on top of it,
+// so writing continues after the last intact chunk.
+func OpenWriter(acquisitionID, dir string, backend Backend) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create acquisition directory: %w", err)
+	}
+
+	w := &Writer{
+		dir:     dir,
+		backend: backend,
+		index:   Index{AcquisitionID: acquisitionID},
+		pending: make(map[int64]pendingChunk),
+		hash:    sha256.New(),
+	}
+
+	existing, err := ReadIndex(dir)
+	switch {
+	case err == nil:
+		if existing.Finalized {
+			return nil, fmt.Errorf("acquisition %s is already finalized", acquisitionID)
+		}
+		w.index = *existing
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+
+	replayed, err := w.replay()
+	if err != nil {
+		return nil, err
+	}
+	if n := len(w.index.Chunks); n > 0 {
+		w.next = w.index.Chunks[n-1].Index + 1
+	}
+	if err := w.rehash(); err != nil {
+		return nil, err
+	}
+
+	if err := w.openJournal(); err != nil {
+		return nil, err
+	}
+	if replayed {
+		// Restored chunks may already follow the last one in the segments
+		err := w.drain()
+		if err == nil {
+			err = w.sync()
+		}
+		if err != nil {
+			if w.segment != nil {
+				w.segment.Close()
+			}
+			w.closeJournal()
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
+
+// WriteChunk stores the payload of chunk index received on channel, without
+// a capture time
+func (w *Writer) WriteChunk(index int64, channel uint16, data []byte) error {
+	return w.WriteChunkAt(index, channel, time.Time{}, data)
+}
+
+// WriteChunkAt stores the payload of chunk index received on channel
+// together with the time the device captured it
+func (w *Writer) WriteChunkAt(index int64, channel uint16, capturedAt time.Time, data []byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return ErrWriterClosed
+	}
+
+	if index < w.next {
+		return ErrDuplicateChunk
+	}
+	if _, exists := w.pending[index]; exists {
+		return ErrDuplicateChunk
+	}
+
+	if index > w.next {
+		if len(w.pending) >= maxPendingChunks {
+			return ErrTooManyPending
+		}
+		chunk := pendingChunk{channel: channel, capturedAt: capturedAt, data: append([]byte(nil), data...)}
+		if err := w.spillChunk(index, chunk); err != nil {
+			return err
+		}
+		w.pending[index] = chunk
+		return nil
+	}
+
+	if err := w.append(index, pendingChunk{channel: channel, capturedAt: capturedAt, data: data}); err != nil {
+		return err
+	}
+	return w.drain()
+}
+
+// drain writes the chunks that were waiting for the next index. A chunk stays
+// pending until it is in a segment, so its spill record is never dropped
+// before its segment record is journaled.
+func (w *Writer) drain() error {
+	for {
+		index := w.next
+		buffered, ok := w.pending[index]
+		if !ok {
+			return nil
+		}
+		if err := w.append(index, buffered); err != nil {
+			return err
+		}
+		delete(w.pending, index)
+	}
+}
+
+// NextIndex returns the lowest chunk index not yet written in order
+func (w *Writer) NextIndex() int64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.next
+}
+
+// Pending returns the number of chunks held back waiting for a missing chunk
+func (w *Writer) Pending() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return len(w.pending)
+}
+
+// Backlog returns how full the out-of-order buffer is, between 0 and 1
+func (w *Writer) Backlog() float64 {
+	return float64(w.Pending()) / maxPendingChunks
+}
+
+// Sync flushes the current segment to stable storage and persists the index,
+// after which the journal is emptied unless chunks are held back behind a gap
+func (w *Writer) Sync() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return ErrWriterClosed
+	}
+	return w.sync()
+}
+
+// Close flushes pending chunks, fsyncs and marks the acquisition as finalized,
+// then hands the last segment and the index to the backend and removes the
+// journal. Chunks still waiting behind a gap are written with their own
+// indices so no received data is lost.
+func (w *Writer) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return nil
+	}
+
+	indices := make([]int64, 0, len(w.pending))
+	for index := range w.pending {
+		indices = append(indices, index)
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+	for _, index := range indices {
+		chunk := w.pending[index]
+		if err := w.append(index, chunk); err != nil {
+			return err
+		}
+		delete(w.pending, index)
+	}
+
+	w.index.Checksum = hex.EncodeToString(w.hash.Sum(nil))
+	w.index.Finalized = true
+	if err := w.sync(); err != nil {
+		return err
+	}
+
+	w.closed = true
+	if w.segment != nil {
+		if err := w.segment.Close(); err != nil {
+			return fmt.Errorf("close segment: %w", err)
+		}
+		w.segment = nil
+	}
+	if err := w.closeJournal(); err != nil {
+		return fmt.Errorf("close journal: %w", err)
+	}
+
+	// Wait for sealed segments, then store the last one and whatever else has
+	// not made it yet. Until the journal is removed, a crash in between is
+	// picked up by Manager.Recover.
+	w.stores.Wait()
+	if err := storeStaged(w.backend, w.dir, &w.index); err != nil {
+		return err
+	}
+	return removeJournal(w.dir)
+}
+
+// Suspend fsyncs and closes the writer without finalizing the acquisition,
+// so that OpenWriter can continue it, typically after a server restart. The
+// journal is kept; chunks held back behind a gap are restored from it.
+func (w *Writer) Suspend() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	if err := w.sync(); err != nil {
+		return err
+	}
+
+	w.closed = true
+	if w.segment != nil {
+		if err := w.segment.Close(); err != nil {
+			return fmt.Errorf("close segment: %w", err)
+		}
+		w.segment = nil
+	}
+	if err := w.closeJournal(); err != nil {
+		return fmt.Errorf("close journal: %w", err)
+	}
+	w.stores.Wait()
+	return nil
+}
+
+// AddGap records a break in the timeline and persists the index right away,
+// so the gap survives a crash like the chunks around it
+func (w *Writer) AddGap(gap Gap) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return ErrWriterClosed
+	}
+	w.index.Gaps = append(w.index.Gaps, gap)
+	return w.sync()
+}
+
+// Size returns the bytes of chunk data the writer holds, written or waiting
+// behind a gap
+func (w *Writer) Size() int64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	size := w.index.TotalBytes
+	for _, chunk := range w.pending {
+		size += int64(len(chunk.data))
+	}
+	return size
+}
+
+// Index returns a snapshot of the acquisition index
+func (w *Writer) Index() Index {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	snapshot := w.index
+	snapshot.Chunks = append([]ChunkRecord(nil), w.index.Chunks...)
+	snapshot.Gaps = append([]Gap(nil), w.index.Gaps...)
+	return snapshot
+}
+
+func (w *Writer) append(index int64, chunk pendingChunk) error {
+	data := chunk.data
+	if err := w.ensureSegment(int64(len(data))); err != nil {
+		return err
+	}
+
+	offset, err := w.segment.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("seek segment: %w", err)
+	}
+	if _, err := w.segment.Write(data); err != nil {
+		return fmt.Errorf("write segment: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	record := ChunkRecord{
+		Index:      index,
+		Channel:    chunk.channel,
+		Segment:    w.index.Segments - 1,
+		Offset:     offset,
+		Length:     int64(len(data)),
+		Checksum:   hex.EncodeToString(sum[:]),
+		CapturedAt: chunk.capturedAt,
+	}
+	if err := w.journalRecord(w.segment, record); err != nil {
+		return err
+	}
+
+	w.hash.Write(data)
+	w.index.Chunks = append(w.index.Chunks, record)
+	w.index.TotalBytes += int64(len(data))
+	if index >= w.next {
+		w.next = index + 1
+	}
+	return nil
+}
+
+// ensureSegment opens the segment that the next write of size bytes goes to
+func (w *Writer) ensureSegment(size int64) error {
+	if w.segment == nil && w.index.Segments > 0 {
+		file, err := os.OpenFile(w.segmentPath(w.index.Segments-1), os.O_RDWR|os.O_CREATE, 0o644)
+		if err != nil {
+			return fmt.Errorf("open segment: %w", err)
+		}
+		w.segment = file
+	}
+
+	if w.segment != nil {
+		info, err := w.segment.Stat()
+		if err != nil {
+			return fmt.Errorf("stat segment: %w", err)
+		}
+		if info.Size() == 0 || info.Size()+size <= SegmentSize {
+			return nil
+		}
+		if err := w.segment.Sync(); err != nil {
+			return fmt.Errorf("sync segment: %w", err)
+		}
+		if err := w.segment.Close(); err != nil {
+			return fmt.Errorf("close segment: %w", err)
+		}
+		w.segment = nil
+
+		// Checkpoint so the journal does not have to reach into sealed segments
+		if err := w.sync(); err != nil {
+			return err
+		}
+		w.storeSealed(SegmentName(w.index.Segments - 1))
+	}
+
+	file, err := os.OpenFile(w.segmentPath(w.index.Segments), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("create segment: %w", err)
+	}
+	w.segment = file
+	w.index.Segments++
+	return nil
+}
+
+func (w *Writer) sync() error {
+	if w.segment != nil {
+		if err := w.segment.Sync(); err != nil {
+			return fmt.Errorf("sync segment: %w", err)
+		}
+	}
+
+	w.index.UpdatedAt = time.Now()
+	if err := writeIndex(w.dir, &w.index); err != nil {
+		return err
+	}
+
+	// The index now covers every journaled chunk except those held back
+	if len(w.pending) > 0 {
+		return nil
+	}
+	return w.resetJournal()
+}
+
+// storeSealed hands a sealed segment to the backend in the background
+func (w *Writer) storeSealed(name string) {
+	acquisitionID := w.index.AcquisitionID
+
+	w.stores.Add(1)
+	go func() {
+		defer w.stores.Done()
+
+		// On failure the segment stays in the staging area for Close
+		w.backend.Store(acquisitionID, name, filepath.Join(w.dir, name))
+	}()
+}
+
+// openSegment opens a segment from the staging area, or from the backend if
+// it has already been stored
+func (w *Writer) openSegment(segment int) (Object, error) {
+	object, err := openLocalObject(w.segmentPath(segment))
+	if errors.Is(err, os.ErrNotExist) {
+		return w.backend.Open(w.index.AcquisitionID, SegmentName(segment))
+	}
+	return object, err
+}
+
+// rehash recomputes the running content checksum from the stored segments
+func (w *Writer) rehash() error {
+	reader := NewReader(&w.index, w.openSegment)
+	defer reader.Close()
+
+	if _, err := io.Copy(w.hash, reader); err != nil {
+		return fmt.Errorf("rehash acquisition data: %w", err)
+	}
+	return nil
+}
+
+func (w *Writer) segmentPath(segment int) string {
+	return filepath.Join(w.dir, SegmentName(segment))
+}
+
+// SegmentName is the file name of segment number n
+func SegmentName(segment int) string {
+	return fmt.Sprintf(segmentFileFormat, segment)
+}
+
+// ReadIndex loads the index of an acquisition directory
+func ReadIndex(dir string) (*Index, error) {
+	data, err := os.ReadFile(filepath.Join(dir, IndexFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("parse index: %w", err)
+	}
+	return &index, nil
+}
+
+// writeIndex replaces the index file atomically
+func writeIndex(dir string, index *Index) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, IndexFileName+".*")
+	if err != nil {
+		return fmt.Errorf("create index: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write index: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync index: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close index: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, IndexFileName)); err != nil {
+		return fmt.Errorf("replace index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+// Package store provides the on-disk session, acquisition and device
+// repository used by services.SessionManager.
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"acquire-app/internal/models"
+	"acquire-app/internal/services"
+)
+
+var _ services.Repository = (*BoltStore)(nil)
+
+var (
+	sessionsBucket     = []byte("sessions")
+	acquisitionsBucket = []byte("acquisitions")
+	devicesBucket      = []byte("devices")
+)
+
+// BoltStore keeps sessions, acquisitions and devices as JSON records in an
+// embedded bbolt database file, one bucket per record type keyed by ID.
+// Acquisitions are also indexed for catalog queries.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens or creates the database at path. Only one process can hold
+// the database open; a second one fails after a short wait.
+func OpenBolt(path string) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create session store directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open session store %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{sessionsBucket, acquisitionsBucket, devicesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return ensureAcquisitionIndexes(tx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initialize session store %s: %w", path, err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) LoadSessions() ([]*models.Session, error) {
+	var sessions []*models.Session
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).ForEach(func(key, value []byte) error {
+			var session models.Session
+			if err := json.Unmarshal(value, &session); err != nil {
+				return fmt.Errorf("decode session %s: %w", key, err)
+			}
+			sessions = append(sessions, &session)
+			return nil
+		})
+	})
+	return sessions, err
+}
+
+func (s *BoltStore) LoadAcquisitions() ([]*models.Acquisition, error) {
+	var acquisitions []*models.Acquisition
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(acquisitionsBucket).ForEach(func(key, value []byte) error {
+			var acquisition models.Acquisition
+			if err := json.Unmarshal(value, &acquisition); err != nil {
+				return fmt.Errorf("decode acquisition %s: %w", key, err)
+			}
+			acquisitions = append(acquisitions, &acquisition)
+			return nil
+		})
+	})
+	return acquisitions, err
+}
+
+func (s *BoltStore) LoadDevices() ([]*models.Device, error) {
+	var devices []*models.Device
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(devicesBucket).ForEach(func(key, value []byte) error {
+			var device models.Device
+			if err := json.Unmarshal(value, &device); err != nil {
+				return fmt.Errorf("decode device %s: %w", key, err)
+			}
+			devices = append(devices, &device)
+			return nil
+		})
+	})
+	return devices, err
+}
+
+func (s *BoltStore) SaveSession(session *models.Session) error {
+	return s.put(sessionsBucket, session.ID, session)
+}
+
+func (s *BoltStore) SaveDevice(device *models.Device) error {
+	return s.put(devicesBucket, device.ID, device)
+}
+
+// SaveAcquisition stores an acquisition and moves its index entries from the
+// previous version of the record to the new one
+func (s *BoltStore) SaveAcquisition(acquisition *models.Acquisition) error {
+	value, err := json.Marshal(acquisition)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(acquisitionsBucket)
+		if err := unindexAcquisition(tx, bucket.Get([]byte(acquisition.ID))); err != nil {
+			return err
+		}
+		if err := bucket.Put([]byte(acquisition.ID), value); err != nil {
+			return err
+		}
+		return indexAcquisition(tx, acquisition)
+	})
+}
+
+func (s *BoltStore) DeleteSession(sessionID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).Delete([]byte(sessionID))
+	})
+}
+
+func (s *BoltStore) DeleteAcquisition(acquisitionID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(acquisitionsBucket)
+		if err := unindexAcquisition(tx, bucket.Get([]byte(acquisitionID))); err != nil {
+			return err
+		}
+		return bucket.Delete([]byte(acquisitionID))
+	})
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltStore) put(bucket []byte, id string, record interface{}) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(id), value)
+	})
+}
@@ -0,0 +1,260 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+	"acquire-app/internal/models"
+	"acquire-app/internal/services"
+)
+
+var (
+	metaBucket = []byte("meta")
+
+	// acquisitionIndexVersionKey records which index layout the database
+	// holds; the indexes are rebuilt when it changes
+	acquisitionIndexVersionKey = []byte("acquisitionIndexVersion")
+	acquisitionIndexVersion    = []byte("1")
+)
+
+// acquisitionIndex is a secondary index over the acquisitions bucket. Keys
+// are the indexed field, if any, and a zero byte, followed by the sort key;
+// values are acquisition IDs.
+type acquisitionIndex struct {
+	bucket []byte
+	// field returns the indexed field; nil for the plain sort indexes.
+	// Acquisitions with an empty field are not indexed.
+	field func(acquisition *models.Acquisition) string
+	// bySize orders the index by size rather than start time
+	bySize bool
+}
+
+var (
+	startIndex     = &acquisitionIndex{bucket: []byte("acquisitions_by_start")}
+	sizeIndex      = &acquisitionIndex{bucket: []byte("acquisitions_by_size"), bySize: true}
+	patientIndex   = &acquisitionIndex{bucket: []byte("acquisitions_by_patient"), field: func(a *models.Acquisition) string { return a.Metadata.PatientID }}
+	deviceIndex    = &acquisitionIndex{bucket: []byte("acquisitions_by_device"), field: func(a *models.Acquisition) string { return a.DeviceID }}
+	operatorIndex  = &acquisitionIndex{bucket: []byte("acquisitions_by_operator"), field: func(a *models.Acquisition) string { return a.Metadata.Operator }}
+	procedureIndex = &acquisitionIndex{bucket: []byte("acquisitions_by_procedure"), field: func(a *models.Acquisition) string { return a.Metadata.ProcedureType }}
+	statusIndex    = &acquisitionIndex{bucket: []byte("acquisitions_by_status"), field: func(a *models.Acquisition) string { return string(a.Status) }}
+
+	acquisitionIndexes = []*acquisitionIndex{startIndex, sizeIndex, patientIndex, deviceIndex, operatorIndex, procedureIndex, statusIndex}
+)
+
+// key returns the index key of an acquisition, or nil if it is not indexed
+func (ix *acquisitionIndex) key(acquisition *models.Acquisition) []byte {
+	var key []byte
+	if ix.field != nil {
+		field := ix.field(acquisition)
+		if field == "" {
+			return nil
+		}
+		key = ix.prefix(field)
+	}
+	if ix.bySize {
+		return append(key, services.SizeKey(acquisition.Statistics.TotalBytes, acquisition.ID)...)
+	}
+	return append(key, services.StartTimeKey(acquisition.StartTime, acquisition.ID)...)
+}
+
+// prefix returns the key prefix shared by all acquisitions with a field value
+func (ix *acquisitionIndex) prefix(field string) []byte {
+	return append([]byte(field), 0)
+}
+
+// ensureAcquisitionIndexes creates the index buckets and rebuilds them if
+// they are missing or of an older layout
+func ensureAcquisitionIndexes(tx *bolt.Tx) error {
+	meta, err := tx.CreateBucketIfNotExists(metaBucket)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(meta.Get(acquisitionIndexVersionKey), acquisitionIndexVersion) {
+		return nil
+	}
+
+	for _, ix := range acquisitionIndexes {
+		if err := tx.DeleteBucket(ix.bucket); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		if _, err := tx.CreateBucket(ix.bucket); err != nil {
+			return err
+		}
+	}
+
+	err = tx.Bucket(acquisitionsBucket).ForEach(func(key, value []byte) error {
+		var acquisition models.Acquisition
+		if err := json.Unmarshal(value, &acquisition); err != nil {
+			return fmt.Errorf("decode acquisition %s: %w", key, err)
+		}
+		return indexAcquisition(tx, &acquisition)
+	})
+	if err != nil {
+		return err
+	}
+
+	return meta.Put(acquisitionIndexVersionKey, acquisitionIndexVersion)
+}
+
+func indexAcquisition(tx *bolt.Tx, acquisition *models.Acquisition) error {
+	for _, ix := range acquisitionIndexes {
+		if key := ix.key(acquisition); key != nil {
+			if err := tx.Bucket(ix.bucket).Put(key, []byte(acquisition.ID)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// unindexAcquisition removes the index entries of a stored acquisition record
+func unindexAcquisition(tx *bolt.Tx, record []byte) error {
+	if record == nil {
+		return nil
+	}
+	var acquisition models.Acquisition
+	if err := json.Unmarshal(record, &acquisition); err != nil {
+		return fmt.Errorf("decode acquisition: %w", err)
+	}
+
+	for _, ix := range acquisitionIndexes {
+		if key := ix.key(&acquisition); key != nil {
+			if err := tx.Bucket(ix.bucket).Delete(key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// QueryAcquisitions walks the index that best matches the query: the size
+// index when sorting by size, otherwise the index of the most selective
+// equality filter given, or the start time index. Remaining filters are
+// checked against the records found.
+func (s *BoltStore) QueryAcquisitions(query services.AcquisitionQuery) (*services.AcquisitionPage, error) {
+	after, err := query.CursorKey()
+	if err != nil {
+		return nil, err
+	}
+
+	ix, prefix := planAcquisitionQuery(&query)
+
+	// Bounds on the sort key part of index keys, lo inclusive, hi exclusive
+	var lo, hi []byte
+	if ix.bySize {
+		if query.MinSize > 0 {
+			lo = services.SizeKey(query.MinSize, "")
+		}
+	} else {
+		if !query.From.IsZero() {
+			lo = services.StartTimeKey(query.From, "")
+		}
+		if !query.To.IsZero() {
+			hi = services.StartTimeKey(query.To, "")
+		}
+	}
+
+	page := &services.AcquisitionPage{}
+	err = s.db.View(func(tx *bolt.Tx) error {
+		records := tx.Bucket(acquisitionsBucket)
+		c := tx.Bucket(ix.bucket).Cursor()
+		withPrefix := func(key []byte) []byte {
+			return append(append([]byte(nil), prefix...), key...)
+		}
+
+		var k, v []byte
+		next := c.Next
+		if !query.Descending {
+			from := lo
+			if after != nil && (from == nil || bytes.Compare(after, from) >= 0) {
+				from = after
+			}
+			k, v = c.Seek(withPrefix(from))
+			if after != nil && bytes.Equal(k, withPrefix(after)) {
+				k, v = c.Next()
+			}
+		} else {
+			next = c.Prev
+			to := hi
+			if after != nil && (to == nil || bytes.Compare(after, to) < 0) {
+				to = after
+			}
+			var seek []byte
+			switch {
+			case to != nil:
+				seek = withPrefix(to)
+			case len(prefix) > 0:
+				// Just past the last key with the prefix, which ends in
+				// the zero separator
+				seek = append([]byte(nil), prefix...)
+				seek[len(seek)-1]++
+			}
+			if seek == nil {
+				k, v = c.Last()
+			} else if k, v = c.Seek(seek); k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+		}
+
+		for ; k != nil && bytes.HasPrefix(k, prefix); k, v = next() {
+			sortKey := k[len(prefix):]
+			if !query.Descending && hi != nil && bytes.Compare(sortKey, hi) >= 0 {
+				break
+			}
+			if query.Descending && lo != nil && bytes.Compare(sortKey, lo) < 0 {
+				break
+			}
+
+			record := records.Get(v)
+			if record == nil {
+				continue
+			}
+			var acquisition models.Acquisition
+			if err := json.Unmarshal(record, &acquisition); err != nil {
+				return fmt.Errorf("decode acquisition %s: %w", v, err)
+			}
+			if !query.Matches(&acquisition) {
+				continue
+			}
+
+			if len(page.Acquisitions) == query.Limit {
+				last := page.Acquisitions[query.Limit-1]
+				page.NextCursor = services.EncodeCursor(query.SortKey(last))
+				break
+			}
+			page.Acquisitions = append(page.Acquisitions, &acquisition)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// planAcquisitionQuery picks the index to walk and the key prefix to walk
+func planAcquisitionQuery(query *services.AcquisitionQuery) (*acquisitionIndex, []byte) {
+	if query.SortBy == services.SortBySize {
+		return sizeIndex, nil
+	}
+
+	for _, candidate := range []struct {
+		ix    *acquisitionIndex
+		field string
+	}{
+		{patientIndex, query.PatientID},
+		{deviceIndex, query.DeviceID},
+		{operatorIndex, query.Operator},
+		{procedureIndex, query.ProcedureType},
+		{statusIndex, string(query.Status)},
+	} {
+		if candidate.field != "" {
+			return candidate.ix, candidate.ix.prefix(candidate.field)
+		}
+	}
+	return startIndex, nil
+}
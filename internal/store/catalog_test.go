@@ -0,0 +1,254 @@
+package store
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"acquire-app/internal/models"
+	"acquire-app/internal/services"
+)
+
+func openTestStore(t *testing.T) *BoltStore {
+	t.Helper()
+	s, err := OpenBolt(filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatalf("OpenBolt: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// saveTestAcquisitions stores acq_0 to acq_7, a minute apart and 1000 bytes
+// larger each. Even ones are stopped, odd ones active.
+func saveTestAcquisitions(t *testing.T, s *BoltStore) []*models.Acquisition {
+	t.Helper()
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	acquisitions := make([]*models.Acquisition, 8)
+	for i := range acquisitions {
+		status := models.AcquisitionActive
+		if i%2 == 0 {
+			status = models.AcquisitionStopped
+		}
+		acquisitions[i] = &models.Acquisition{
+			ID:        fmt.Sprintf("acq_%d", i),
+			DeviceID:  "device_1",
+			Status:    status,
+			StartTime: start.Add(time.Duration(i) * time.Minute),
+			Metadata:  models.AcquisitionMetadata{PatientID: fmt.Sprintf("patient_%d", i/4), Operator: "operator"},
+		}
+		acquisitions[i].Statistics.TotalBytes = int64(i+1) * 1000
+		save(t, s, acquisitions[i])
+	}
+	return acquisitions
+}
+
+func save(t *testing.T, s *BoltStore, acquisition *models.Acquisition) {
+	t.Helper()
+	if err := s.SaveAcquisition(acquisition); err != nil {
+		t.Fatalf("SaveAcquisition %s: %v", acquisition.ID, err)
+	}
+}
+
+// checkIndexes fails unless every index holds exactly the entries of the
+// stored records, so stale entries of old versions show up
+func checkIndexes(t *testing.T, s *BoltStore) {
+	t.Helper()
+	acquisitions, err := s.LoadAcquisitions()
+	if err != nil {
+		t.Fatalf("LoadAcquisitions: %v", err)
+	}
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		for _, ix := range acquisitionIndexes {
+			want := map[string]string{}
+			for _, acquisition := range acquisitions {
+				if key := ix.key(acquisition); key != nil {
+					want[string(key)] = acquisition.ID
+				}
+			}
+			got := map[string]string{}
+			tx.Bucket(ix.bucket).ForEach(func(key, value []byte) error {
+				got[string(key)] = string(value)
+				return nil
+			})
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("index %s holds %q, want %q", ix.bucket, got, want)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("read indexes: %v", err)
+	}
+}
+
+func pageIDs(page *services.AcquisitionPage) []string {
+	ids := []string{}
+	for _, acquisition := range page.Acquisitions {
+		ids = append(ids, acquisition.ID)
+	}
+	return ids
+}
+
+func TestAcquisitionIndexes(t *testing.T) {
+	s := openTestStore(t)
+	acquisitions := saveTestAcquisitions(t, s)
+	checkIndexes(t, s)
+
+	// Every indexed field changes, one of them to empty
+	acquisitions[1].Status = models.AcquisitionStopped
+	acquisitions[1].Statistics.TotalBytes = 50000
+	acquisitions[2].Metadata.PatientID = ""
+	acquisitions[3].Metadata.Operator = "someone else"
+	acquisitions[3].Metadata.ProcedureType = "holter"
+	acquisitions[4].DeviceID = "device_2"
+	acquisitions[5].StartTime = acquisitions[5].StartTime.Add(time.Hour)
+	for _, acquisition := range acquisitions[1:6] {
+		save(t, s, acquisition)
+	}
+	checkIndexes(t, s)
+
+	// Saving an unchanged record leaves the indexes as they are
+	save(t, s, acquisitions[1])
+	checkIndexes(t, s)
+
+	for _, id := range []string{"acq_0", "acq_3", "acq_missing"} {
+		if err := s.DeleteAcquisition(id); err != nil {
+			t.Fatalf("DeleteAcquisition %s: %v", id, err)
+		}
+	}
+	checkIndexes(t, s)
+
+	page, err := s.QueryAcquisitions(services.AcquisitionQuery{Status: models.AcquisitionStopped, Limit: 10})
+	if err != nil {
+		t.Fatalf("QueryAcquisitions: %v", err)
+	}
+	if got, want := pageIDs(page), []string{"acq_1", "acq_2", "acq_4", "acq_6"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("stopped acquisitions %v, want %v", got, want)
+	}
+}
+
+func TestQueryAcquisitionsPagination(t *testing.T) {
+	tests := []struct {
+		name  string
+		query services.AcquisitionQuery
+		first []string
+		// change updates acquisitions between the first page and the rest
+		change func(acquisitions []*models.Acquisition) (deleted []string)
+		rest   []string
+	}{
+		{
+			name:  "status ascending",
+			query: services.AcquisitionQuery{Status: models.AcquisitionStopped, Limit: 2},
+			first: []string{"acq_0", "acq_2"},
+			change: func(a []*models.Acquisition) []string {
+				a[0].Status = models.AcquisitionActive  // already listed
+				a[1].Status = models.AcquisitionStopped // before the cursor
+				a[4].Status = models.AcquisitionActive
+				a[5].Status = models.AcquisitionStopped
+				a[7].Status = models.AcquisitionStopped
+				return []string{"acq_6"}
+			},
+			rest: []string{"acq_5", "acq_7"},
+		},
+		{
+			name:  "status descending",
+			query: services.AcquisitionQuery{Status: models.AcquisitionStopped, Descending: true, Limit: 2},
+			first: []string{"acq_6", "acq_4"},
+			change: func(a []*models.Acquisition) []string {
+				a[5].Status = models.AcquisitionStopped // before the cursor
+				a[2].Status = models.AcquisitionActive
+				a[1].Status = models.AcquisitionStopped
+				return []string{"acq_0"}
+			},
+			rest: []string{"acq_1"},
+		},
+		{
+			name:  "patient and status",
+			query: services.AcquisitionQuery{PatientID: "patient_1", Status: models.AcquisitionActive, Limit: 1},
+			first: []string{"acq_5"},
+			change: func(a []*models.Acquisition) []string {
+				a[7].Metadata.PatientID = "patient_0"
+				a[6].Status = models.AcquisitionActive
+				a[3].Metadata.PatientID = "patient_1" // before the cursor
+				return nil
+			},
+			rest: []string{"acq_6"},
+		},
+		{
+			name:  "size",
+			query: services.AcquisitionQuery{SortBy: services.SortBySize, MinSize: 2000, Limit: 3},
+			first: []string{"acq_1", "acq_2", "acq_3"},
+			change: func(a []*models.Acquisition) []string {
+				a[5].Statistics.TotalBytes = 3500 // now before the cursor
+				a[0].Statistics.TotalBytes = 5500
+				return []string{"acq_6"}
+			},
+			rest: []string{"acq_4", "acq_0", "acq_7"},
+		},
+		{
+			name:  "size descending",
+			query: services.AcquisitionQuery{SortBy: services.SortBySize, Descending: true, Limit: 2},
+			first: []string{"acq_7", "acq_6"},
+			change: func(a []*models.Acquisition) []string {
+				a[2].Statistics.TotalBytes = 9000 // now before the cursor
+				a[7].Statistics.TotalBytes = 500  // listed, and moved past the cursor
+				return nil
+			},
+			rest: []string{"acq_5", "acq_4", "acq_3", "acq_1", "acq_0", "acq_7"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := openTestStore(t)
+			acquisitions := saveTestAcquisitions(t, s)
+
+			query := tt.query
+			page, err := s.QueryAcquisitions(query)
+			if err != nil {
+				t.Fatalf("QueryAcquisitions: %v", err)
+			}
+			if got := pageIDs(page); !reflect.DeepEqual(got, tt.first) {
+				t.Fatalf("first page %v, want %v", got, tt.first)
+			}
+			if page.NextCursor == "" {
+				t.Fatalf("first page has no cursor")
+			}
+
+			deleted := tt.change(acquisitions)
+			for _, acquisition := range acquisitions {
+				save(t, s, acquisition)
+			}
+			for _, id := range deleted {
+				if err := s.DeleteAcquisition(id); err != nil {
+					t.Fatalf("DeleteAcquisition %s: %v", id, err)
+				}
+			}
+			checkIndexes(t, s)
+
+			rest := []string{}
+			for query.Cursor = page.NextCursor; query.Cursor != ""; query.Cursor = page.NextCursor {
+				if page, err = s.QueryAcquisitions(query); err != nil {
+					t.Fatalf("QueryAcquisitions: %v", err)
+				}
+				if len(page.Acquisitions) == 0 || len(page.Acquisitions) > query.Limit {
+					t.Fatalf("page of %d acquisitions, want 1 to %d", len(page.Acquisitions), query.Limit)
+				}
+				rest = append(rest, pageIDs(page)...)
+				// Stale index entries can send the cursor backwards
+				if len(rest) > len(acquisitions) {
+					t.Fatalf("pages do not end: %v", rest)
+				}
+			}
+			if !reflect.DeepEqual(rest, tt.rest) {
+				t.Errorf("remaining pages %v, want %v", rest, tt.rest)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+// Package edf writes signal recordings in the European Data Format, EDF+
+// continuous variant (EDF+C), including an "EDF Annotations" signal.
+//
+// A file is described up front by a Header, which fixes the number of data
+// records, then written one data record at a time:
+//
+//	w, err := edf.NewWriter(out, header)
+//	for each record {
+//		err = w.WriteRecord(samples) // one []int16 per signal
+//	}
+//	err = w.Close()
+//
+// The writer never seeks, so it can stream to a network connection, and the
+// final file size is known before anything is written (Writer.Size).
+package edf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxRecordSize is the data record size in bytes that the EDF specification
+// recommends not to exceed
+const MaxRecordSize = 61440
+
+// annotationsLabel is the reserved label of the EDF+ annotation signal
+const annotationsLabel = "EDF Annotations"
+
+var ErrInvalidHeader = errors.New("edf: invalid header")
+
+// Patient identifies the subject of a recording. Empty fields are written as
+// "X", the EDF+ marker for unknown.
+type Patient struct {
+	// Code is the hospital administration code of the patient
+	Code string
+	// Sex is "M", "F" or empty
+	Sex       string
+	Birthdate time.Time
+	Name      string
+}
+
+// Recording identifies a recording. Empty fields are written as "X".
+type Recording struct {
+	Start time.Time
+	// AdminCode is the hospital administration code of the investigation
+	AdminCode  string
+	Technician string
+	Equipment  string
+	// Additional subfields follow the standard ones
+	Additional []string
+}
+
+// Signal describes one ordinary signal. Digital sample values map linearly
+// onto the physical range.
+type Signal struct {
+	Label             string
+	TransducerType    string
+	PhysicalDimension string
+	PhysicalMin       float64
+	PhysicalMax       float64
+	DigitalMin        int
+	DigitalMax        int
+	Prefiltering      string
+	SamplesPerRecord  int
+}
+
+// Annotation is a time-stamped note. Onset is relative to the recording
+// start; a zero Duration is omitted from the file.
+type Annotation struct {
+	Onset    time.Duration
+	Duration time.Duration
+	Text     string
+}
+
+// Header describes an EDF+ file
+type Header struct {
+	Patient        Patient
+	Recording      Recording
+	RecordDuration time.Duration
+	Records        int
+	Signals        []Signal
+	// Annotations are stored in the data record their onset falls into
+	Annotations []Annotation
+}
+
+func (h *Header) validate() error {
+	if h.RecordDuration <= 0 {
+		return fmt.Errorf("%w: record duration must be positive", ErrInvalidHeader)
+	}
+	if h.Records < 0 {
+		return fmt.Errorf("%w: negative number of records", ErrInvalidHeader)
+	}
+	if len(h.Signals) == 0 {
+		return fmt.Errorf("%w: no signals", ErrInvalidHeader)
+	}
+
+	for i, signal := range h.Signals {
+		switch {
+		case signal.Label == annotationsLabel:
+			return fmt.Errorf("%w: signal %d uses the reserved label %q", ErrInvalidHeader, i, annotationsLabel)
+		case signal.SamplesPerRecord <= 0:
+			return fmt.Errorf("%w: signal %d has no samples per record", ErrInvalidHeader, i)
+		case signal.DigitalMin < -32768 || signal.DigitalMax > 32767 || signal.DigitalMin >= signal.DigitalMax:
+			return fmt.Errorf("%w: signal %d has digital range %d..%d", ErrInvalidHeader, i, signal.DigitalMin, signal.DigitalMax)
+		case signal.PhysicalMin == signal.PhysicalMax:
+			return fmt.Errorf("%w: signal %d has an empty physical range", ErrInvalidHeader, i)
+		}
+	}
+	return nil
+}
+
+// field formats the EDF+ local patient identification
+func (p *Patient) field() string {
+	birthdate := ""
+	if !p.Birthdate.IsZero() {
+		birthdate = formatDate(p.Birthdate)
+	}
+	return joinSubfields(p.Code, p.Sex, birthdate, p.Name)
+}
+
+// field formats the EDF+ local recording identification
+func (r *Recording) field() string {
+	subfields := append([]string{r.AdminCode, r.Technician, r.Equipment}, r.Additional...)
+	return "Startdate " + formatDate(r.Start) + " " + joinSubfields(subfields...)
+}
+
+// formatDate formats a date as EDF+ subfields expect it, e.g. 02-MAR-2002
+func formatDate(t time.Time) string {
+	return strings.ToUpper(t.Format("02-Jan-2006"))
+}
+
+// joinSubfields joins identification subfields, which may not contain
+// spaces, replacing empty ones with "X"
+func joinSubfields(subfields ...string) string {
+	for i, subfield := range subfields {
+		subfield = strings.Join(strings.Fields(subfield), "_")
+		if subfield == "" {
+			subfield = "X"
+		}
+		subfields[i] = subfield
+	}
+	return strings.Join(subfields, " ")
+}
@@ -0,0 +1,276 @@
+package edf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Writer writes an EDF+ file to an underlying writer
+type Writer struct {
+	w      io.Writer
+	header Header
+
+	// annotations holds the encoded annotation signal of each data record
+	// that carries annotations beyond its time-keeping entry
+	annotations       map[int][]byte
+	annotationSamples int
+
+	headerWritten bool
+	written       int
+	record        bytes.Buffer
+}
+
+// NewWriter validates the header and prepares a writer. Nothing is written
+// until the first record or Close.
+func NewWriter(w io.Writer, header Header) (*Writer, error) {
+	if err := header.validate(); err != nil {
+		return nil, err
+	}
+
+	ew := &Writer{
+		w:           w,
+		header:      header,
+		annotations: make(map[int][]byte),
+	}
+
+	// Group annotations by data record, in onset order
+	sorted := append([]Annotation(nil), header.Annotations...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Onset < sorted[j].Onset })
+	for _, annotation := range sorted {
+		if header.Records == 0 {
+			break
+		}
+		record := int(annotation.Onset / header.RecordDuration)
+		if record < 0 {
+			record = 0
+		}
+		if record >= header.Records {
+			record = header.Records - 1
+		}
+		ew.annotations[record] = append(ew.annotations[record], annotationTAL(annotation)...)
+	}
+
+	// The annotation signal is as long as the fullest record needs
+	size := 0
+	for record := 0; record < header.Records; record++ {
+		if n := len(timekeepingTAL(ew.onset(record))) + len(ew.annotations[record]); n > size {
+			size = n
+		}
+	}
+	ew.annotationSamples = (size + 1) / 2
+	if ew.annotationSamples == 0 {
+		ew.annotationSamples = 1
+	}
+
+	return ew, nil
+}
+
+// Size returns the size in bytes of the complete file
+func (w *Writer) Size() int64 {
+	return int64(w.headerSize()) + int64(w.header.Records)*int64(w.recordSize())
+}
+
+// RecordSize returns the size in bytes of one data record, annotation signal
+// included
+func (w *Writer) RecordSize() int {
+	return w.recordSize()
+}
+
+// WriteRecord writes the next data record, with one slice of
+// Signal.SamplesPerRecord digital values per signal
+func (w *Writer) WriteRecord(samples [][]int16) error {
+	if w.written >= w.header.Records {
+		return fmt.Errorf("edf: all %d data records already written", w.header.Records)
+	}
+	if len(samples) != len(w.header.Signals) {
+		return fmt.Errorf("edf: record has %d signals, header declares %d", len(samples), len(w.header.Signals))
+	}
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	w.record.Reset()
+	for i, signal := range w.header.Signals {
+		if len(samples[i]) != signal.SamplesPerRecord {
+			return fmt.Errorf("edf: signal %d has %d samples, header declares %d", i, len(samples[i]), signal.SamplesPerRecord)
+		}
+		binary.Write(&w.record, binary.LittleEndian, samples[i])
+	}
+
+	annotations := make([]byte, 2*w.annotationSamples)
+	n := copy(annotations, timekeepingTAL(w.onset(w.written)))
+	copy(annotations[n:], w.annotations[w.written])
+	w.record.Write(annotations)
+
+	if _, err := w.w.Write(w.record.Bytes()); err != nil {
+		return err
+	}
+	w.written++
+	return nil
+}
+
+// Close writes the header if no record was written and checks that the file
+// holds as many data records as its header declares. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	if w.written != w.header.Records {
+		return fmt.Errorf("edf: %d of %d data records written", w.written, w.header.Records)
+	}
+	return nil
+}
+
+// onset returns the start of a data record relative to the recording start
+func (w *Writer) onset(record int) time.Duration {
+	return time.Duration(record) * w.header.RecordDuration
+}
+
+func (w *Writer) headerSize() int {
+	return 256 * (len(w.header.Signals) + 2)
+}
+
+func (w *Writer) recordSize() int {
+	size := 2 * w.annotationSamples
+	for _, signal := range w.header.Signals {
+		size += 2 * signal.SamplesPerRecord
+	}
+	return size
+}
+
+func (w *Writer) writeHeader() error {
+	if w.headerWritten {
+		return nil
+	}
+
+	h := &w.header
+	var buf bytes.Buffer
+	field := func(value string, width int) {
+		value = ascii(value)
+		if len(value) > width {
+			value = value[:width]
+		}
+		buf.WriteString(value)
+		buf.WriteString(strings.Repeat(" ", width-len(value)))
+	}
+
+	field("0", 8)
+	field(h.Patient.field(), 80)
+	field(h.Recording.field(), 80)
+	// EDF+ years beyond 2084 are clipped here; the full date is in the
+	// recording identification
+	year := h.Recording.Start.Year()
+	if year > 2084 {
+		year = 2084
+	}
+	field(fmt.Sprintf("%02d.%02d.%02d", h.Recording.Start.Day(), h.Recording.Start.Month(), year%100), 8)
+	field(h.Recording.Start.Format("15.04.05"), 8)
+	field(strconv.Itoa(w.headerSize()), 8)
+	field("EDF+C", 44)
+	field(strconv.Itoa(h.Records), 8)
+	field(formatNumber(h.RecordDuration.Seconds()), 8)
+	field(strconv.Itoa(len(h.Signals)+1), 4)
+
+	// Signal fields are stored field by field, the annotation signal last
+	signals := append(append([]Signal(nil), h.Signals...), Signal{
+		Label:            annotationsLabel,
+		PhysicalMin:      -1,
+		PhysicalMax:      1,
+		DigitalMin:       -32768,
+		DigitalMax:       32767,
+		SamplesPerRecord: w.annotationSamples,
+	})
+	for _, s := range signals {
+		field(s.Label, 16)
+	}
+	for _, s := range signals {
+		field(s.TransducerType, 80)
+	}
+	for _, s := range signals {
+		field(s.PhysicalDimension, 8)
+	}
+	for _, s := range signals {
+		field(formatNumber(s.PhysicalMin), 8)
+	}
+	for _, s := range signals {
+		field(formatNumber(s.PhysicalMax), 8)
+	}
+	for _, s := range signals {
+		field(strconv.Itoa(s.DigitalMin), 8)
+	}
+	for _, s := range signals {
+		field(strconv.Itoa(s.DigitalMax), 8)
+	}
+	for _, s := range signals {
+		field(s.Prefiltering, 80)
+	}
+	for _, s := range signals {
+		field(strconv.Itoa(s.SamplesPerRecord), 8)
+	}
+	for range signals {
+		field("", 32)
+	}
+
+	if _, err := w.w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	w.headerWritten = true
+	return nil
+}
+
+// timekeepingTAL is the first annotation of every data record, giving the
+// record's start time
+func timekeepingTAL(onset time.Duration) []byte {
+	return []byte(formatOnset(onset) + "\x14\x14\x00")
+}
+
+// annotationTAL encodes an annotation as a time-stamped annotation list
+func annotationTAL(annotation Annotation) []byte {
+	tal := formatOnset(annotation.Onset)
+	if annotation.Duration > 0 {
+		tal += "\x15" + strconv.FormatFloat(annotation.Duration.Seconds(), 'f', -1, 64)
+	}
+	// The separators may not appear in the text
+	text := strings.Map(func(r rune) rune {
+		if r == 0x00 || r == 0x14 || r == 0x15 {
+			return ' '
+		}
+		return r
+	}, annotation.Text)
+	return []byte(tal + "\x14" + text + "\x14\x00")
+}
+
+func formatOnset(onset time.Duration) string {
+	seconds := strconv.FormatFloat(onset.Seconds(), 'f', -1, 64)
+	if onset >= 0 {
+		return "+" + seconds
+	}
+	return seconds
+}
+
+// formatNumber formats a header number in at most 8 characters
+func formatNumber(v float64) string {
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	for precision := 7; len(s) > 8 && precision > 0; precision-- {
+		s = strconv.FormatFloat(v, 'g', precision, 64)
+	}
+	return s
+}
+
+// ascii replaces everything but printable US-ASCII, which is all an EDF
+// header may contain
+func ascii(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 32 || r > 126 {
+			return '?'
+		}
+		return r
+	}, s)
+}
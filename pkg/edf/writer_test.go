@@ -0,0 +1,234 @@
+package edf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testHeader() Header {
+	return Header{
+		Patient: Patient{
+			Code:      "MCH-0234567",
+			Sex:       "F",
+			Birthdate: time.Date(1951, 8, 16, 0, 0, 0, 0, time.UTC),
+			Name:      "Haagse Harry",
+		},
+		Recording: Recording{
+			Start:     time.Date(2002, 3, 2, 10, 5, 7, 0, time.UTC),
+			AdminCode: "EMG561",
+			Equipment: "acquire-app",
+		},
+		RecordDuration: time.Second,
+		Records:        3,
+		Signals: []Signal{
+			{Label: "ch0", PhysicalDimension: "uV", PhysicalMin: -3200, PhysicalMax: 3200, DigitalMin: -32768, DigitalMax: 32767, SamplesPerRecord: 4},
+			{Label: "ch1", PhysicalDimension: "mV", PhysicalMin: -1.5, PhysicalMax: 1.5, DigitalMin: -2048, DigitalMax: 2047, SamplesPerRecord: 2},
+		},
+		Annotations: []Annotation{
+			{Onset: 2500 * time.Millisecond, Text: "stop"},
+			{Onset: 1500 * time.Millisecond, Duration: 250 * time.Millisecond, Text: "gap\x14here"},
+		},
+	}
+}
+
+func writeFile(t *testing.T, header Header) ([]byte, *Writer) {
+	t.Helper()
+
+	var out bytes.Buffer
+	w, err := NewWriter(&out, header)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	for record := 0; record < header.Records; record++ {
+		var samples [][]int16
+		for s, signal := range header.Signals {
+			values := make([]int16, signal.SamplesPerRecord)
+			for i := range values {
+				values[i] = int16(100*record + 10*s + i)
+			}
+			samples = append(samples, values)
+		}
+		if err := w.WriteRecord(samples); err != nil {
+			t.Fatalf("WriteRecord %d: %v", record, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return out.Bytes(), w
+}
+
+func TestWriterHeader(t *testing.T) {
+	file, w := writeFile(t, testHeader())
+	if int64(len(file)) != w.Size() {
+		t.Fatalf("file is %d bytes, Size() = %d", len(file), w.Size())
+	}
+
+	// The fixed part of the header, as laid out in the EDF specification
+	fixed := []struct {
+		name          string
+		offset, width int
+		want          string
+	}{
+		{"version", 0, 8, "0"},
+		{"patient", 8, 80, "MCH-0234567 F 16-AUG-1951 Haagse_Harry"},
+		{"recording", 88, 80, "Startdate 02-MAR-2002 EMG561 X acquire-app"},
+		{"start date", 168, 8, "02.03.02"},
+		{"start time", 176, 8, "10.05.07"},
+		{"header bytes", 184, 8, "1024"},
+		{"reserved", 192, 44, "EDF+C"},
+		{"records", 236, 8, "3"},
+		{"record duration", 244, 8, "1"},
+		{"signals", 252, 4, "3"},
+	}
+	for _, field := range fixed {
+		got := string(file[field.offset : field.offset+field.width])
+		if want := field.want + strings.Repeat(" ", field.width-len(field.want)); got != want {
+			t.Errorf("%s = %q, want %q", field.name, got, want)
+		}
+	}
+
+	// Per-signal fields follow, each stored for all signals in turn
+	signalFields := []struct {
+		name  string
+		width int
+		want  []string
+	}{
+		{"label", 16, []string{"ch0", "ch1", "EDF Annotations"}},
+		{"transducer", 80, []string{"", "", ""}},
+		{"dimension", 8, []string{"uV", "mV", ""}},
+		{"physical minimum", 8, []string{"-3200", "-1.5", "-1"}},
+		{"physical maximum", 8, []string{"3200", "1.5", "1"}},
+		{"digital minimum", 8, []string{"-32768", "-2048", "-32768"}},
+		{"digital maximum", 8, []string{"32767", "2047", "32767"}},
+		{"prefiltering", 80, []string{"", "", ""}},
+		{"samples per record", 8, []string{"4", "2", "13"}},
+		{"reserved", 32, []string{"", "", ""}},
+	}
+	offset := 256
+	for _, field := range signalFields {
+		for i, value := range field.want {
+			got := string(file[offset : offset+field.width])
+			if want := value + strings.Repeat(" ", field.width-len(value)); got != want {
+				t.Errorf("signal %d %s = %q, want %q", i, field.name, got, want)
+			}
+			offset += field.width
+		}
+	}
+	if offset != 1024 {
+		t.Errorf("signal fields end at %d, want 1024", offset)
+	}
+}
+
+func TestWriterRecords(t *testing.T) {
+	header := testHeader()
+	file, w := writeFile(t, header)
+
+	// Annotation signal of each record: the time-keeping TAL, then the
+	// annotations whose onset falls in the record, zero padded
+	annotations := []string{
+		"+0\x14\x14\x00",
+		"+1\x14\x14\x00+1.5\x150.25\x14gap here\x14\x00",
+		"+2\x14\x14\x00+2.5\x14stop\x14\x00",
+	}
+	if w.RecordSize() != 2*(4+2+13) {
+		t.Fatalf("RecordSize() = %d, want %d", w.RecordSize(), 2*(4+2+13))
+	}
+
+	records := file[1024:]
+	for record, tal := range annotations {
+		data := records[record*w.RecordSize() : (record+1)*w.RecordSize()]
+
+		samples := make([]int16, 6)
+		if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, samples); err != nil {
+			t.Fatal(err)
+		}
+		base := int16(100 * record)
+		want := []int16{base, base + 1, base + 2, base + 3, base + 10, base + 11}
+		for i := range want {
+			if samples[i] != want[i] {
+				t.Errorf("record %d samples %v, want %v", record, samples, want)
+				break
+			}
+		}
+
+		wantTAL := tal + strings.Repeat("\x00", 26-len(tal))
+		if got := string(data[12:]); got != wantTAL {
+			t.Errorf("record %d annotations %q, want %q", record, got, wantTAL)
+		}
+	}
+}
+
+func TestNewWriterInvalidHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(h *Header)
+	}{
+		{"zero record duration", func(h *Header) { h.RecordDuration = 0 }},
+		{"negative records", func(h *Header) { h.Records = -1 }},
+		{"no signals", func(h *Header) { h.Signals = nil }},
+		{"reserved label", func(h *Header) { h.Signals[0].Label = "EDF Annotations" }},
+		{"no samples", func(h *Header) { h.Signals[1].SamplesPerRecord = 0 }},
+		{"digital range beyond 16 bits", func(h *Header) { h.Signals[0].DigitalMax = 40000 }},
+		{"inverted digital range", func(h *Header) { h.Signals[0].DigitalMin = h.Signals[0].DigitalMax }},
+		{"empty physical range", func(h *Header) { h.Signals[1].PhysicalMax = h.Signals[1].PhysicalMin }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := testHeader()
+			tt.modify(&header)
+			if _, err := NewWriter(&bytes.Buffer{}, header); !errors.Is(err, ErrInvalidHeader) {
+				t.Errorf("got %v, want ErrInvalidHeader", err)
+			}
+		})
+	}
+}
+
+func TestWriterRecordCount(t *testing.T) {
+	header := testHeader()
+	header.Records = 1
+	samples := [][]int16{make([]int16, 4), make([]int16, 2)}
+
+	w, err := NewWriter(&bytes.Buffer{}, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRecord([][]int16{make([]int16, 4), make([]int16, 3)}); err == nil {
+		t.Error("WriteRecord accepted a signal with the wrong number of samples")
+	}
+	if err := w.Close(); err == nil {
+		t.Error("Close accepted a file missing its data record")
+	}
+	if err := w.WriteRecord(samples); err != nil {
+		t.Fatalf("WriteRecord: %v", err)
+	}
+	if err := w.WriteRecord(samples); err == nil {
+		t.Error("WriteRecord accepted more records than the header declares")
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  string
+	}{
+		{0, "0"},
+		{-32768, "-32768"},
+		{0.000125, "0.000125"},
+		{-1234.5678, "-1234.57"},
+		{123456789, "1.23e+08"},
+		{1.0 / 3, "0.333333"},
+	}
+	for _, tt := range tests {
+		if got := formatNumber(tt.value); got != tt.want {
+			t.Errorf("formatNumber(%v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -3,6 +3,8 @@ const API_BASE_URL = window.location.origin;
 let currentSession = null;
 let currentAcquisition = null;
 let websocketConnection = null;
+let websocketReconnectAttempts = 0;
+const MAX_WEBSOCKET_RECONNECT_ATTEMPTS = 5;
 
 document.addEventListener('DOMContentLoaded', function() {
     const acquireButton = document.getElementById('acquire-btn');
@@ -478,7 +480,7 @@ async function registerDeviceWithServer(device) {
             productId: device.productId,
             productName: device.productName || 'Unknown Device',
             manufacturerName: device.manufacturerName || 'Unknown Manufacturer',
-            serialNumber: device.serialNumber || `DEV_${Date.now()}`,
+            serialNumber: device.serialNumber || '',
             usbVersion: device.usbVersionMajor ? `${device.usbVersionMajor}.${device.usbVersionMinor}` : '2.0'
         };
         
@@ -490,10 +492,18 @@ async function registerDeviceWithServer(device) {
             firmwareVersion: '1.0.0' // Default version
         };
         
-        // Build connection details
+        // Build connection details, with the endpoints of every interface
+        // so acquisitions can record from each of them
         const connectionDetails = {
-            interfaceNumber: 0,
-            endpoints: []
+            interfaceNumber: window.currentInterface ?? 0,
+            endpoints: (device.configuration ? device.configuration.interfaces : []).flatMap(iface =>
+                iface.alternates[0].endpoints.map(ep => ({
+                    interfaceNumber: iface.interfaceNumber,
+                    number: ep.endpointNumber,
+                    direction: ep.direction,
+                    type: ep.type,
+                    maxPacketSize: ep.packetSize
+                })))
         };
         
         const registrationData = {
@@ -645,8 +655,10 @@ async function startDataAcquisition() {
             acquisitionId: result.acquisitionId,
             streamEndpoint: result.streamEndpoint,
             expectedDataSize: result.expectedDataSize,
-            chunkSize: result.chunkSize
+            chunkSize: result.chunkSize,
+            resumeToken: result.resumeToken
         };
+        websocketReconnectAttempts = 0;
         
         // Connect to WebSocket for real-time data streaming
         connectToWebSocket(result.streamEndpoint);
@@ -693,14 +705,15 @@ async function stopDataAcquisition() {
         const result = await response.json();
         console.log('Acquisition stopped:', result);
         
+        // Clear the acquisition first so the close handler does not reconnect
+        currentAcquisition = null;
+        
         // Disconnect WebSocket
         if (websocketConnection) {
             websocketConnection.close();
             websocketConnection = null;
         }
         
-        currentAcquisition = null;
-        
         displayConnectionStatus('Data acquisition stopped');
         return result;
         
@@ -712,18 +725,29 @@ async function stopDataAcquisition() {
 }
 
 /**
- * Connect to WebSocket for real-time data streaming
+ * Connect to WebSocket for real-time data streaming.
+ * When resumeToken is given the server treats the connection as a resumption
+ * of the same acquisition and replies with a resume_ack message.
  */
-function connectToWebSocket(streamEndpoint) {
+function connectToWebSocket(streamEndpoint, resumeToken) {
     try {
         console.log('Connecting to WebSocket:', streamEndpoint);
         
         // Convert HTTP URL to WebSocket URL if needed
-        const wsUrl = streamEndpoint.replace('http://', 'ws://').replace('https://', 'wss://');
+        let wsUrl = streamEndpoint.replace('http://', 'ws://').replace('https://', 'wss://');
+        if (resumeToken) {
+            wsUrl += `?resumeToken=${encodeURIComponent(resumeToken)}`;
+        }
         websocketConnection = new WebSocket(wsUrl);
         
         websocketConnection.onopen = function(event) {
             console.log('WebSocket connection opened');
+            websocketReconnectAttempts = 0;
+            // Credit is granted per connection, so start from zero
+            if (currentAcquisition) {
+                currentAcquisition.creditChunks = 0;
+                currentAcquisition.creditBytes = 0;
+            }
             displayConnectionStatus('Real-time streaming connected');
         };
         
@@ -744,7 +768,7 @@ function connectToWebSocket(streamEndpoint) {
         websocketConnection.onclose = function(event) {
             console.log('WebSocket connection closed:', event.code, event.reason);
             if (currentAcquisition) {
-                displayErrorMessage('Streaming Disconnected', 'Real-time streaming connection was lost');
+                reconnectWebSocket();
             }
         };
         
@@ -754,6 +778,27 @@ function connectToWebSocket(streamEndpoint) {
     }
 }
 
+/**
+ * Reconnect a dropped stream with exponential backoff, resuming the current
+ * acquisition instead of starting a new one
+ */
+function reconnectWebSocket() {
+    if (websocketReconnectAttempts >= MAX_WEBSOCKET_RECONNECT_ATTEMPTS) {
+        displayErrorMessage('Streaming Disconnected', 'Real-time streaming connection was lost');
+        return;
+    }
+    
+    const delay = Math.min(1000 * 2 ** websocketReconnectAttempts, 10000);
+    websocketReconnectAttempts++;
+    displayConnectionStatus(`Streaming interrupted, reconnecting (attempt ${websocketReconnectAttempts})...`);
+    
+    setTimeout(() => {
+        if (currentAcquisition) {
+            connectToWebSocket(currentAcquisition.streamEndpoint, currentAcquisition.resumeToken);
+        }
+    }, delay);
+}
+
 /**
  * Handle incoming WebSocket messages
  */
@@ -773,6 +818,15 @@ function handleWebSocketMessage(message) {
         case 'processing_feedback':
             handleProcessingFeedback(message);
             break;
+        case 'resume_ack':
+            handleResumeAck(message);
+            break;
+        case 'credit':
+            handleCreditGrant(message);
+            break;
+        case 'stream_control':
+            handleStreamControl(message);
+            break;
         default:
             console.log('Unknown WebSocket message type:', message.type);
     }
@@ -798,6 +852,148 @@ function handleDataChunk(message) {
     }
 }
 
+/**
+ * Handle resume acknowledgment after a reconnection
+ */
+function handleResumeAck(message) {
+    console.log('Stream resumed at chunk', message.nextChunkIndex, message);
+    if (currentAcquisition) {
+        continueChunksFrom(message.nextChunkIndex);
+    }
+    displayConnectionStatus('Real-time streaming resumed');
+}
+
+/**
+ * Handle a pause or resume of the acquisition. While paused nothing is sent
+ * and samples read from the device are discarded; on resume chunks are
+ * numbered on from the index the server gives.
+ */
+function handleStreamControl(message) {
+    if (!currentAcquisition) {
+        return;
+    }
+    if (message.action === 'pause') {
+        currentAcquisition.paused = true;
+        currentAcquisition.pendingChunks = [];
+        displayConnectionStatus(`Acquisition paused: ${message.reason}`);
+    } else if (message.action === 'resume') {
+        currentAcquisition.paused = false;
+        continueChunksFrom(message.nextChunk);
+        displayConnectionStatus('Acquisition resumed');
+        flushPendingChunks();
+    }
+}
+
+/**
+ * Handle a flow control grant. Data may only be sent while credit remains;
+ * each chunk sent consumes one chunk and its size in bytes.
+ */
+function handleCreditGrant(message) {
+    if (!currentAcquisition) {
+        return;
+    }
+    currentAcquisition.creditChunks = (currentAcquisition.creditChunks || 0) + message.chunks;
+    currentAcquisition.creditBytes = (currentAcquisition.creditBytes || 0) + message.bytes;
+    flushPendingChunks();
+}
+
+/**
+ * Queue a chunk of samples read from the device for streaming. Chunks are
+ * numbered in the order they are queued and sent as credit allows. Nothing
+ * is queued while the acquisition is paused.
+ */
+function sendChunk(payload, channel = 0) {
+    if (!currentAcquisition || currentAcquisition.paused) {
+        return false;
+    }
+    const data = payload instanceof Uint8Array ? payload : new Uint8Array(payload);
+    const index = currentAcquisition.nextChunkIndex || 0;
+    currentAcquisition.nextChunkIndex = index + 1;
+    currentAcquisition.pendingChunks = currentAcquisition.pendingChunks || [];
+    currentAcquisition.pendingChunks.push({ index, channel, data, timestamp: Date.now() });
+    flushPendingChunks();
+    return true;
+}
+
+/**
+ * Send queued chunks while the granted credit covers them. Each chunk consumes
+ * one chunk and its payload size in bytes; whatever does not fit waits for the
+ * next credit message.
+ */
+function flushPendingChunks() {
+    if (!currentAcquisition || currentAcquisition.paused || !websocketConnection || websocketConnection.readyState !== WebSocket.OPEN) {
+        return;
+    }
+    const pending = currentAcquisition.pendingChunks || [];
+    while (pending.length > 0) {
+        const chunk = pending[0];
+        if (currentAcquisition.creditChunks < 1 || currentAcquisition.creditBytes < chunk.data.byteLength) {
+            return;
+        }
+        websocketConnection.send(encodeChunkFrame(chunk));
+        currentAcquisition.creditChunks -= 1;
+        currentAcquisition.creditBytes -= chunk.data.byteLength;
+        pending.shift();
+    }
+}
+
+/**
+ * Number the chunks still waiting to be sent, and any queued after them,
+ * from index onwards
+ */
+function continueChunksFrom(index) {
+    const pending = currentAcquisition.pendingChunks || [];
+    pending.forEach((chunk, i) => {
+        chunk.index = index + i;
+    });
+    currentAcquisition.nextChunkIndex = index + pending.length;
+}
+
+/**
+ * Encode a chunk as a binary frame: a 32-byte big-endian header (magic "ACQF",
+ * version, flags, channel, chunk index, timestamp in Unix nanoseconds,
+ * payload length, CRC-32C of the header and payload) followed by the payload
+ */
+function encodeChunkFrame(chunk) {
+    const frame = new Uint8Array(32 + chunk.data.byteLength);
+    const view = new DataView(frame.buffer);
+    frame.set([0x41, 0x43, 0x51, 0x46], 0);
+    view.setUint8(4, 1);
+    view.setUint8(5, 0);
+    view.setUint16(6, chunk.channel);
+    view.setBigUint64(8, BigInt(chunk.index));
+    view.setBigUint64(16, BigInt(chunk.timestamp) * 1000000n);
+    view.setUint32(24, chunk.data.byteLength);
+    frame.set(chunk.data, 32);
+
+    let crc = crc32c(0xFFFFFFFF, frame.subarray(0, 28));
+    crc = crc32c(crc, chunk.data);
+    view.setUint32(28, (crc ^ 0xFFFFFFFF) >>> 0);
+    return frame.buffer;
+}
+
+const CRC32C_TABLE = (() => {
+    const table = new Uint32Array(256);
+    for (let i = 0; i < 256; i++) {
+        let c = i;
+        for (let k = 0; k < 8; k++) {
+            c = c & 1 ? (c >>> 1) ^ 0x82F63B78 : c >>> 1;
+        }
+        table[i] = c >>> 0;
+    }
+    return table;
+})();
+
+/**
+ * Continue a CRC-32C (Castagnoli) computation over bytes
+ */
+function crc32c(crc, bytes) {
+    for (let i = 0; i < bytes.length; i++) {
+        crc = CRC32C_TABLE[(crc ^ bytes[i]) & 0xFF] ^ (crc >>> 8);
+    }
+    return crc >>> 0;
+}
+
 /**
  * Handle status update messages
  */